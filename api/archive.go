@@ -0,0 +1,109 @@
+package api
+
+import (
+	"PaiDownloader/download"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleArchiveRequest 将已结束任务的文件打包为 ZIP 或 tar.gz 流式返回
+// 查询参数 format 指定归档格式（zip/tar.gz），types 以逗号分隔筛选文件类型
+func HandleArchiveRequest(c *gin.Context) {
+	historyID := c.Param("id")
+
+	format, err := download.NormalizeArchiveFormat(c.DefaultQuery("format", download.ArchiveZip))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:    400,
+			Message: "无效的归档格式",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	// 查找对应的任务历史记录
+	job, ok := findHistory(historyID)
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Code:    404,
+			Message: "任务不存在",
+		})
+		return
+	}
+
+	// 收集该任务下每个文件的下载记录
+	entries := jobFileEntries(historyID)
+	if len(entries) < job.Total {
+		c.JSON(http.StatusConflict, APIResponse{
+			Code:    409,
+			Message: "任务尚未完成",
+			Data: map[string]interface{}{
+				"total":    job.Total,
+				"finished": len(entries),
+			},
+		})
+		return
+	}
+
+	types := parseTypeFilter(c.Query("types"))
+	manifest := download.Manifest{
+		JobID:     job.ID,
+		SourceURL: job.URL,
+		CreatedAt: time.Now(),
+	}
+	for _, entry := range entries {
+		if !entry.HasFile() {
+			continue
+		}
+		if len(types) > 0 && !types[strings.ToLower(entry.Type)] {
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(job.OutputDir, entry.Type, entry.Filename))
+		if err != nil || info.IsDir() {
+			continue
+		}
+		file := manifestFileFromEntry(entry)
+		file.Size = info.Size()
+		manifest.Files = append(manifest.Files, file)
+	}
+
+	if len(manifest.Files) == 0 {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Code:    404,
+			Message: "没有可打包的文件",
+		})
+		return
+	}
+
+	contentType := "application/zip"
+	if format == download.ArchiveTarGz {
+		contentType = "application/gzip"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, job.ID, format))
+	c.Status(http.StatusOK)
+
+	// 响应头已发送，出错时只能记录日志并中断连接
+	if err := download.WriteArchive(c.Writer, format, job.OutputDir, manifest); err != nil {
+		logger.Error("生成归档失败", "job_id", job.ID, "error", err)
+		c.Abort()
+	}
+}
+
+// parseTypeFilter 解析逗号分隔的文件类型筛选参数
+func parseTypeFilter(raw string) map[string]bool {
+	types := make(map[string]bool)
+	for _, t := range strings.Split(raw, ",") {
+		if t = strings.TrimSpace(strings.ToLower(t)); t != "" {
+			types[t] = true
+		}
+	}
+	return types
+}
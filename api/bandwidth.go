@@ -0,0 +1,52 @@
+package api
+
+import (
+	"PaiDownloader/download"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleGetBandwidth 返回当前生效的全局、按主机和按任务限速配置
+func HandleGetBandwidth(c *gin.Context) {
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "Success",
+		Data:    download.Bandwidth.Limits(),
+	})
+}
+
+// HandleSetBandwidth 在运行时调整限速，单位为字节/秒，0 表示取消对应限速
+// 未出现在请求中的项保持不变，调整对正在进行的下载立即生效
+func HandleSetBandwidth(c *gin.Context) {
+	var request struct {
+		Global *int64           `json:"global"`
+		Hosts  map[string]int64 `json:"hosts"`
+		Jobs   map[string]int64 `json:"jobs"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:    400,
+			Message: "无效的请求参数",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	if request.Global != nil {
+		download.Bandwidth.SetGlobalLimit(*request.Global)
+	}
+	for host, limit := range request.Hosts {
+		download.Bandwidth.SetHostLimit(host, limit)
+	}
+	for jobID, limit := range request.Jobs {
+		download.Bandwidth.SetJobLimit(jobID, limit)
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "限速已更新",
+		Data:    download.Bandwidth.Limits(),
+	})
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"PaiDownloader/download"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChangeReport 汇总一次任务中资源相对上次运行的变化
+type ChangeReport struct {
+	JobID     string   `json:"job_id"`
+	URL       string   `json:"url"`
+	Finished  bool     `json:"finished"`
+	New       []string `json:"new"`
+	Updated   []string `json:"updated"`
+	Unchanged []string `json:"unchanged"`
+	Failed    []string `json:"failed"`
+}
+
+// HandleChangesRequest 返回任务中新增、更新、未变化和失败的资源列表
+func HandleChangesRequest(c *gin.Context) {
+	historyID := c.Param("id")
+
+	job, ok := findHistory(historyID)
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Code:    404,
+			Message: "任务不存在",
+		})
+		return
+	}
+
+	entries := jobFileEntries(historyID)
+	report := ChangeReport{
+		JobID:     job.ID,
+		URL:       job.URL,
+		Finished:  len(entries) >= job.Total,
+		New:       []string{},
+		Updated:   []string{},
+		Unchanged: []string{},
+		Failed:    []string{},
+	}
+	for _, entry := range entries {
+		switch {
+		case !entry.HasFile():
+			report.Failed = append(report.Failed, entry.URL)
+		case entry.Change == download.ChangeNew:
+			report.New = append(report.New, entry.URL)
+		case entry.Change == download.ChangeUpdated:
+			report.Updated = append(report.Updated, entry.URL)
+		default:
+			report.Unchanged = append(report.Unchanged, entry.URL)
+		}
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "Success",
+		Data:    report,
+	})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"PaiDownloader/download"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sseHeartbeatInterval = 15 * time.Second // 心跳注释的发送间隔，防止代理断开空闲连接
+	sseRetryMillis       = 3000             // 建议客户端断线后的重连间隔
+)
+
+// lastEventID 读取客户端已收到的最后一个事件 ID
+// 浏览器重连时通过 Last-Event-ID 请求头携带，首次连接可用查询参数 last_event_id 指定
+func lastEventID(c *gin.Context) uint64 {
+	raw := c.GetHeader("Last-Event-ID")
+	if raw == "" {
+		raw = c.Query("last_event_id")
+	}
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// writeEvent 以 SSE 格式写出一个任务事件
+func writeEvent(c *gin.Context, event download.JobEvent) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// HandleJobEvents 以 SSE 推送单个任务的事件：task_started、task_progress、task_completed、task_failed、job_finished
+// 每个事件携带 ID，断线重连时从 Last-Event-ID 之后补发缓冲区中的事件，进度事件每个文件只补发最近一次
+// 任务结束事件发出后关闭连接
+func HandleJobEvents(c *gin.Context) {
+	job, ok := jobs.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Code:    404,
+			Message: "任务不存在",
+		})
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	// 先订阅再读取缓冲区，避免遗漏两者之间发布的事件
+	notify, unsubscribe := job.Events.Subscribe()
+	defer unsubscribe()
+
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", sseRetryMillis)
+	lastID := lastEventID(c)
+	events, complete := job.Events.Since(lastID)
+	if !complete {
+		fmt.Fprintf(c.Writer, ": 部分事件已被覆盖，请通过 GET /jobs/%s 获取完整状态\n\n", job.ID)
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		for _, event := range events {
+			if err := writeEvent(c, event); err != nil {
+				return
+			}
+			lastID = event.ID
+			if event.Type == download.EventJobFinished {
+				c.Writer.Flush()
+				return
+			}
+		}
+		c.Writer.Flush()
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-shutdownCh:
+			writeShutdownEvent(c)
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			events = nil
+		case <-notify:
+			events, _ = job.Events.Since(lastID)
+		}
+	}
+}
+
+// writeShutdownEvent 服务关闭前通知客户端事件流即将结束
+func writeShutdownEvent(c *gin.Context) {
+	fmt.Fprintf(c.Writer, "event: shutdown\ndata: {\"message\":\"服务正在关闭\"}\n\n")
+	c.Writer.Flush()
+}
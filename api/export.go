@@ -0,0 +1,311 @@
+package api
+
+import (
+	"PaiDownloader/download"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 导出格式
+const (
+	ExportCSV   = "csv"
+	ExportJSONL = "jsonl"
+	ExportHTML  = "html"
+)
+
+// exportColumns CSV 导出的列
+var exportColumns = []string{
+	"job_id", "job_url", "url", "type", "filename", "status", "change", "size",
+	"sha256", "retry_count", "error_class", "error", "start_time", "end_time",
+}
+
+// ExportRow 导出中的一行，对应单个文件的下载结果
+type ExportRow struct {
+	JobID  string `json:"job_id"`
+	JobURL string `json:"job_url"`
+	download.DownloadHistoryEntry
+}
+
+// TypeStat 按文件类型统计的下载结果
+type TypeStat struct {
+	Type      string
+	Files     int
+	Completed int
+	Skipped   int
+	Failed    int
+	Cancelled int
+	Bytes     int64
+}
+
+// ExportReport HTML 报告使用的汇总数据
+type ExportReport struct {
+	Title       string
+	GeneratedAt time.Time
+	Jobs        []DownloadHistory
+	Files       int
+	Completed   int
+	Skipped     int
+	Failed      int
+	Cancelled   int
+	Bytes       int64
+	Duration    time.Duration
+	Types       []TypeStat
+	FailedFiles []ExportRow
+}
+
+// reportTemplate 独立的 HTML 报告模板，不依赖外部样式与脚本
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"size": download.FormatFileSize,
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Local().Format("2006-01-02 15:04:05")
+	},
+	"duration": func(start, end time.Time) string {
+		if end.IsZero() {
+			return "进行中"
+		}
+		return end.Sub(start).Round(time.Second).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "Microsoft YaHei", sans-serif; margin: 32px; color: #2c3e50; }
+h1 { font-size: 22px; } h2 { font-size: 17px; margin-top: 28px; }
+table { border-collapse: collapse; width: 100%; font-size: 13px; }
+th, td { border: 1px solid #dde3e9; padding: 6px 8px; text-align: left; word-break: break-all; }
+th { background: #f4f6f8; }
+.summary td:first-child { width: 160px; font-weight: bold; }
+.failed { color: #c0392b; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>生成时间: {{time .GeneratedAt}}</p>
+
+<h2>汇总</h2>
+<table class="summary">
+<tr><td>任务数</td><td>{{len .Jobs}}</td></tr>
+<tr><td>文件数</td><td>{{.Files}}</td></tr>
+<tr><td>已完成</td><td>{{.Completed}}</td></tr>
+<tr><td>未变化跳过</td><td>{{.Skipped}}</td></tr>
+<tr><td>失败</td><td class="failed">{{.Failed}}</td></tr>
+<tr><td>已取消</td><td>{{.Cancelled}}</td></tr>
+<tr><td>总大小</td><td>{{size .Bytes}}</td></tr>
+<tr><td>总耗时</td><td>{{.Duration}}</td></tr>
+</table>
+
+<h2>按类型统计</h2>
+<table>
+<tr><th>类型</th><th>文件数</th><th>已完成</th><th>跳过</th><th>失败</th><th>取消</th><th>大小</th></tr>
+{{range .Types}}<tr><td>{{.Type}}</td><td>{{.Files}}</td><td>{{.Completed}}</td><td>{{.Skipped}}</td><td>{{.Failed}}</td><td>{{.Cancelled}}</td><td>{{size .Bytes}}</td></tr>
+{{end}}</table>
+
+<h2>失败的文件</h2>
+{{if .FailedFiles}}<table>
+<tr><th>URL</th><th>类型</th><th>错误分类</th><th>错误信息</th><th>重试次数</th></tr>
+{{range .FailedFiles}}<tr><td>{{.URL}}</td><td>{{.Type}}</td><td>{{.ErrorClass}}</td><td class="failed">{{.Error}}</td><td>{{.RetryCount}}</td></tr>
+{{end}}</table>{{else}}<p>无</p>{{end}}
+
+<h2>任务</h2>
+<table>
+<tr><th>任务 ID</th><th>URL</th><th>状态</th><th>开始时间</th><th>耗时</th><th>完成/总数</th><th>失败</th></tr>
+{{range .Jobs}}<tr><td>{{.ID}}</td><td>{{.URL}}</td><td>{{.Status}}</td><td>{{time .StartTime}}</td><td>{{duration .StartTime .EndTime}}</td><td>{{.Completed}}/{{.Total}}</td><td>{{.Failed}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// exportRows 展开任务中每个文件的下载结果
+func exportRows(histories []DownloadHistory) []ExportRow {
+	var rows []ExportRow
+	for _, history := range histories {
+		for _, entry := range history.Files {
+			rows = append(rows, ExportRow{JobID: history.ID, JobURL: history.URL, DownloadHistoryEntry: entry})
+		}
+	}
+	return rows
+}
+
+// writeCSV 以 CSV 格式写出每个文件的下载结果
+func writeCSV(w io.Writer, rows []ExportRow) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportColumns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := []string{
+			row.JobID, row.JobURL, row.URL, row.Type, row.Filename, row.Status, row.Change,
+			strconv.FormatInt(row.Size, 10), row.SHA256, strconv.Itoa(row.RetryCount),
+			row.ErrorClass, row.Error, formatExportTime(row.StartTime), formatExportTime(row.EndTime),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeJSONL 以 JSON Lines 格式写出每个文件的下载结果，每行一个 JSON 对象
+func writeJSONL(w io.Writer, rows []ExportRow) error {
+	encoder := json.NewEncoder(w)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHTMLReport 生成独立的 HTML 报告
+func writeHTMLReport(w io.Writer, title string, histories []DownloadHistory) error {
+	report := ExportReport{
+		Title:       title,
+		GeneratedAt: time.Now(),
+		Jobs:        histories,
+	}
+
+	types := make(map[string]*TypeStat)
+	for _, row := range exportRows(histories) {
+		stat, ok := types[row.Type]
+		if !ok {
+			stat = &TypeStat{Type: row.Type}
+			types[row.Type] = stat
+		}
+		stat.Files++
+		report.Files++
+		switch row.Status {
+		case "completed":
+			stat.Completed++
+			report.Completed++
+		case "skipped":
+			stat.Skipped++
+			report.Skipped++
+		case "failed":
+			stat.Failed++
+			report.Failed++
+			report.FailedFiles = append(report.FailedFiles, row)
+		case "cancelled":
+			stat.Cancelled++
+			report.Cancelled++
+		}
+		if row.HasFile() {
+			stat.Bytes += row.Size
+			report.Bytes += row.Size
+		}
+	}
+	for _, stat := range types {
+		report.Types = append(report.Types, *stat)
+	}
+	sort.Slice(report.Types, func(i, j int) bool { return report.Types[i].Type < report.Types[j].Type })
+
+	for _, history := range histories {
+		if !history.EndTime.IsZero() {
+			report.Duration += history.EndTime.Sub(history.StartTime)
+		}
+	}
+	report.Duration = report.Duration.Round(time.Second)
+
+	return reportTemplate.Execute(w, report)
+}
+
+// formatExportTime 格式化导出中的时间，零值输出为空
+func formatExportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// writeExport 按格式写出导出内容并设置响应头
+func writeExport(c *gin.Context, format, name, title string, histories []DownloadHistory) {
+	var contentType, ext string
+	switch format {
+	case ExportCSV:
+		contentType, ext = "text/csv; charset=utf-8", "csv"
+	case ExportJSONL:
+		contentType, ext = "application/x-ndjson; charset=utf-8", "jsonl"
+	case ExportHTML:
+		contentType, ext = "text/html; charset=utf-8", "html"
+	default:
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:    400,
+			Message: "无效的导出格式",
+			Data:    fmt.Sprintf("不支持的格式: %s", format),
+		})
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+ext))
+	c.Status(http.StatusOK)
+
+	var err error
+	switch format {
+	case ExportCSV:
+		err = writeCSV(c.Writer, exportRows(histories))
+	case ExportJSONL:
+		err = writeJSONL(c.Writer, exportRows(histories))
+	case ExportHTML:
+		err = writeHTMLReport(c.Writer, title, histories)
+	}
+	if err != nil {
+		logger.Error("导出失败", "format", format, "error", err)
+	}
+}
+
+// HandleExportHistory 导出满足筛选条件的所有任务，查询参数 format 指定 csv/jsonl/html，筛选参数与历史记录列表相同
+func HandleExportHistory(c *gin.Context) {
+	query, err := parseHistoryQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:    400,
+			Message: "无效的查询参数",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	historyLock.Lock()
+	var histories []DownloadHistory
+	for _, history := range downloadHistory {
+		if query.match(history) {
+			history.Files = append([]download.DownloadHistoryEntry(nil), history.Files...)
+			histories = append(histories, history)
+		}
+	}
+	historyLock.Unlock()
+	sort.SliceStable(histories, func(i, j int) bool { return histories[i].StartTime.After(histories[j].StartTime) })
+
+	name := "history-" + time.Now().Format("20060102-150405")
+	writeExport(c, c.DefaultQuery("format", ExportCSV), name, "下载历史报告", histories)
+}
+
+// HandleExportJob 导出单个任务的下载结果，查询参数 format 指定 csv/jsonl/html
+func HandleExportJob(c *gin.Context) {
+	history, ok := findHistory(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Code:    404,
+			Message: "任务不存在",
+		})
+		return
+	}
+
+	title := "下载任务报告 - " + history.URL
+	writeExport(c, c.DefaultQuery("format", ExportCSV), "job-"+history.ID, title, []DownloadHistory{history})
+}
@@ -2,12 +2,14 @@ package api
 
 import (
 	"PaiDownloader/download"
+	"PaiDownloader/webhook"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,42 +17,69 @@ import (
 )
 
 // 全局变量声明
-var downloader *download.ResourceDownloader    // 下载器实例 负责处理资源下载任务
-var downloadChannel chan download.DownloadTask // 下载任务的通道 用于向工作协程分发任务
-var progress *download.Progress                // 记录下载任务的进度信息
-var taskStatuses []download.TaskStatus         // 存储每个下载任务的状态
-var taskStatusLock sync.Mutex                  // 保护 taskStatuses 的并发访问
-var downloadHistory []DownloadHistory          // 存储下载历史记录
-var historyLock sync.Mutex                     // 保护 downloadHistory 的并发访问
-var historyFilePath = "download_history.json"  // 下载历史记录文件的路径
-
-// init 函数在包被加载时执行，用于初始化下载器、日志文件、下载目录和加载历史记录
+var downloader atomic.Pointer[download.ResourceDownloader] // 下载器模板 每个任务基于它创建独立的配置，重新加载配置时整体替换
+var logger *download.Logger                                // 服务日志 与下载器模板共用
+
+var jobs *download.JobManager                 // 任务管理器 各任务共享工作协程池
+var downloadHistory []DownloadHistory         // 存储下载历史记录
+var historyLock sync.Mutex                    // 保护 downloadHistory 的并发访问
+var historyFilePath = "download_history.json" // 下载历史记录文件的路径
+var historyDirty bool                         // 有尚未写入文件的历史记录修改，由 historyLock 保护
+var historySaveTimer *time.Timer              // 合并写入历史记录文件的定时器，由 historyLock 保护
+
+// historySaveDelay 文件结束后延迟写入历史记录文件的时间，期间的修改合并为一次写入
+const historySaveDelay = 2 * time.Second
+
+// init 函数在包被加载时执行，用于初始化下载器、日志和加载历史记录
+// 下载目录、并发数等配置由 ConfigureDownloader 按配置文件设置
 func init() {
-	// 初始化下载器，设置默认参数
-	downloader = &download.ResourceDownloader{
-		OutputDir:     "./download_data",
-		MaxConcurrent: 5, // 最大并发下载任务数
-		UserAgent:     "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36",
-		RetryTimes:    3,
-		Timeout:       30 * time.Second,
-	}
+	// 日志在加载配置前输出到标准输出，由 ConfigureLogging 按配置调整级别与输出位置
+	logger = download.NewLogger(os.Stdout, download.LevelInfo)
 
-	// 打开或创建日志文件，用于记录下载过程中的信息
-	logFile, err := os.OpenFile("download.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		panic(fmt.Sprintf("创建日志文件失败: %v", err))
+	// 初始化下载器，设置默认参数
+	d := &download.ResourceDownloader{
+		OutputDir:        "./download_data",
+		MaxConcurrent:    5, // 最大并发下载任务数
+		UserAgent:        "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36",
+		RetryTimes:       3,
+		Timeout:          30 * time.Second,
+		Segments:         download.DefaultSegments,
+		SegmentThreshold: download.DefaultSegmentThreshold,
+		Logger:           logger,
 	}
-	downloader.LogFile = logFile
+	d.GetHTTPClient()
+	downloader.Store(d)
 
-	// 创建下载目录，如果目录已存在则不做处理
-	if err := os.MkdirAll(downloader.OutputDir, 0755); err != nil {
-		panic(fmt.Sprintf("创建下载目录失败: %v", err))
-	}
+	jobs = newJobManager()
 
 	// 加载下载历史记录
 	loadDownloadHistory()
 }
 
+// newJobManager 按下载器的最大并发数创建任务管理器，每个文件结束后写入任务的历史记录并检查任务是否已全部完成
+func newJobManager() *download.JobManager {
+	return download.NewJobManager(downloader.Load().MaxConcurrent, func(job *download.Job, entry download.DownloadHistoryEntry) {
+		recordJobFile(job.ID, entry)
+		notifyFile(job.ID, entry)
+		finishJobIfDone(job)
+	})
+}
+
+// ConfigureDownloader 以按配置创建的下载器作为所有任务的模板，创建下载目录并按其最大并发数重建工作协程池
+// 需在恢复任务与接受请求之前调用
+func ConfigureDownloader(template *download.ResourceDownloader) error {
+	d := *template
+	d.Logger = logger
+	d.GetHTTPClient()
+	if err := os.MkdirAll(d.OutputDir, 0755); err != nil {
+		return fmt.Errorf("创建下载目录失败: %w", err)
+	}
+
+	downloader.Store(&d)
+	jobs = newJobManager()
+	return nil
+}
+
 // APIResponse 定义 API 响应的结构体，包含状态码、消息和数据
 type APIResponse struct {
 	Code    int         `json:"code"`
@@ -61,30 +90,74 @@ type APIResponse struct {
 // 历史记录结构体
 // DownloadHistory 存储每次下载任务的详细信息
 type DownloadHistory struct {
-	URL          string    `json:"url"`
-	Filename     string    `json:"filename"`
-	Type         string    `json:"type"`
-	Size         int64     `json:"size"`
-	Status       string    `json:"status"`
-	StartTime    time.Time `json:"start_time"`
-	EndTime      time.Time `json:"end_time"`
-	RetryCount   int       `json:"retry_count"`
-	LastModified time.Time `json:"last_modified"`
-	ID           string    `json:"id"`
-	FileTypes    []string  `json:"file_types"`
-	Total        int       `json:"total"`
-	Completed    int       `json:"completed"`
-	Failed       int       `json:"failed"`
+	URL          string           `json:"url"`
+	Filename     string           `json:"filename"`
+	Type         string           `json:"type"`
+	Size         int64            `json:"size"`
+	Status       string           `json:"status"`
+	StartTime    time.Time        `json:"start_time"`
+	EndTime      time.Time        `json:"end_time"`
+	RetryCount   int              `json:"retry_count"`
+	LastModified time.Time        `json:"last_modified"`
+	ID           string           `json:"id"`
+	FileTypes    []string         `json:"file_types"`
+	OutputDir    string           `json:"output_dir"`
+	ScheduleID   string           `json:"schedule_id,omitempty"`
+	Request      *DownloadRequest `json:"request,omitempty"` // 创建任务时的请求参数，用于重新运行
+	Total        int              `json:"total"`
+	Completed    int              `json:"completed"`
+	Skipped      int              `json:"skipped"`
+	Failed       int              `json:"failed"`
+	Cancelled    int              `json:"cancelled"`
+	Error        string           `json:"error,omitempty"` // 任务无法继续时的原因
+
+	Files []download.DownloadHistoryEntry `json:"files,omitempty"` // 每个文件的下载结果
+}
+
+// DownloadRequest 定义下载请求的参数，也用于定时任务保存的请求体
+type DownloadRequest struct {
+	URL       string   `json:"url" binding:"required"`
+	FileTypes []string `json:"file_types"`
+	OutputDir string   `json:"output_dir"`
+	Checksums []string `json:"checksums"` // 额外计算的校验算法(md5、sha1)
+	Segments  int      `json:"segments"`  // 大文件分段下载的连接数，1 表示禁用
+
+	BandwidthLimit int64 `json:"bandwidth_limit"` // 本任务的下载限速(字节/秒)，0 表示不限速
+
+	HTTPOptions
+
+	Webhooks []webhook.Endpoint `json:"webhooks,omitempty"` // 本任务额外的 Webhook 接收地址
+
+	ScheduleID string `json:"-"` // 由定时任务触发时对应的定时任务 ID
+}
+
+// HTTPOptions 定义单个任务请求网页与资源时使用的 HTTP 参数，未指定的参数使用全局配置
+type HTTPOptions struct {
+	Headers        map[string]string `json:"headers,omitempty"`         // 额外的请求头，覆盖同名的默认请求头
+	UserAgent      string            `json:"user_agent,omitempty"`      // User-Agent
+	RefererPolicy  string            `json:"referer_policy,omitempty"`  // Referer 策略(page/origin/none)，为空时为 page
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"` // 请求超时(秒)
+	RetryTimes     *int              `json:"retry_times,omitempty"`     // 最大重试次数，0 表示不重试
+}
+
+// jobError 描述启动下载任务失败的原因及对应的 HTTP 状态码
+type jobError struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+// Error 实现 error 接口
+func (e *jobError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
 }
 
 // HandleDownloadRequest 处理下载请求，解析请求参数，初始化下载任务并启动下载
 func HandleDownloadRequest(c *gin.Context) {
-	// 定义请求结构体，用于绑定请求的 JSON 数据
-	var request struct {
-		URL       string   `json:"url" binding:"required"`
-		FileTypes []string `json:"file_types"`
-		OutputDir string   `json:"output_dir"`
-	}
+	var request DownloadRequest
 
 	// 绑定请求的 JSON 数据到 request 结构体
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -97,196 +170,270 @@ func HandleDownloadRequest(c *gin.Context) {
 		return
 	}
 
-	// 解析请求的 URL，检查 URL 格式是否有效
-	parsedURL, err := url.Parse(request.URL)
-	if err != nil || parsedURL.Scheme == "" {
-		// 若 URL 格式无效，返回错误响应
-		c.JSON(http.StatusBadRequest, APIResponse{
-			Code:    400,
-			Message: "无效的URL格式",
+	history, err := startDownloadJob(request)
+	if err != nil {
+		var data interface{}
+		if err.Err != nil {
+			data = err.Err.Error()
+		}
+		c.JSON(err.Status, APIResponse{
+			Code:    err.Status,
+			Message: err.Message,
+			Data:    data,
 		})
 		return
 	}
 
-	// 设置下载器的基础 URL
-	downloader.BaseURL = parsedURL
+	// 如果未找到可下载的资源，返回相应响应
+	if history == nil {
+		c.JSON(http.StatusOK, APIResponse{
+			Code:    200,
+			Message: "未找到可下载的资源",
+		})
+		return
+	}
 
-	// 如果请求中指定了输出目录，创建该目录并更新下载器的输出目录
-	if request.OutputDir != "" {
-		if err := os.MkdirAll(request.OutputDir, 0755); err != nil {
-			// 若创建目录失败，返回错误响应
-			c.JSON(http.StatusInternalServerError, APIResponse{
-				Code:    500,
-				Message: "创建输出目录失败",
-				Data:    err.Error(),
-			})
-			return
+	// 返回成功响应，告知客户端下载任务已开始
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "下载任务已开始",
+		Data: map[string]interface{}{
+			"job_id":      history.ID,
+			"history_id":  history.ID,
+			"total_tasks": history.Total,
+			"started_at":  history.StartTime.Format(time.RFC3339),
+		},
+	})
+}
+
+// validateDownloadRequest 检查下载请求的参数，返回解析后的 URL
+func validateDownloadRequest(request DownloadRequest) (*url.URL, *jobError) {
+	// 检查校验算法是否受支持
+	if err := download.ValidateChecksumAlgorithms(request.Checksums); err != nil {
+		return nil, &jobError{Status: http.StatusBadRequest, Message: "无效的校验算法", Err: err}
+	}
+
+	if jobErr := validateHTTPOptions(request.HTTPOptions); jobErr != nil {
+		return nil, jobErr
+	}
+
+	for _, endpoint := range request.Webhooks {
+		if err := endpoint.Validate(); err != nil {
+			return nil, &jobError{Status: http.StatusBadRequest, Message: "无效的 Webhook 配置", Err: err}
 		}
-		downloader.OutputDir = request.OutputDir
 	}
 
+	// 解析请求的 URL，检查 URL 格式是否有效
+	parsedURL, err := url.Parse(request.URL)
+	if err != nil || parsedURL.Scheme == "" {
+		return nil, &jobError{Status: http.StatusBadRequest, Message: "无效的URL格式"}
+	}
+	return parsedURL, nil
+}
+
+// validateHTTPOptions 检查任务的请求头、Referer 策略、超时与重试次数
+func validateHTTPOptions(options HTTPOptions) *jobError {
+	if err := download.ValidateHeaders(options.Headers); err != nil {
+		return &jobError{Status: http.StatusBadRequest, Message: "无效的请求头", Err: err}
+	}
+	if err := download.ValidateRefererPolicy(options.RefererPolicy); err != nil {
+		return &jobError{Status: http.StatusBadRequest, Message: "无效的 Referer 策略", Err: err}
+	}
+	if options.TimeoutSeconds < 0 {
+		return &jobError{Status: http.StatusBadRequest, Message: "请求超时不能为负数"}
+	}
+	if options.RetryTimes != nil && *options.RetryTimes < 0 {
+		return &jobError{Status: http.StatusBadRequest, Message: "重试次数不能为负数"}
+	}
+	return nil
+}
+
+// applyHTTPOptions 将任务指定的 HTTP 参数应用到任务的下载器
+func applyHTTPOptions(d *download.ResourceDownloader, options HTTPOptions) {
+	d.Headers = options.Headers
+	d.RefererPolicy = options.RefererPolicy
+	if options.UserAgent != "" {
+		d.UserAgent = options.UserAgent
+	}
+	if options.RetryTimes != nil {
+		d.RetryTimes = *options.RetryTimes
+	}
+	if options.TimeoutSeconds > 0 {
+		d.Timeout = time.Duration(options.TimeoutSeconds) * time.Second
+	}
+}
+
+// newJobDownloader 以全局下载器为模板创建单个任务独立的下载器配置，共享 HTTP 客户端
+func newJobDownloader(baseURL *url.URL, fileTypes []string) *download.ResourceDownloader {
+	d := *downloader.Load()
+	d.BaseURL = baseURL
+
 	// 如果请求中指定了文件类型，更新下载器的文件类型列表；否则使用默认列表
-	if len(request.FileTypes) > 0 {
-		downloader.FileTypes = request.FileTypes
+	if len(fileTypes) > 0 {
+		d.FileTypes = fileTypes
 	} else {
-		downloader.FileTypes = []string{
+		d.FileTypes = []string{
 			"image", "script", "style", "video", "audio",
 			"font", "document", "archive", "html", "data",
 		}
 	}
+	return &d
+}
+
+// buildJobDownloader 检查下载请求并按其参数创建任务的下载器配置
+func buildJobDownloader(request DownloadRequest) (*download.ResourceDownloader, *jobError) {
+	parsedURL, jobErr := validateDownloadRequest(request)
+	if jobErr != nil {
+		return nil, jobErr
+	}
+
+	d := newJobDownloader(parsedURL, request.FileTypes)
+
+	// 如果请求中指定了输出目录，创建该目录并更新本任务的输出目录
+	if request.OutputDir != "" {
+		if err := os.MkdirAll(request.OutputDir, 0755); err != nil {
+			return nil, &jobError{Status: http.StatusInternalServerError, Message: "创建输出目录失败", Err: err}
+		}
+		d.OutputDir = request.OutputDir
+	}
+
+	d.Checksums = request.Checksums
+	if request.Segments > 0 {
+		d.Segments = request.Segments
+	}
+	applyHTTPOptions(d, request.HTTPOptions)
+	return d, nil
+}
+
+// startDownloadJob 获取网页并提取资源，创建历史记录后将任务交给任务管理器
+// 未找到可下载的资源时返回 nil 且不创建历史记录
+func startDownloadJob(request DownloadRequest) (*DownloadHistory, *jobError) {
+	if shuttingDown() {
+		return nil, &jobError{Status: http.StatusServiceUnavailable, Message: shutdownMessage}
+	}
 
-	// 如果下载通道未初始化，创建下载通道并启动工作协程
-	if downloadChannel == nil {
-		createDownloadChannel()
+	d, jobErr := buildJobDownloader(request)
+	if jobErr != nil {
+		return nil, jobErr
 	}
 
 	// 获取网页内容
-	htmlContent, err := downloader.FetchHTML()
+	htmlContent, err := d.FetchHTML()
 	if err != nil {
-		// 若获取网页内容失败，返回错误响应
-		c.JSON(http.StatusInternalServerError, APIResponse{
-			Code:    500,
-			Message: "获取网页内容失败",
-			Data:    err.Error(),
-		})
-		return
+		return nil, &jobError{Status: http.StatusInternalServerError, Message: "获取网页内容失败", Err: err}
 	}
 
 	// 从网页内容中提取可下载的资源任务
-	tasks, err := downloader.ExtractResources(htmlContent)
+	tasks, err := d.ExtractResources(htmlContent)
 	if err != nil {
-		// 若分析资源失败，返回错误响应
-		c.JSON(http.StatusInternalServerError, APIResponse{
-			Code:    500,
-			Message: "分析资源失败",
-			Data:    err.Error(),
-		})
-		return
+		return nil, &jobError{Status: http.StatusInternalServerError, Message: "分析资源失败", Err: err}
 	}
 
-	// 如果未找到可下载的资源，返回相应响应
 	if len(tasks) == 0 {
-		c.JSON(http.StatusOK, APIResponse{
-			Code:    200,
-			Message: "未找到可下载的资源",
-		})
-		return
+		return nil, nil
 	}
 
-	// 初始化下载进度信息
-	progress = &download.Progress{
-		Total:     len(tasks),
-		StartTime: time.Now(),
+	// 生成唯一 ID 并初始化历史记录条目，任务 ID 与历史记录 ID 相同
+	job := &download.Job{
+		ID:         uuid.New().String(),
+		URL:        request.URL,
+		Downloader: d,
+		CreatedAt:  time.Now(),
 	}
-	taskStatuses = make([]download.TaskStatus, len(tasks))
-
-	// 生成唯一 ID 并初始化历史记录条目
-	historyID := uuid.New().String()
+	// 任务日志保存完整参数供重启后恢复，历史记录只保存隐藏了敏感值的副本
+	job.Request, _ = json.Marshal(request)
+	rememberJobRequest(job.ID, request)
+	redacted := redactRequest(request)
 	newHistory := DownloadHistory{
-		ID:        historyID,
-		URL:       request.URL,
-		FileTypes: request.FileTypes,
-		StartTime: time.Now(),
-		EndTime:   time.Time{},
-		Total:     len(tasks),
-		Completed: 0,
-		Failed:    0,
-		Status:    "in_progress",
-	}
-
-	// 将新的历史记录条目添加到下载历史记录中
-	historyLock.Lock()
-	downloadHistory = append(downloadHistory, newHistory)
-	historyLock.Unlock()
-
-	// 初始化每个任务的状态并将任务发送到下载通道
-	for i, task := range tasks {
-		taskStatuses[i] = download.TaskStatus{
-			URL:      task.URL,
-			Filename: task.Filename,
-			Type:     task.Type,
-			Status:   "pending",
-		}
-		downloadChannel <- task
+		ID:         job.ID,
+		URL:        request.URL,
+		FileTypes:  request.FileTypes,
+		OutputDir:  d.OutputDir,
+		ScheduleID: request.ScheduleID,
+		Request:    &redacted,
+		StartTime:  job.CreatedAt,
+		EndTime:    time.Time{},
+		Total:      len(tasks),
+		Completed:  0,
+		Failed:     0,
+		Status:     "in_progress",
 	}
 
-	// 返回成功响应，告知客户端下载任务已开始
-	c.JSON(http.StatusOK, APIResponse{
-		Code:    200,
-		Message: "下载任务已开始",
-		Data: map[string]interface{}{
-			"total_tasks": len(tasks),
-			"started_at":  progress.StartTime.Format(time.RFC3339),
-		},
-	})
+	// 设置本任务的下载限速
+	if request.BandwidthLimit > 0 {
+		download.Bandwidth.SetJobLimit(job.ID, request.BandwidthLimit)
+	}
+
+	// 将新的历史记录条目添加到下载历史记录中，立即保存以便重启后恢复任务
+	addDownloadHistory(newHistory)
+
+	// 注册任务并将文件提交到调度器
+	jobs.Add(job, tasks)
+	notifyJob(job.ID, webhook.EventJobStarted, job.Summary())
+
+	return &newHistory, nil
 }
 
-// HandleProgressRequest 处理下载进度请求，返回当前下载任务的进度信息
+// currentJob 返回请求参数 job_id 指定的任务，未指定时返回最近创建的任务
+func currentJob(c *gin.Context) (*download.Job, bool) {
+	if id := c.Query("job_id"); id != "" {
+		return jobs.Get(id)
+	}
+	return jobs.Latest()
+}
+
+// HandleProgressRequest 处理下载进度请求，返回指定任务(默认最近的任务)的进度信息
 func HandleProgressRequest(c *gin.Context) {
-	// 初始化下载进度结果结构体
-	var result download.DownloadProgress
-
-	// 填充下载进度信息
-	result.Total = progress.Total
-	result.Completed = progress.Completed
-	result.Failed = progress.Failed
-	result.Skipped = progress.Skipped
-	result.Duration = fmt.Sprintf("%f", time.Since(progress.StartTime).Seconds())
-	result.Rate = float64(progress.Completed) / time.Since(progress.StartTime).Seconds()
-	result.Tasks = taskStatuses
+	job, ok := currentJob(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Code:    404,
+			Message: "任务不存在",
+		})
+		return
+	}
 
 	// 返回下载进度响应
 	c.JSON(http.StatusOK, APIResponse{
 		Code:    200,
 		Message: "下载进度",
-		Data:    result,
+		Data:    job.Snapshot(),
 	})
 }
 
-// HandleCancelRequest 处理取消下载请求，关闭下载通道以停止所有下载任务
+// HandleCancelRequest 处理取消下载请求：指定 job_id 时取消该任务，否则取消所有未结束的任务
+// keep_partial=true 时保留临时文件供以后续传
 func HandleCancelRequest(c *gin.Context) {
-	// 如果下载通道存在，关闭通道并置为 nil
-	if downloadChannel != nil {
-		close(downloadChannel)
-		downloadChannel = nil
+	keepPartial := c.Query("keep_partial") == "true"
+
+	var ids []string
+	if id := c.Query("job_id"); id != "" {
+		ids = append(ids, id)
+	} else {
+		for _, job := range jobs.List() {
+			if job.Status == download.JobStatusRunning || job.Status == download.JobStatusPaused {
+				ids = append(ids, job.ID)
+			}
+		}
+	}
+
+	cancelled := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, err := cancelJob(id, keepPartial); err == nil {
+			cancelled = append(cancelled, id)
+		}
 	}
 
 	// 返回取消成功响应
 	c.JSON(http.StatusOK, APIResponse{
 		Code:    200,
 		Message: "下载已取消",
+		Data: map[string]interface{}{
+			"cancelled_jobs": cancelled,
+		},
 	})
 }
 
-// createDownloadChannel 创建下载通道并启动工作协程来处理下载任务
-func createDownloadChannel() {
-	// 创建一个带缓冲的下载任务通道
-	downloadChannel = make(chan download.DownloadTask, 100)
-	// 启动工作协程
-	go startDownloadWorkers()
-}
-
-// startDownloadWorkers 启动多个工作协程来处理下载通道中的任务
-func startDownloadWorkers() {
-	// 使用 sync.WaitGroup 来等待所有工作协程完成
-	var wg sync.WaitGroup
-	for i := 0; i < downloader.MaxConcurrent; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			// 从下载通道中获取任务并处理
-			for task := range downloadChannel {
-				fmt.Printf("Worker %d 开始处理任务: %s\n", workerID, task.URL)
-				// 调用下载函数并处理重试逻辑
-				download.DownloadWithRetry(task, downloader, progress, &taskStatuses)
-				fmt.Printf("Worker %d 完成任务: %s\n", workerID, task.URL)
-			}
-		}(i)
-	}
-	// 等待所有工作协程完成
-	wg.Wait()
-}
-
 // HandleIndexPage 处理首页请求，返回静态 HTML 页面
 func HandleIndexPage(c *gin.Context) {
 	// 设置响应的 Content-Type 为 HTML
@@ -307,9 +454,11 @@ func HandleIndexPage(c *gin.Context) {
 // HandlePreviewRequest 处理资源预览请求，解析请求参数，获取网页内容并提取可下载的资源任务
 func HandlePreviewRequest(c *gin.Context) {
 	// 定义请求结构体，用于绑定请求的 JSON 数据
-	var请求struct {
-网站string   `json:"url" binding:"required"`
+	var request struct {
+		URL       string   `json:"url" binding:"required"`
 		FileTypes []string `json:"file_types"`
+
+		HTTPOptions
 	}
 
 	// 绑定请求的 JSON 数据到 request 结构体
@@ -334,21 +483,26 @@ func HandlePreviewRequest(c *gin.Context) {
 		return
 	}
 
-	// 设置下载器的基础 URL
-	downloader.BaseURL = url
-
-	// 如果请求中指定了文件类型，更新下载器的文件类型列表；否则使用默认列表
-	if len(request.FileTypes) > 0 {
-		downloader.FileTypes = request.FileTypes
-	} else {
-		downloader.FileTypes = []string{
-			"image", "script", "style", "video", "audio",
-			"font", "document", "archive", "html", "data",
+	// 检查请求头、Referer 策略、超时与重试次数
+	if jobErr := validateHTTPOptions(request.HTTPOptions); jobErr != nil {
+		var data interface{}
+		if jobErr.Err != nil {
+			data = jobErr.Err.Error()
 		}
+		c.JSON(jobErr.Status, APIResponse{
+			Code:    jobErr.Status,
+			Message: jobErr.Message,
+			Data:    data,
+		})
+		return
 	}
 
+	// 预览使用独立的下载器配置，不影响正在进行的任务
+	d := newJobDownloader(url, request.FileTypes)
+	applyHTTPOptions(d, request.HTTPOptions)
+
 	// 获取网页内容
-	htmlContent, err := downloader.FetchHTML()
+	htmlContent, err := d.FetchHTML()
 	if err != nil {
 		// 若获取网页内容失败，返回错误响应
 		c.JSON(http.StatusInternalServerError, APIResponse{
@@ -360,7 +514,7 @@ func HandlePreviewRequest(c *gin.Context) {
 	}
 
 	// 从网页内容中提取可下载的资源任务
-	tasks, err := downloader.ExtractResources(htmlContent)
+	tasks, err := d.ExtractResources(htmlContent)
 	if err != nil {
 		// 若分析资源失败，返回错误响应
 		c.JSON(http.StatusInternalServerError, APIResponse{
@@ -402,7 +556,7 @@ func HandlePreviewRequest(c *gin.Context) {
 	})
 }
 
-// HandleProgressSSE 处理 SSE 实时推送请求，定期向客户端发送下载进度信息
+// HandleProgressSSE 处理 SSE 实时推送请求，定期向客户端发送指定任务(默认最近的任务)的下载进度信息
 func HandleProgressSSE(c *gin.Context) {
 	// 设置响应的 Content-Type 为 event-stream
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
@@ -418,22 +572,19 @@ func HandleProgressSSE(c *gin.Context) {
 		case <-c.Done():
 			// 若客户端断开连接，退出循环
 			return
+		case <-shutdownCh:
+			// 服务关闭时通知客户端并结束事件流
+			writeShutdownEvent(c)
+			return
 		case <-ticker.C:
-			// 加锁保护 taskStatuses 的并发访问
-			download.TaskStatusLock.Lock()
-			var result download.DownloadProgress
-			// 填充下载进度信息
-			result.Total = progress.Total
-			result.Completed = progress.Completed
-			result.Failed = progress.Failed
-			result.Skipped = progress.Skipped
-			result.Duration = fmt.Sprintf("%f", time.Since(progress.StartTime).Seconds())
-			result.Rate = float64(result.Completed) / time.Since(progress.StartTime).Seconds()
-			result.Tasks = taskStatuses
-			download.TaskStatusLock.Unlock()
+			// 尚未创建任务时等待下一次触发
+			job, ok := currentJob(c)
+			if !ok {
+				continue
+			}
 
 			// 将下载进度信息转换为 JSON 格式
-			data, _ := json.Marshal(result)
+			data, _ := json.Marshal(job.Snapshot())
 			// 发送 SSE 事件
 			fmt.Fprintf(c.Writer, "data: %s\n\n", data)
 			// 刷新响应缓冲区
@@ -447,39 +598,104 @@ func loadDownloadHistory() {
 	// 读取历史记录文件
 	data, err := os.ReadFile(historyFilePath)
 	if err != nil {
-		// 若读取失败，打印错误信息
-		fmt.Printf("读取历史记录文件失败: %v\n", err)
+		// 若读取失败，记录错误日志
+		logger.Error("读取历史记录文件失败", "error", err)
 		return
 	}
 	// 将文件内容解析到 downloadHistory 切片中
 	if err := json.Unmarshal(data, &downloadHistory); err != nil {
-		// 若解析失败，打印错误信息
-		fmt.Printf("解析历史记录文件失败: %v\n", err)
+		// 若解析失败，记录错误日志
+		logger.Error("解析历史记录文件失败", "error", err)
+		return
+	}
+
+	// 早期的历史记录保存了完整的请求参数，加载后隐藏敏感值并立即写回文件
+	// 未完成任务的完整参数由 RestoreJobs 从任务日志中恢复
+	scrubbed := false
+	for i := range downloadHistory {
+		request := downloadHistory[i].Request
+		if request == nil || hasRedacted(*request) {
+			continue
+		}
+		redacted := redactRequest(*request)
+		if hasRedacted(redacted) {
+			scrubbed = true
+		}
+		downloadHistory[i].Request = &redacted
+	}
+	if scrubbed {
+		historyLock.Lock()
+		defer historyLock.Unlock()
+		if err := saveDownloadHistory(); err != nil {
+			logger.Error("保存历史记录失败", "error", err)
+		}
 	}
 }
 
-// saveDownloadHistory 将下载历史记录保存到文件中
+// saveDownloadHistory 将下载历史记录保存到文件中，先写临时文件再重命名以保证原子性，调用方需持有 historyLock
+// 尚未写入的合并修改一并保存
 func saveDownloadHistory() error {
+	if historySaveTimer != nil {
+		historySaveTimer.Stop()
+		historySaveTimer = nil
+	}
 	data, err := json.Marshal(downloadHistory)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(historyFilePath, data, 0644)
+	tmp := historyFilePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, historyFilePath); err != nil {
+		return err
+	}
+	historyDirty = false
+	return nil
 }
 
-// HandleGetHistory 处理获取下载历史记录的请求，返回下载历史记录信息
-func HandleGetHistory(c *gin.Context) {
-	// 加锁保护 downloadHistory 的并发访问
+// scheduleHistorySave 标记历史记录有修改，historySaveDelay 后合并写入文件，调用方需持有 historyLock
+// 进程在写入前退出时，已结束文件的结果记录在任务日志中，重启后补录
+func scheduleHistorySave() {
+	historyDirty = true
+	if historySaveTimer == nil {
+		historySaveTimer = time.AfterFunc(historySaveDelay, flushDownloadHistory)
+	}
+}
+
+// flushDownloadHistory 写入尚未保存的历史记录修改
+func flushDownloadHistory() {
 	historyLock.Lock()
 	defer historyLock.Unlock()
 
-	// 如果没有历史记录，返回相应响应
-	if len(downloadHistory) == 0 {
-		// 可以根据实际情况调整响应内容
-		c.JSON(http.StatusOK, APIResponse{
-			Code:    200,
-			Message: "暂无历史记录",
-			Data:    nil,
+	if !historyDirty {
+		return
+	}
+	if err := saveDownloadHistory(); err != nil {
+		logger.Error("保存历史记录失败", "error", err)
+	}
+}
+
+// addDownloadHistory 添加一条下载历史记录并保存到文件中
+func addDownloadHistory(history DownloadHistory) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	downloadHistory = append(downloadHistory, history)
+	if err := saveDownloadHistory(); err != nil {
+		logger.Error("保存历史记录失败", "error", err)
+	}
+}
+
+// HandleGetHistory 处理获取下载历史记录的请求，支持分页与筛选
+// 查询参数: page、size、status、from/to(RFC3339 或 2006-01-02)、q(URL 子串)、type(逗号分隔的文件类型)
+func HandleGetHistory(c *gin.Context) {
+	query, err := parseHistoryQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:    400,
+			Message: "无效的查询参数",
+			Data:    err.Error(),
 		})
 		return
 	}
@@ -488,7 +704,7 @@ func HandleGetHistory(c *gin.Context) {
 	c.JSON(http.StatusOK, APIResponse{
 		Code:    200,
 		Message: "Success",
-		Data:    downloadHistory,
+		Data:    queryHistory(query),
 	})
 }
 
@@ -509,26 +725,73 @@ func HandleHistoryPage(c *gin.Context) {
 	c.Data(http.StatusOK, "text/html; charset=utf-8", indexHTML)
 }
 
-// updateDownloadHistory 更新指定 ID 的下载历史记录信息，并保存到文件中
-func updateDownloadHistory(historyID string, completed, failed int, status string) {
+// updateDownloadHistory 修改指定 ID 的下载历史记录并立即保存到文件中，记录不存在时返回 false
+func updateDownloadHistory(historyID string, update func(history *DownloadHistory)) bool {
 	historyLock.Lock()
 	defer historyLock.Unlock()
 
-	for i, history := range downloadHistory {
-		if history.ID == historyID {
-			downloadHistory[i].Completed = completed
-			downloadHistory[i].Failed = failed
-			downloadHistory[i].Status = status
-			if status == "completed" || status == "failed" {
-				downloadHistory[i].EndTime = time.Now()
-			}
-			if err := saveDownloadHistory(); err != nil {
-				_, logErr := fmt.Fprintf(downloader.LogFile, "保存历史记录失败: %v\n", err)
-				if logErr != nil {
-					fmt.Printf("写入日志文件失败: %v\n", logErr)
-				}
-			}
-			break
+	if !updateHistoryLocked(historyID, update) {
+		return false
+	}
+	if err := saveDownloadHistory(); err != nil {
+		logger.Error("保存历史记录失败", "error", err)
+	}
+	return true
+}
+
+// updateHistoryLocked 修改指定 ID 的下载历史记录，记录不存在时返回 false，调用方需持有 historyLock
+func updateHistoryLocked(historyID string, update func(history *DownloadHistory)) bool {
+	for i := range downloadHistory {
+		if downloadHistory[i].ID == historyID {
+			update(&downloadHistory[i])
+			return true
 		}
 	}
+	return false
+}
+
+// recordJobFile 将单个文件的下载结果写入所属任务的历史记录并更新计数，最后一个文件结束时确定任务的最终状态
+// 文件结果合并写入历史记录文件，任务结束时立即写入
+func recordJobFile(historyID string, entry download.DownloadHistoryEntry) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	finished := false
+	found := updateHistoryLocked(historyID, func(history *DownloadHistory) {
+		history.Files = append(history.Files, entry)
+		switch entry.Status {
+		case "completed":
+			history.Completed++
+		case "skipped":
+			history.Skipped++
+		case "failed":
+			history.Failed++
+		case "cancelled":
+			history.Cancelled++
+		}
+
+		if len(history.Files) < history.Total {
+			return
+		}
+		history.EndTime = time.Now()
+		finished = true
+		switch {
+		case history.Cancelled > 0:
+			history.Status = "cancelled"
+		case history.Completed+history.Skipped == 0 && history.Failed > 0:
+			history.Status = "failed"
+		default:
+			history.Status = "completed"
+		}
+	})
+	if !found {
+		return
+	}
+	if !finished {
+		scheduleHistorySave()
+		return
+	}
+	if err := saveDownloadHistory(); err != nil {
+		logger.Error("保存历史记录失败", "error", err)
+	}
 }
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"PaiDownloader/download"
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleHealthz 存活检查，进程能处理请求即返回 200
+func HandleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "ok",
+	})
+}
+
+// HandleReadyz 就绪检查，任务恢复完成、未在关闭且下载目录可访问时返回 200，否则返回 503
+func HandleReadyz(c *gin.Context) {
+	status := "ready"
+	switch atomic.LoadInt32(&serverState) {
+	case stateStarting:
+		status = "starting"
+	case stateShuttingDown:
+		status = "shutting_down"
+	}
+
+	var dirErr string
+	outputDir := downloader.Load().OutputDir
+	if info, err := os.Stat(outputDir); err != nil {
+		dirErr = err.Error()
+	} else if !info.IsDir() {
+		dirErr = "下载目录不是目录: " + outputDir
+	}
+
+	total, busy := jobs.Workers()
+	data := gin.H{
+		"status":       status,
+		"workers":      total,
+		"workers_busy": busy,
+		"queue_depth":  download.Scheduler.Pending(),
+	}
+	if dirErr != "" {
+		data["download_dir"] = dirErr
+	}
+
+	if status != "ready" || dirErr != "" {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{
+			Code:    503,
+			Message: "服务未就绪",
+			Data:    data,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "ready",
+		Data:    data,
+	})
+}
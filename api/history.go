@@ -0,0 +1,392 @@
+package api
+
+import (
+	"PaiDownloader/download"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultHistoryPageSize = 20  // 历史记录默认每页条数
+	maxHistoryPageSize     = 200 // 历史记录每页条数上限
+)
+
+// HistoryQuery 历史记录的分页与筛选条件
+type HistoryQuery struct {
+	Page   int             // 页码，从 1 开始
+	Size   int             // 每页条数
+	Status string          // 任务状态
+	From   time.Time       // 开始时间不早于该时间
+	To     time.Time       // 开始时间不晚于该时间
+	Search string          // URL 包含的子串(不区分大小写)
+	Types  map[string]bool // 任务包含的文件类型
+}
+
+// HistoryPage 分页后的历史记录
+type HistoryPage struct {
+	Items []DownloadHistory `json:"items"`
+	Total int               `json:"total"`
+	Page  int               `json:"page"`
+	Size  int               `json:"size"`
+}
+
+// parseHistoryQuery 解析查询参数 page、size、status、from、to、q、type
+func parseHistoryQuery(c *gin.Context) (HistoryQuery, error) {
+	query := HistoryQuery{
+		Page:   1,
+		Size:   defaultHistoryPageSize,
+		Status: c.Query("status"),
+		Search: strings.ToLower(c.Query("q")),
+		Types:  parseTypeFilter(c.Query("type")),
+	}
+
+	if raw := c.Query("page"); raw != "" {
+		page, err := strconv.Atoi(raw)
+		if err != nil || page < 1 {
+			return query, fmt.Errorf("page 无效: %s", raw)
+		}
+		query.Page = page
+	}
+	if raw := c.Query("size"); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < 1 {
+			return query, fmt.Errorf("size 无效: %s", raw)
+		}
+		if size > maxHistoryPageSize {
+			size = maxHistoryPageSize
+		}
+		query.Size = size
+	}
+
+	var err error
+	if query.From, err = parseHistoryTime(c.Query("from"), false); err != nil {
+		return query, fmt.Errorf("from 无效: %v", err)
+	}
+	if query.To, err = parseHistoryTime(c.Query("to"), true); err != nil {
+		return query, fmt.Errorf("to 无效: %v", err)
+	}
+	return query, nil
+}
+
+// parseHistoryTime 解析 RFC3339 时间或 2006-01-02 格式的日期，endOfDay 为 true 时日期取当天结束
+func parseHistoryTime(raw string, endOfDay bool) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", raw, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+// match 判断历史记录是否满足筛选条件
+func (q HistoryQuery) match(history DownloadHistory) bool {
+	if q.Status != "" && history.Status != q.Status {
+		return false
+	}
+	if !q.From.IsZero() && history.StartTime.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && history.StartTime.After(q.To) {
+		return false
+	}
+	if q.Search != "" && !strings.Contains(strings.ToLower(history.URL), q.Search) {
+		return false
+	}
+	// 未指定文件类型的任务下载所有类型
+	if len(q.Types) > 0 && len(history.FileTypes) > 0 {
+		for _, t := range history.FileTypes {
+			if q.Types[strings.ToLower(t)] {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// queryHistory 按条件筛选历史记录，按开始时间倒序分页返回
+func queryHistory(query HistoryQuery) HistoryPage {
+	historyLock.Lock()
+	matched := make([]DownloadHistory, 0)
+	for _, history := range downloadHistory {
+		if query.match(history) {
+			// 列表中不返回每个文件的记录，通过 GET /history/:id 获取
+			history.Files = nil
+			matched = append(matched, history)
+		}
+	}
+	historyLock.Unlock()
+
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].StartTime.After(matched[j].StartTime) })
+
+	page := HistoryPage{
+		Items: []DownloadHistory{},
+		Total: len(matched),
+		Page:  query.Page,
+		Size:  query.Size,
+	}
+	start := (query.Page - 1) * query.Size
+	if start < len(matched) {
+		end := start + query.Size
+		if end > len(matched) {
+			end = len(matched)
+		}
+		page.Items = matched[start:end]
+	}
+	return page
+}
+
+// deleteHistory 删除任务的历史记录，deleteFiles 为 true 时同时删除任务下载的文件
+// 其他历史记录仍引用的文件(如重新运行或跳过已存在文件的任务)会保留
+// 返回删除的文件数；任务仍在进行时返回错误
+func deleteHistory(historyID string, deleteFiles bool) (int, error) {
+	history, ok := findHistory(historyID)
+	if !ok {
+		return 0, download.ErrJobNotFound
+	}
+	if job, ok := jobs.Get(historyID); ok {
+		if status := job.Status(); status == download.JobStatusRunning || status == download.JobStatusPaused {
+			return 0, fmt.Errorf("任务仍在进行中，请先取消")
+		}
+	}
+
+	removed := 0
+	if deleteFiles {
+		shared := referencedFiles(historyID)
+		for _, file := range jobFiles(history) {
+			path := localFilePath(history.OutputDir, file.Path)
+			if shared[path] {
+				continue
+			}
+			if err := os.Remove(path); err == nil {
+				removed++
+			}
+		}
+		os.RemoveAll(download.JobManifestDir(history.OutputDir, history.ID))
+	}
+
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	for i := range downloadHistory {
+		if downloadHistory[i].ID == historyID {
+			downloadHistory = append(downloadHistory[:i], downloadHistory[i+1:]...)
+			break
+		}
+	}
+	forgetJobRequest(historyID)
+	return removed, saveDownloadHistory()
+}
+
+// referencedFiles 返回除 excludeID 外其他历史记录引用的本地文件路径
+func referencedFiles(excludeID string) map[string]bool {
+	historyLock.Lock()
+	others := make([]DownloadHistory, 0, len(downloadHistory))
+	for _, history := range downloadHistory {
+		if history.ID != excludeID {
+			history.Files = append([]download.DownloadHistoryEntry(nil), history.Files...)
+			others = append(others, history)
+		}
+	}
+	historyLock.Unlock()
+
+	// 读取 manifest.json 可能较慢，不持有历史记录锁
+	paths := make(map[string]bool)
+	for _, history := range others {
+		for _, file := range jobFiles(history) {
+			paths[localFilePath(history.OutputDir, file.Path)] = true
+		}
+	}
+	return paths
+}
+
+// localFilePath 返回文件在本地的绝对路径，不同写法的下载目录指向同一文件时路径相同
+func localFilePath(outputDir, relPath string) string {
+	path := filepath.Join(outputDir, filepath.FromSlash(relPath))
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// jobFiles 返回任务保存在本地的文件，没有文件记录的任务回退到任务的 manifest.json
+func jobFiles(history DownloadHistory) []download.ManifestFile {
+	var files []download.ManifestFile
+	for _, entry := range history.Files {
+		if entry.HasFile() {
+			files = append(files, manifestFileFromEntry(entry))
+		}
+	}
+	if len(files) == 0 {
+		if manifest, err := download.ReadJobManifest(history.OutputDir, history.ID); err == nil {
+			files = manifest.Files
+		}
+	}
+	return files
+}
+
+// HandleGetHistoryDetail 返回单个任务的历史记录，包含每个文件的下载结果
+func HandleGetHistoryDetail(c *gin.Context) {
+	history, ok := findHistory(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Code:    404,
+			Message: "任务不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "Success",
+		Data:    history,
+	})
+}
+
+// HandleDeleteHistory 删除单条历史记录，delete_files=true 时同时删除下载的文件
+func HandleDeleteHistory(c *gin.Context) {
+	removed, err := deleteHistory(c.Param("id"), c.Query("delete_files") == "true")
+	if err == download.ErrJobNotFound {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Code:    404,
+			Message: "任务不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, APIResponse{
+			Code:    409,
+			Message: "删除历史记录失败",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "历史记录已删除",
+		Data: map[string]interface{}{
+			"deleted_files": removed,
+		},
+	})
+}
+
+// HandleBatchDeleteHistory 批量删除历史记录，返回每条记录的删除结果
+func HandleBatchDeleteHistory(c *gin.Context) {
+	var request struct {
+		IDs         []string `json:"ids" binding:"required"`
+		DeleteFiles bool     `json:"delete_files"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:    400,
+			Message: "无效的请求参数",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	deleted := make([]string, 0, len(request.IDs))
+	failed := make(map[string]string)
+	removed := 0
+	for _, id := range request.IDs {
+		n, err := deleteHistory(id, request.DeleteFiles)
+		if err != nil {
+			failed[id] = err.Error()
+			continue
+		}
+		deleted = append(deleted, id)
+		removed += n
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "Success",
+		Data: map[string]interface{}{
+			"deleted":       deleted,
+			"failed":        failed,
+			"deleted_files": removed,
+		},
+	})
+}
+
+// HandleRerunHistory 以历史记录保存的原始参数启动一个新任务
+func HandleRerunHistory(c *gin.Context) {
+	history, ok := findHistory(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Code:    404,
+			Message: "任务不存在",
+		})
+		return
+	}
+
+	// 早期的历史记录没有保存完整请求，按记录中的字段还原
+	request := DownloadRequest{
+		URL:       history.URL,
+		FileTypes: history.FileTypes,
+		OutputDir: history.OutputDir,
+	}
+	if original, ok := jobRequest(history.ID); ok {
+		request = original
+	} else if history.Request != nil {
+		request = *history.Request
+	}
+	request.ScheduleID = ""
+	// 历史记录中只保存了隐藏敏感值后的参数，完整参数在任务结束后不再保留
+	if hasRedacted(request) {
+		c.JSON(http.StatusConflict, APIResponse{
+			Code:    409,
+			Message: "原任务已结束，Webhook 签名密钥与请求头不再保存，无法按原参数重新运行，请重新创建任务",
+		})
+		return
+	}
+
+	newHistory, jobErr := startDownloadJob(request)
+	if jobErr != nil {
+		var data interface{}
+		if jobErr.Err != nil {
+			data = jobErr.Err.Error()
+		}
+		c.JSON(jobErr.Status, APIResponse{
+			Code:    jobErr.Status,
+			Message: jobErr.Message,
+			Data:    data,
+		})
+		return
+	}
+	if newHistory == nil {
+		c.JSON(http.StatusOK, APIResponse{
+			Code:    200,
+			Message: "未找到可下载的资源",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "下载任务已开始",
+		Data: map[string]interface{}{
+			"job_id":      newHistory.ID,
+			"history_id":  newHistory.ID,
+			"rerun_of":    history.ID,
+			"total_tasks": newHistory.Total,
+			"started_at":  newHistory.StartTime.Format(time.RFC3339),
+		},
+	})
+}
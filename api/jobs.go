@@ -0,0 +1,249 @@
+package api
+
+import (
+	"PaiDownloader/download"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var jobsJournalPath = "jobs.journal" // 任务日志文件的路径
+
+// HandleListJobs 返回所有下载任务的概要信息
+func HandleListJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "Success",
+		Data:    jobs.List(),
+	})
+}
+
+// HandleGetJob 返回指定下载任务的概要信息与每个文件的状态
+func HandleGetJob(c *gin.Context) {
+	job, ok := jobs.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Code:    404,
+			Message: "任务不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "Success",
+		Data: map[string]interface{}{
+			"job":      job.Summary(),
+			"progress": job.Snapshot(),
+		},
+	})
+}
+
+// cancelJob 取消任务并更新历史记录；没有进行中的文件时立即结束任务
+func cancelJob(id string, keepPartial bool) (*download.Job, error) {
+	job, err := jobs.Cancel(id, keepPartial)
+	if err != nil {
+		return nil, err
+	}
+	updateJobHistoryStatus(job, "cancelled")
+	finishJobIfDone(job)
+	return job, nil
+}
+
+// pauseJob 暂停任务并更新历史记录
+func pauseJob(id string) (*download.Job, error) {
+	job, err := jobs.Pause(id)
+	if err != nil {
+		return nil, err
+	}
+	updateJobHistoryStatus(job, "paused")
+	return job, nil
+}
+
+// resumeJob 恢复任务并更新历史记录
+func resumeJob(id string) (*download.Job, error) {
+	job, err := jobs.Resume(id)
+	if err != nil {
+		return nil, err
+	}
+	updateJobHistoryStatus(job, "in_progress")
+	return job, nil
+}
+
+// updateJobHistoryStatus 更新任务在历史记录中的状态，任务已结束时不再修改
+func updateJobHistoryStatus(job *download.Job, status string) {
+	updateDownloadHistory(job.ID, func(history *DownloadHistory) {
+		if history.EndTime.IsZero() {
+			history.Status = status
+		}
+	})
+}
+
+// jobControlStatus 返回任务控制操作失败时的状态码
+func jobControlStatus(err error) int {
+	if errors.Is(err, download.ErrJobNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusConflict
+}
+
+// jobControlError 返回任务控制操作失败的响应
+func jobControlError(c *gin.Context, err error) {
+	status := jobControlStatus(err)
+	c.JSON(status, APIResponse{
+		Code:    status,
+		Message: err.Error(),
+	})
+}
+
+// HandlePauseJob 暂停任务，不再分发新文件并挂起进行中的下载
+func HandlePauseJob(c *gin.Context) {
+	job, err := pauseJob(c.Param("id"))
+	if err != nil {
+		jobControlError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "任务已暂停",
+		Data:    job.Summary(),
+	})
+}
+
+// HandleResumeJob 恢复已暂停的任务
+func HandleResumeJob(c *gin.Context) {
+	job, err := resumeJob(c.Param("id"))
+	if err != nil {
+		jobControlError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "任务已恢复",
+		Data:    job.Summary(),
+	})
+}
+
+// HandleCancelJob 取消任务，keep_partial=true 时保留临时文件供以后续传
+func HandleCancelJob(c *gin.Context) {
+	job, err := cancelJob(c.Param("id"), c.Query("keep_partial") == "true")
+	if err != nil {
+		jobControlError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "任务已取消",
+		Data:    job.Summary(),
+	})
+}
+
+// RestoreJobs 打开任务日志并恢复重启前未完成的任务，startPaused 为 true 时以暂停状态恢复
+func RestoreJobs(startPaused bool) {
+	journal, pending, err := download.OpenJournal(jobsJournalPath)
+	if err != nil {
+		logger.Error("打开任务日志失败", "error", err)
+		return
+	}
+	jobs.SetJournal(journal)
+
+	for _, entry := range pending {
+		spec := entry.Spec
+
+		var request DownloadRequest
+		if err := json.Unmarshal(spec.Request, &request); err != nil {
+			abandonJob(journal, spec.ID, fmt.Sprintf("解析任务参数失败: %v", err))
+			continue
+		}
+		d, jobErr := buildJobDownloader(request)
+		if jobErr != nil {
+			abandonJob(journal, spec.ID, jobErr.Error())
+			continue
+		}
+
+		tasks := make([]download.DownloadTask, len(spec.Tasks))
+		for i, t := range spec.Tasks {
+			tasks[i] = download.DownloadTask{URL: t.URL, Type: t.Type, Filename: t.Filename}
+		}
+
+		// 任务日志中保存了完整的请求参数，历史记录中只保存隐藏了敏感值的副本
+		rememberJobRequest(spec.ID, request)
+		redacted := redactRequest(request)
+
+		// 历史记录在任务创建时已保存，缺失时按任务日志重建
+		history, ok := findHistory(spec.ID)
+		if !ok {
+			history = DownloadHistory{
+				ID:        spec.ID,
+				URL:       spec.URL,
+				FileTypes: request.FileTypes,
+				OutputDir: d.OutputDir,
+				Request:   &redacted,
+				StartTime: spec.CreatedAt,
+				Total:     len(tasks),
+				Status:    "in_progress",
+			}
+			addDownloadHistory(history)
+		}
+
+		// 日志中已结束但未写入历史记录的文件(进程恰好在两次写入之间退出)按日志补录
+		recorded := make(map[string]bool, len(history.Files))
+		for _, file := range history.Files {
+			recorded[file.URL] = true
+		}
+		for _, t := range tasks {
+			if status, done := entry.Done[t.URL]; done && !recorded[t.URL] {
+				recordJobFile(spec.ID, download.DownloadHistoryEntry{
+					URL:       t.URL,
+					Filename:  t.Filename,
+					Type:      t.Type,
+					Status:    status,
+					HistoryID: spec.ID,
+				})
+			}
+		}
+		if request.BandwidthLimit > 0 {
+			download.Bandwidth.SetJobLimit(spec.ID, request.BandwidthLimit)
+		}
+
+		job := &download.Job{
+			ID:         spec.ID,
+			URL:        spec.URL,
+			Downloader: d,
+			Request:    spec.Request,
+			CreatedAt:  spec.CreatedAt,
+		}
+		paused := startPaused || entry.Paused
+		jobs.Restore(job, tasks, entry.Done, paused)
+
+		status := "in_progress"
+		if paused {
+			status = "paused"
+		}
+		updateJobHistoryStatus(job, status)
+		finishJobIfDone(job)
+		job.Downloader.Logger.Info("已恢复任务", "done", len(entry.Done), "total", len(tasks), "paused", paused)
+	}
+}
+
+// abandonJob 放弃无法恢复的任务：从任务日志中移除，并将历史记录标记为失败、记录原因
+func abandonJob(journal *download.Journal, id, reason string) {
+	logger.Error("恢复任务失败", "job_id", id, "error", reason)
+	if err := journal.Append(download.JournalRecord{Op: download.JournalJobCancelled, JobID: id}); err != nil {
+		logger.Error("写入任务日志失败", "job_id", id, "error", err)
+	}
+	updateDownloadHistory(id, func(history *DownloadHistory) {
+		if history.EndTime.IsZero() {
+			history.Status = "failed"
+			history.EndTime = time.Now()
+			history.Error = "服务重启后无法恢复任务: " + reason
+		}
+	})
+}
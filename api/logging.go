@@ -0,0 +1,102 @@
+package api
+
+import (
+	"PaiDownloader/config"
+	"PaiDownloader/download"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	logCloser     io.Closer  // 当前日志文件，只输出到标准输出时为 nil
+	logCloserLock sync.Mutex // 保护 logCloser
+)
+
+// ConfigureLogging 按配置设置日志级别与输出位置，原日志文件在切换后关闭
+func ConfigureLogging(config download.LoggerConfig) error {
+	output, err := openLogOutput(config)
+	if err != nil {
+		return err
+	}
+	output.apply()
+	return nil
+}
+
+// logOutput 按配置解析的日志级别与打开的输出位置，调用 apply 后生效
+type logOutput struct {
+	level  download.LogLevel
+	writer io.Writer
+	closer io.Closer
+}
+
+// openLogOutput 解析日志级别并打开输出位置，不修改当前生效的日志配置，返回出错配置项的 *config.FieldError
+func openLogOutput(logConfig download.LoggerConfig) (*logOutput, error) {
+	level, err := download.ParseLogLevel(logConfig.Level)
+	if err != nil {
+		return nil, &config.FieldError{Field: "log.level", Reason: err.Error()}
+	}
+	writer, closer, err := download.OpenLogOutput(logConfig)
+	if err != nil {
+		return nil, &config.FieldError{Field: "log.file", Reason: err.Error()}
+	}
+	return &logOutput{level: level, writer: writer, closer: closer}, nil
+}
+
+// apply 切换到新的日志级别与输出位置，原日志文件在切换后关闭
+func (o *logOutput) apply() {
+	logger.SetOutput(o.writer)
+	logger.SetLevel(o.level)
+
+	logCloserLock.Lock()
+	previous := logCloser
+	logCloser = o.closer
+	logCloserLock.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+}
+
+// HandleGetLogLevel 返回当前的日志级别
+func HandleGetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "Success",
+		Data:    gin.H{"level": logger.Level().String()},
+	})
+}
+
+// HandleSetLogLevel 在运行时调整日志级别，对所有任务立即生效
+func HandleSetLogLevel(c *gin.Context) {
+	var request struct {
+		Level string `json:"level" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:    400,
+			Message: "无效的请求参数",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	level, err := download.ParseLogLevel(request.Level)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:    400,
+			Message: "无效的日志级别",
+			Data:    err.Error(),
+		})
+		return
+	}
+	logger.SetLevel(level)
+	logger.Info("日志级别已调整", "level", level.String())
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "日志级别已更新",
+		Data:    gin.H{"level": level.String()},
+	})
+}
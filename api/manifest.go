@@ -0,0 +1,128 @@
+package api
+
+import (
+	"PaiDownloader/download"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// findHistory 根据 ID 查找任务历史记录，返回副本
+func findHistory(historyID string) (DownloadHistory, bool) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	for _, history := range downloadHistory {
+		if history.ID == historyID {
+			history.Files = append([]download.DownloadHistoryEntry(nil), history.Files...)
+			return history, true
+		}
+	}
+	return DownloadHistory{}, false
+}
+
+// jobFileEntries 返回指定任务下每个文件的下载记录
+func jobFileEntries(historyID string) []download.DownloadHistoryEntry {
+	history, _ := findHistory(historyID)
+	return history.Files
+}
+
+// manifestFileFromEntry 将单个文件的下载记录转换为清单条目
+func manifestFileFromEntry(entry download.DownloadHistoryEntry) download.ManifestFile {
+	return download.ManifestFile{
+		Path:      path.Join(entry.Type, entry.Filename),
+		URL:       entry.URL,
+		Type:      entry.Type,
+		Size:      entry.Size,
+		Checksums: entry.Checksums,
+	}
+}
+
+// finishJobIfDone 在任务的所有文件均结束后写出 manifest.json 与 SHA256SUMS，并保存资源缓存
+func finishJobIfDone(running *download.Job) {
+	historyID := running.ID
+	job, ok := findHistory(historyID)
+	if !ok {
+		return
+	}
+
+	entries := job.Files
+	if len(entries) < job.Total {
+		return
+	}
+
+	// 多个工作协程可能同时观察到任务结束，只写出一次
+	if !running.MarkFinalized() {
+		return
+	}
+
+	download.Bandwidth.RemoveJob(historyID)
+	if err := download.ResourceCacheFor(job.OutputDir).Save(); err != nil {
+		logger.Error("保存资源缓存失败", "job_id", historyID, "error", err)
+	}
+
+	manifest := download.Manifest{
+		JobID:     job.ID,
+		SourceURL: job.URL,
+		CreatedAt: time.Now(),
+	}
+	for _, entry := range entries {
+		if entry.HasFile() {
+			manifest.Files = append(manifest.Files, manifestFileFromEntry(entry))
+		}
+	}
+
+	if err := download.WriteJobManifest(job.OutputDir, manifest); err != nil {
+		logger.Error("写入任务清单失败", "job_id", historyID, "error", err)
+	}
+
+	notifyJobFinished(historyID)
+	// 任务级 Webhook 已投递，不再保留签名密钥与请求头
+	forgetJobRequest(historyID)
+}
+
+// HandleVerifyRequest 重新计算任务文件的校验值，报告缺失或被修改的文件
+func HandleVerifyRequest(c *gin.Context) {
+	historyID := c.Param("id")
+
+	job, ok := findHistory(historyID)
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Code:    404,
+			Message: "任务不存在",
+		})
+		return
+	}
+
+	// 优先使用内存中的文件记录，没有文件记录时回退到任务的 manifest.json
+	var files []download.ManifestFile
+	for _, entry := range jobFileEntries(historyID) {
+		if entry.HasFile() {
+			files = append(files, manifestFileFromEntry(entry))
+		}
+	}
+	if len(files) == 0 {
+		manifest, err := download.ReadJobManifest(job.OutputDir, job.ID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Code:    404,
+				Message: "未找到任务的校验记录",
+			})
+			return
+		}
+		files = manifest.Files
+	}
+
+	result := download.VerifyFiles(job.OutputDir, files)
+	message := "校验通过"
+	if len(result.Missing) > 0 || len(result.Modified) > 0 {
+		message = "校验发现异常文件"
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: message,
+		Data:    result,
+	})
+}
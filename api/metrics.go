@@ -0,0 +1,52 @@
+package api
+
+import (
+	"PaiDownloader/download"
+	"PaiDownloader/metrics"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jobStates 任务状态指标中始终输出的状态，数量为 0 时也输出便于告警规则计算
+var jobStates = []string{
+	download.JobStatusRunning,
+	download.JobStatusPaused,
+	download.JobStatusCancelled,
+	download.JobStatusFinished,
+}
+
+// 任务与工作协程池的 Prometheus 指标，在采集时计算
+var (
+	jobsByState = metrics.NewGaugeFunc("paidownloader_jobs", "按状态统计的内存中的任务数",
+		[]string{"state"}, func() []metrics.Sample {
+			counts := make(map[string]int)
+			for _, summary := range jobs.List() {
+				counts[summary.Status]++
+			}
+			samples := make([]metrics.Sample, 0, len(jobStates))
+			for _, state := range jobStates {
+				samples = append(samples, metrics.Sample{LabelValues: []string{state}, Value: float64(counts[state])})
+			}
+			return samples
+		})
+	workerPoolSize = metrics.NewGaugeFunc("paidownloader_workers", "共享工作协程池的大小",
+		nil, func() []metrics.Sample {
+			total, _ := jobs.Workers()
+			return []metrics.Sample{{Value: float64(total)}}
+		})
+	workersBusy = metrics.NewGaugeFunc("paidownloader_workers_busy", "正在下载文件的工作协程数",
+		nil, func() []metrics.Sample {
+			_, busy := jobs.Workers()
+			return []metrics.Sample{{Value: float64(busy)}}
+		})
+)
+
+// HandleMetrics 以 Prometheus 文本格式输出监控指标
+func HandleMetrics(c *gin.Context) {
+	c.Header("Content-Type", metrics.ContentType)
+	c.Status(http.StatusOK)
+	if err := metrics.WriteText(c.Writer); err != nil {
+		logger.Error("输出监控指标失败", "error", err)
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"PaiDownloader/webhook"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// redactedValue 替换 Webhook 签名密钥与请求头取值后的占位符，历史记录、接口响应与导出中只出现占位符
+const redactedValue = "******"
+
+// jobRequests 保存未结束任务的完整请求参数(含签名密钥与请求头)，只保存在内存中，供投递任务级 Webhook 与重新运行使用
+// 任务结束或取消后立即删除；历史记录中的请求参数已隐藏敏感值，服务重启后未完成的任务从任务日志中恢复完整参数
+var (
+	jobRequests     = make(map[string]DownloadRequest)
+	jobRequestsLock sync.Mutex
+)
+
+// rememberJobRequest 保存任务的完整请求参数
+func rememberJobRequest(historyID string, request DownloadRequest) {
+	jobRequestsLock.Lock()
+	defer jobRequestsLock.Unlock()
+	jobRequests[historyID] = request
+}
+
+// jobRequest 返回任务的完整请求参数，已结束的任务没有保存
+func jobRequest(historyID string) (DownloadRequest, bool) {
+	jobRequestsLock.Lock()
+	defer jobRequestsLock.Unlock()
+	request, ok := jobRequests[historyID]
+	return request, ok
+}
+
+// forgetJobRequest 删除任务的完整请求参数
+func forgetJobRequest(historyID string) {
+	jobRequestsLock.Lock()
+	defer jobRequestsLock.Unlock()
+	delete(jobRequests, historyID)
+}
+
+// redactRequest 返回隐藏了 Webhook 签名密钥与请求头取值的请求参数副本，用于写入历史记录
+// 请求头常用于携带 Cookie、Authorization 与各类 API 密钥，无法逐一识别，所有取值一律隐藏
+func redactRequest(request DownloadRequest) DownloadRequest {
+	request.Webhooks = redactEndpoints(request.Webhooks)
+	request.Headers = redactHeaders(request.Headers)
+	return request
+}
+
+// redactHeaders 返回将取值替换为占位符的请求头副本，保留请求头名称
+func redactHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return headers
+	}
+	redacted := make(map[string]string, len(headers))
+	for name := range headers {
+		redacted[name] = redactedValue
+	}
+	return redacted
+}
+
+// redactEndpoints 返回将签名密钥替换为占位符的接收地址副本
+func redactEndpoints(endpoints []webhook.Endpoint) []webhook.Endpoint {
+	if len(endpoints) == 0 {
+		return endpoints
+	}
+	redacted := make([]webhook.Endpoint, len(endpoints))
+	for i, endpoint := range endpoints {
+		if endpoint.Secret != "" {
+			endpoint.Secret = redactedValue
+		}
+		redacted[i] = endpoint
+	}
+	return redacted
+}
+
+// hasRedacted 判断请求参数中是否有已被替换为占位符、无法还原的敏感值
+func hasRedacted(request DownloadRequest) bool {
+	for _, endpoint := range request.Webhooks {
+		if endpoint.Secret == redactedValue {
+			return true
+		}
+	}
+	for _, value := range request.Headers {
+		if value == redactedValue {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreRedacted 将 request 中的占位符还原为 original 中同一接收地址的签名密钥与同名请求头的取值，无法还原的占位符保留
+// 用于客户端将查询到的定时任务修改后提交的情况
+func restoreRedacted(request *DownloadRequest, original DownloadRequest) {
+	secrets := make(map[string]string, len(original.Webhooks))
+	for _, endpoint := range original.Webhooks {
+		secrets[endpoint.URL] = endpoint.Secret
+	}
+	for i := range request.Webhooks {
+		secret, ok := secrets[request.Webhooks[i].URL]
+		if request.Webhooks[i].Secret == redactedValue && ok {
+			request.Webhooks[i].Secret = secret
+		}
+	}
+
+	// 请求头名称不区分大小写
+	values := make(map[string]string, len(original.Headers))
+	for name, value := range original.Headers {
+		values[http.CanonicalHeaderKey(name)] = value
+	}
+	for name, value := range request.Headers {
+		previous, ok := values[http.CanonicalHeaderKey(name)]
+		if value == redactedValue && ok {
+			request.Headers[name] = previous
+		}
+	}
+}
+
+// redactRequestJSON 隐藏 JSON 格式请求参数中的敏感值，保留其余字段的原样
+// 无法解析时原样返回，由调用方校验
+func redactRequestJSON(raw json.RawMessage) json.RawMessage {
+	return rewriteRequestJSON(raw, func(request *DownloadRequest) {
+		request.Webhooks = redactEndpoints(request.Webhooks)
+		request.Headers = redactHeaders(request.Headers)
+	})
+}
+
+// restoreRequestJSON 将 JSON 格式请求参数中的占位符还原为 original 中的取值
+func restoreRequestJSON(raw, original json.RawMessage) json.RawMessage {
+	var previous DownloadRequest
+	if err := json.Unmarshal(original, &previous); err != nil {
+		return raw
+	}
+	return rewriteRequestJSON(raw, func(request *DownloadRequest) {
+		restoreRedacted(request, previous)
+	})
+}
+
+// rewriteRequestJSON 按 rewrite 修改 JSON 格式请求参数中的敏感字段，其余字段保持原样
+func rewriteRequestJSON(raw json.RawMessage, rewrite func(request *DownloadRequest)) json.RawMessage {
+	var fields map[string]json.RawMessage
+	var request DownloadRequest
+	if json.Unmarshal(raw, &fields) != nil || json.Unmarshal(raw, &request) != nil {
+		return raw
+	}
+	rewrite(&request)
+
+	if _, ok := fields["webhooks"]; ok {
+		fields["webhooks"], _ = json.Marshal(request.Webhooks)
+	}
+	if _, ok := fields["headers"]; ok {
+		fields["headers"], _ = json.Marshal(request.Headers)
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return raw
+	}
+	return data
+}
@@ -0,0 +1,314 @@
+package api
+
+import (
+	"PaiDownloader/webhook"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRedactRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request DownloadRequest
+		want    DownloadRequest
+	}{
+		{
+			name:    "没有敏感值",
+			request: DownloadRequest{URL: "https://example.com"},
+			want:    DownloadRequest{URL: "https://example.com"},
+		},
+		{
+			name: "请求头取值",
+			request: DownloadRequest{URL: "https://example.com", HTTPOptions: HTTPOptions{
+				Headers: map[string]string{"Authorization": "Bearer token", "Cookie": "sid=1"},
+			}},
+			want: DownloadRequest{URL: "https://example.com", HTTPOptions: HTTPOptions{
+				Headers: map[string]string{"Authorization": redactedValue, "Cookie": redactedValue},
+			}},
+		},
+		{
+			name: "签名密钥",
+			request: DownloadRequest{URL: "https://example.com", Webhooks: []webhook.Endpoint{
+				{URL: "https://hooks.example.com/a", Secret: "secret"},
+				{URL: "https://hooks.example.com/b"},
+			}},
+			want: DownloadRequest{URL: "https://example.com", Webhooks: []webhook.Endpoint{
+				{URL: "https://hooks.example.com/a", Secret: redactedValue},
+				{URL: "https://hooks.example.com/b"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := fmt.Sprintf("%+v", tt.request)
+			got := redactRequest(tt.request)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redactRequest() = %+v，期望 %+v", got, tt.want)
+			}
+			if fmt.Sprintf("%+v", tt.request) != original {
+				t.Errorf("redactRequest 修改了原请求参数: %+v", tt.request)
+			}
+		})
+	}
+}
+
+func TestRestoreRedacted(t *testing.T) {
+	original := DownloadRequest{
+		HTTPOptions: HTTPOptions{Headers: map[string]string{"Authorization": "Bearer token"}},
+		Webhooks:    []webhook.Endpoint{{URL: "https://hooks.example.com/a", Secret: "secret"}},
+	}
+
+	tests := []struct {
+		name         string
+		request      DownloadRequest
+		want         DownloadRequest
+		wantRedacted bool
+	}{
+		{
+			name:    "还原占位符",
+			request: redactRequest(original),
+			want:    original,
+		},
+		{
+			name: "请求头名称不区分大小写",
+			request: DownloadRequest{
+				HTTPOptions: HTTPOptions{Headers: map[string]string{"authorization": redactedValue}},
+			},
+			want: DownloadRequest{
+				HTTPOptions: HTTPOptions{Headers: map[string]string{"authorization": "Bearer token"}},
+			},
+		},
+		{
+			name: "保留新的取值",
+			request: DownloadRequest{
+				HTTPOptions: HTTPOptions{Headers: map[string]string{"Authorization": "Bearer other"}},
+				Webhooks:    []webhook.Endpoint{{URL: "https://hooks.example.com/a", Secret: "other"}},
+			},
+			want: DownloadRequest{
+				HTTPOptions: HTTPOptions{Headers: map[string]string{"Authorization": "Bearer other"}},
+				Webhooks:    []webhook.Endpoint{{URL: "https://hooks.example.com/a", Secret: "other"}},
+			},
+		},
+		{
+			name: "无法还原的占位符保留",
+			request: DownloadRequest{
+				HTTPOptions: HTTPOptions{Headers: map[string]string{"Cookie": redactedValue}},
+				Webhooks:    []webhook.Endpoint{{URL: "https://hooks.example.com/b", Secret: redactedValue}},
+			},
+			want: DownloadRequest{
+				HTTPOptions: HTTPOptions{Headers: map[string]string{"Cookie": redactedValue}},
+				Webhooks:    []webhook.Endpoint{{URL: "https://hooks.example.com/b", Secret: redactedValue}},
+			},
+			wantRedacted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restoreRedacted(&tt.request, original)
+			if !reflect.DeepEqual(tt.request, tt.want) {
+				t.Errorf("restoreRedacted() = %+v，期望 %+v", tt.request, tt.want)
+			}
+			if got := hasRedacted(tt.request); got != tt.wantRedacted {
+				t.Errorf("hasRedacted() = %v，期望 %v", got, tt.wantRedacted)
+			}
+		})
+	}
+}
+
+func TestRedactRequestJSONKeepsOtherFields(t *testing.T) {
+	raw := json.RawMessage(`{"url":"https://example.com","headers":{"Cookie":"sid=1"},"webhooks":[{"url":"https://hooks.example.com","secret":"s"}],"future_field":1}`)
+	redacted := redactRequestJSON(raw)
+	if bytes.Contains(redacted, []byte("sid=1")) || bytes.Contains(redacted, []byte(`"secret":"s"`)) {
+		t.Errorf("隐藏后仍包含敏感值: %s", redacted)
+	}
+	if !bytes.Contains(redacted, []byte(`"future_field":1`)) {
+		t.Errorf("隐藏时丢失了其他字段: %s", redacted)
+	}
+
+	restored := restoreRequestJSON(redacted, raw)
+	var got, want map[string]interface{}
+	json.Unmarshal(restored, &got)
+	json.Unmarshal(raw, &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("restoreRequestJSON() = %s，期望 %s", restored, raw)
+	}
+}
+
+// TestJobSecretsNotExposed 以带请求头与签名密钥的请求运行一个任务，检查历史记录文件、接口与导出中都不包含敏感值
+func TestJobSecretsNotExposed(t *testing.T) {
+	const (
+		token  = "Bearer header-value-1f3a"
+		secret = "webhook-secret-9c2e"
+	)
+
+	var receivedLock sync.Mutex
+	var received []string // 网页与资源请求收到的 Authorization
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			receivedLock.Lock()
+			received = append(received, r.Header.Get("Authorization"))
+			receivedLock.Unlock()
+			fmt.Fprint(w, `<html><body><img src="/a.png"></body></html>`)
+		case "/a.png":
+			receivedLock.Lock()
+			received = append(received, r.Header.Get("Authorization"))
+			receivedLock.Unlock()
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG\r\n\x1a\n"))
+		case "/hook":
+			io.Copy(io.Discard, r.Body)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	useTestState(t)
+
+	router := gin.New()
+	router.POST("/download", HandleDownloadRequest)
+	router.POST("/history", HandleGetHistory)
+	router.GET("/history/export", HandleExportHistory)
+	router.GET("/history/:id", HandleGetHistoryDetail)
+	router.GET("/history/:id/export", HandleExportJob)
+
+	body, _ := json.Marshal(DownloadRequest{
+		URL:         server.URL + "/",
+		FileTypes:   []string{"image"},
+		HTTPOptions: HTTPOptions{Headers: map[string]string{"Authorization": token}},
+		Webhooks:    []webhook.Endpoint{{URL: server.URL + "/hook", Secret: secret}},
+	})
+	response := serve(router, http.MethodPost, "/download", body)
+	if response.Code != http.StatusOK {
+		t.Fatalf("POST /download 返回 %d: %s", response.Code, response.Body)
+	}
+	var created struct {
+		Data struct {
+			HistoryID string `json:"history_id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &created); err != nil || created.Data.HistoryID == "" {
+		t.Fatalf("无法解析创建任务的响应: %s", response.Body)
+	}
+	id := created.Data.HistoryID
+
+	waitFor(t, "任务未在 10 秒内结束", func() bool {
+		history, _ := findHistory(id)
+		return !history.EndTime.IsZero()
+	})
+	waitFor(t, "任务结束后仍保留完整请求参数", func() bool {
+		_, ok := jobRequest(id)
+		return !ok
+	})
+	receivedLock.Lock()
+	defer receivedLock.Unlock()
+	if len(received) != 2 {
+		t.Errorf("服务器收到 %d 次请求，期望网页与资源各一次", len(received))
+	}
+	for _, value := range received {
+		if value != token {
+			t.Errorf("服务器收到的 Authorization 为 %q，期望 %q", value, token)
+		}
+	}
+
+	flushDownloadHistory()
+	historyFile, err := os.ReadFile(historyFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response = serve(router, http.MethodPost, "/history", nil)
+	if response.Code != http.StatusOK || !bytes.Contains(response.Body.Bytes(), []byte(id)) {
+		t.Errorf("POST /history 返回 %d: %s", response.Code, response.Body)
+	}
+	outputs := map[string][]byte{historyFilePath: historyFile, "/history": response.Body.Bytes()}
+	for _, path := range []string{
+		"/history/" + id,
+		"/history/export?format=csv",
+		"/history/export?format=jsonl",
+		"/history/export?format=html",
+		"/history/" + id + "/export?format=csv",
+		"/history/" + id + "/export?format=jsonl",
+		"/history/" + id + "/export?format=html",
+	} {
+		response := serve(router, http.MethodGet, path, nil)
+		if response.Code != http.StatusOK {
+			t.Errorf("GET %s 返回 %d", path, response.Code)
+		}
+		outputs[path] = response.Body.Bytes()
+	}
+
+	for source, output := range outputs {
+		for _, value := range []string{token, secret} {
+			if bytes.Contains(output, []byte(value)) {
+				t.Errorf("%s 中包含敏感值 %q", source, value)
+			}
+		}
+	}
+	if !bytes.Contains(historyFile, []byte(redactedValue)) {
+		t.Errorf("历史记录文件中没有占位符: %s", historyFile)
+	}
+}
+
+// useTestState 将下载目录、历史记录与投递日志指向临时目录，测试结束后还原
+func useTestState(t *testing.T) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+
+	previousHistoryPath, previousWebhooks := historyFilePath, webhooks
+	historyFilePath = filepath.Join(dir, "download_history.json")
+	webhooks = webhook.NewDispatcher(filepath.Join(dir, "webhook_deliveries.json"))
+	t.Cleanup(func() {
+		webhooks.Flush()
+		historyLock.Lock()
+		historyFilePath, webhooks = previousHistoryPath, previousWebhooks
+		downloadHistory = nil
+		historyLock.Unlock()
+	})
+
+	// 只替换下载器模板，任务管理器的工作协程在包初始化时已启动
+	previous := downloader.Load()
+	template := *previous
+	template.OutputDir = filepath.Join(dir, "download_data")
+	template.RetryTimes = 0
+	downloader.Store(&template)
+	t.Cleanup(func() { downloader.Store(previous) })
+}
+
+// serve 向 router 发送请求并返回响应
+func serve(router *gin.Engine, method, path string, body []byte) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, bytes.NewReader(body))
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// waitFor 等待 done 返回 true，超时后以 message 结束测试
+func waitFor(t *testing.T, message string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal(message)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,339 @@
+package api
+
+import (
+	"PaiDownloader/config"
+	"PaiDownloader/download"
+	"PaiDownloader/middleware"
+	"PaiDownloader/webhook"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// restartRequiredFields 只在启动时读取、修改后需重启服务才能生效的配置项
+var restartRequiredFields = map[string]bool{
+	"server_port":            true,
+	"bind_address":           true,
+	"download_dir":           true,
+	"resume_paused":          true,
+	"shutdown_grace_seconds": true,
+	"config_watch_seconds":   true,
+}
+
+var (
+	configPath   string            // 配置文件路径
+	activeConfig *config.AppConfig // 当前生效的配置，需重启的配置项保持启动时的值
+	reloadLock   sync.Mutex        // 串行执行配置的重新加载
+)
+
+// ReloadResult 重新加载配置的结果
+type ReloadResult struct {
+	Applied         []string  `json:"applied"`          // 已生效的配置项，下载器相关配置对之后开始的任务生效
+	RestartRequired []string  `json:"restart_required"` // 已修改但需重启服务才能生效的配置项
+	ReloadedAt      time.Time `json:"reloaded_at"`
+}
+
+// Configure 按配置设置日志、下载器、限速、主机调度策略与全局 Webhook，并记录配置文件路径供重新加载
+// 需在恢复任务与接受请求之前调用
+func Configure(cfg *config.AppConfig, path string) error {
+	// 日志级别、输出位置与轮转
+	if err := ConfigureLogging(loggerConfig(cfg)); err != nil {
+		return fmt.Errorf("日志配置无效: %w", err)
+	}
+
+	// 下载目录、并发数、重试、超时、User-Agent 与代理
+	d := download.NewResourceDownloader()
+	d.OutputDir = cfg.DownloadDir
+	d.MaxConcurrent = cfg.MaxConcurrent
+	d.RetryTimes = cfg.RetryTimes
+	d.Timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	d.UserAgent = cfg.UserAgent
+	if err := d.SetProxy(cfg.ProxyURL); err != nil {
+		return fmt.Errorf("代理配置无效: %w", err)
+	}
+	if err := ConfigureDownloader(d); err != nil {
+		return err
+	}
+
+	applyBandwidth(cfg, nil)
+	applyHostPolicy(cfg)
+	if err := ConfigureWebhooks(webhookEndpoints(cfg)); err != nil {
+		return fmt.Errorf("Webhook 配置无效: %w", err)
+	}
+
+	configPath = path
+	activeConfig = cfg
+	return nil
+}
+
+// ReloadConfig 重新读取并校验配置文件，立即应用可在运行时修改的配置项
+// 配置无效时返回错误并保持原配置；需重启的配置项只报告，不生效
+func ReloadConfig() (*ReloadResult, error) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	if _, err := os.Stat(configPath); err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := activeConfig
+	result := &ReloadResult{Applied: []string{}, RestartRequired: []string{}, ReloadedAt: time.Now()}
+	changed := make(map[string]bool)
+	for _, field := range diffConfig("", reflect.ValueOf(*previous), reflect.ValueOf(*cfg)) {
+		if restartRequiredFields[field] {
+			result.RestartRequired = append(result.RestartRequired, field)
+			keepField(cfg, previous, field)
+			continue
+		}
+		changed[field] = true
+		result.Applied = append(result.Applied, field)
+	}
+	sort.Strings(result.Applied)
+	sort.Strings(result.RestartRequired)
+
+	// 先校验并准备所有修改的配置项，任一配置项无效时返回该配置项的错误且不修改任何配置
+	var d *download.ResourceDownloader
+	if changed["max_concurrent"] || changed["retry_times"] || changed["timeout_seconds"] ||
+		changed["user_agent"] || changed["proxy_url"] {
+		if d, err = buildDownloader(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if changed["rate_limit"] {
+		if err := middleware.ValidateRateLimit(cfg.RateLimit); err != nil {
+			return nil, &config.FieldError{Field: "rate_limit", Reason: err.Error()}
+		}
+	}
+	var endpoints []webhook.Endpoint
+	if changed["webhooks"] {
+		endpoints = webhookEndpoints(cfg)
+		if err := validateWebhooks(endpoints); err != nil {
+			return nil, err
+		}
+	}
+	// 打开日志文件放在最后，之后的步骤不会失败，无需关闭已打开的文件
+	var output *logOutput
+	if changedPrefix(changed, "log.") {
+		if output, err = openLogOutput(loggerConfig(cfg)); err != nil {
+			return nil, err
+		}
+	}
+
+	// 全部准备完成后依次生效
+	if output != nil {
+		output.apply()
+	}
+	if d != nil {
+		downloader.Store(d)
+		jobs.SetWorkers(d.MaxConcurrent)
+	}
+	if changed["rate_limit"] {
+		middleware.SetRateLimit(cfg.RateLimit) // 格式已校验，不会失败
+	}
+	if changed["bandwidth_limit"] || changed["host_bandwidth_limits"] {
+		applyBandwidth(cfg, previous)
+	}
+	if changed["max_per_host"] || changed["host_delay_ms"] || changed["host_jitter_ms"] || changed["host_overrides"] {
+		applyHostPolicy(cfg)
+	}
+	if changed["webhooks"] {
+		webhooks.SetEndpoints(endpoints)
+	}
+
+	activeConfig = cfg
+	return result, nil
+}
+
+// diffConfig 返回两份配置中取值不同的配置项，嵌套配置项以 . 连接(如 log.level)
+func diffConfig(prefix string, previous, current reflect.Value) []string {
+	var fields []string
+	t := previous.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := prefix + strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if t.Field(i).Type.Kind() == reflect.Struct {
+			fields = append(fields, diffConfig(name+".", previous.Field(i), current.Field(i))...)
+			continue
+		}
+		if !reflect.DeepEqual(previous.Field(i).Interface(), current.Field(i).Interface()) {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// keepField 将需重启的配置项恢复为当前生效的值
+func keepField(cfg, previous *config.AppConfig, field string) {
+	current := reflect.ValueOf(cfg).Elem()
+	t := current.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("json"), ",")[0] == field {
+			current.Field(i).Set(reflect.ValueOf(previous).Elem().Field(i))
+			return
+		}
+	}
+}
+
+// changedPrefix 判断是否有以 prefix 开头的配置项被修改
+func changedPrefix(changed map[string]bool, prefix string) bool {
+	for field := range changed {
+		if strings.HasPrefix(field, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// loggerConfig 将日志配置转换为下载器的日志配置
+func loggerConfig(cfg *config.AppConfig) download.LoggerConfig {
+	return download.LoggerConfig{
+		Level:       cfg.Log.Level,
+		Output:      cfg.Log.Output,
+		File:        cfg.Log.File,
+		MaxSizeMB:   cfg.Log.MaxSizeMB,
+		RotateHours: cfg.Log.RotateHours,
+		MaxAgeDays:  cfg.Log.MaxAgeDays,
+		MaxBackups:  cfg.Log.MaxBackups,
+	}
+}
+
+// buildDownloader 以新的并发数、重试、超时、User-Agent 与代理创建下载器模板的副本，返回出错配置项的 *config.FieldError
+// 生效前不修改当前模板，读取模板的请求不会看到修改了一半的配置；之后开始的任务使用新配置，进行中的任务保持原配置
+func buildDownloader(cfg *config.AppConfig) (*download.ResourceDownloader, error) {
+	d := *downloader.Load()
+	d.MaxConcurrent = cfg.MaxConcurrent
+	d.RetryTimes = cfg.RetryTimes
+	d.Timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	d.UserAgent = cfg.UserAgent
+	// 重建 HTTP 客户端以应用新的连接池与代理
+	if err := d.SetProxy(cfg.ProxyURL); err != nil {
+		return nil, &config.FieldError{Field: "proxy_url", Reason: err.Error()}
+	}
+	return &d, nil
+}
+
+// applyBandwidth 设置全局与按主机的下载限速，previous 中有而 cfg 中没有的主机取消限速
+func applyBandwidth(cfg, previous *config.AppConfig) {
+	download.Bandwidth.SetGlobalLimit(cfg.BandwidthLimit)
+	if previous != nil {
+		for host := range previous.HostBandwidthLimits {
+			if _, ok := cfg.HostBandwidthLimits[host]; !ok {
+				download.Bandwidth.SetHostLimit(host, 0)
+			}
+		}
+	}
+	for host, limit := range cfg.HostBandwidthLimits {
+		download.Bandwidth.SetHostLimit(host, limit)
+	}
+}
+
+// applyHostPolicy 设置按主机的并发与请求间隔
+func applyHostPolicy(cfg *config.AppConfig) {
+	overrides := make(map[string]download.HostPolicy, len(cfg.HostOverrides))
+	for host, o := range cfg.HostOverrides {
+		overrides[host] = download.HostPolicy{
+			MaxConnections: o.MaxConnections,
+			Delay:          time.Duration(o.DelayMs) * time.Millisecond,
+			Jitter:         time.Duration(o.JitterMs) * time.Millisecond,
+		}
+	}
+	download.Scheduler.SetPolicy(download.HostPolicy{
+		MaxConnections: cfg.MaxPerHost,
+		Delay:          time.Duration(cfg.HostDelayMs) * time.Millisecond,
+		Jitter:         time.Duration(cfg.HostJitterMs) * time.Millisecond,
+	}, overrides)
+}
+
+// webhookEndpoints 将配置中的全局 Webhook 转换为接收地址
+func webhookEndpoints(cfg *config.AppConfig) []webhook.Endpoint {
+	endpoints := make([]webhook.Endpoint, 0, len(cfg.Webhooks))
+	for _, w := range cfg.Webhooks {
+		endpoints = append(endpoints, webhook.Endpoint{URL: w.URL, Secret: w.Secret, Events: w.Events})
+	}
+	return endpoints
+}
+
+// StartConfigWatcher 按 config_watch_seconds 轮询配置文件，修改时间或大小变化后自动重新加载
+// 重新加载失败时记录日志并保持原配置，服务关闭时停止
+func StartConfigWatcher() {
+	interval := time.Duration(activeConfig.ConfigWatchSeconds) * time.Second
+	if interval <= 0 {
+		return
+	}
+	lastMod, lastSize := configFileStamp()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-shutdownCh:
+				return
+			case <-ticker.C:
+			}
+
+			mod, size := configFileStamp()
+			if mod.Equal(lastMod) && size == lastSize {
+				continue
+			}
+			lastMod, lastSize = mod, size
+
+			result, err := ReloadConfig()
+			if err != nil {
+				logger.Error("重新加载配置文件失败，保持原配置", "file", configPath, "error", err)
+				continue
+			}
+			logger.Info("配置文件已重新加载", "file", configPath,
+				"applied", result.Applied, "restart_required", result.RestartRequired)
+		}
+	}()
+}
+
+// configFileStamp 返回配置文件的修改时间与大小，文件不存在时返回零值
+func configFileStamp() (time.Time, int64) {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
+
+// HandleReloadConfig 重新加载配置文件，返回已生效与需重启才能生效的配置项
+func HandleReloadConfig(c *gin.Context) {
+	result, err := ReloadConfig()
+	if err != nil {
+		// 配置文件无法读取时为服务端错误，配置内容无效时为请求错误
+		status := http.StatusBadRequest
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, APIResponse{
+			Code:    status,
+			Message: "重新加载配置失败，保持原配置",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	message := "配置已重新加载"
+	if len(result.RestartRequired) > 0 {
+		message = "配置已重新加载，部分配置项需重启服务才能生效"
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: message,
+		Data:    result,
+	})
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"PaiDownloader/schedule"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+var schedulesFilePath = "schedules.json" // 定时任务文件的路径
+
+var schedules = schedule.NewManager(schedulesFilePath, runScheduledJob) // 定时任务管理器
+
+// StartScheduler 加载已保存的定时任务并启动后台调度
+func StartScheduler() {
+	if err := schedules.Load(); err != nil {
+		logger.Error("加载定时任务失败", "error", err)
+	}
+	schedules.Start()
+}
+
+// runScheduledJob 以定时任务保存的请求体启动一次下载任务
+func runScheduledJob(s schedule.Schedule) (string, error) {
+	var request DownloadRequest
+	if err := json.Unmarshal(s.Request, &request); err != nil {
+		return "", fmt.Errorf("解析请求体失败: %v", err)
+	}
+	request.ScheduleID = s.ID
+
+	history, jobErr := startDownloadJob(request)
+	if jobErr != nil {
+		logger.Error("定时任务执行失败", "schedule_id", s.ID, "error", jobErr)
+		return "", jobErr
+	}
+	if history == nil {
+		return "", fmt.Errorf("未找到可下载的资源")
+	}
+	return history.ID, nil
+}
+
+// bindSchedule 绑定定时任务请求体，并检查其中保存的下载请求是否有效
+func bindSchedule(c *gin.Context) (schedule.Schedule, bool) {
+	var s schedule.Schedule
+	if err := c.ShouldBindJSON(&s); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:    400,
+			Message: "无效的请求参数",
+			Data:    err.Error(),
+		})
+		return s, false
+	}
+
+	var request DownloadRequest
+	if err := json.Unmarshal(s.Request, &request); err != nil || request.URL == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:    400,
+			Message: "无效的下载请求",
+		})
+		return s, false
+	}
+	if _, jobErr := validateDownloadRequest(request); jobErr != nil {
+		c.JSON(jobErr.Status, APIResponse{
+			Code:    jobErr.Status,
+			Message: jobErr.Message,
+		})
+		return s, false
+	}
+	return s, true
+}
+
+// redactSchedule 返回隐藏了请求体中敏感值的定时任务副本，用于接口响应；定时任务文件中保存完整请求体以便执行
+func redactSchedule(s schedule.Schedule) schedule.Schedule {
+	s.Request = redactRequestJSON(s.Request)
+	return s
+}
+
+// scheduleNotFound 返回定时任务不存在的响应
+func scheduleNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, APIResponse{
+		Code:    404,
+		Message: "定时任务不存在",
+	})
+}
+
+// HandleListSchedules 返回所有定时任务
+func HandleListSchedules(c *gin.Context) {
+	list := schedules.List()
+	for i := range list {
+		list[i] = redactSchedule(list[i])
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "Success",
+		Data:    list,
+	})
+}
+
+// HandleGetSchedule 返回指定定时任务及其执行记录
+func HandleGetSchedule(c *gin.Context) {
+	s, ok := schedules.Get(c.Param("id"))
+	if !ok {
+		scheduleNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "Success",
+		Data:    redactSchedule(s),
+	})
+}
+
+// HandleCreateSchedule 新建定时任务
+func HandleCreateSchedule(c *gin.Context) {
+	s, ok := bindSchedule(c)
+	if !ok {
+		return
+	}
+
+	created, err := schedules.Create(s)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:    400,
+			Message: "创建定时任务失败",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "定时任务已创建",
+		Data:    redactSchedule(created),
+	})
+}
+
+// HandleUpdateSchedule 修改定时任务，请求体中保留占位符的敏感值沿用原定时任务的取值
+func HandleUpdateSchedule(c *gin.Context) {
+	s, ok := bindSchedule(c)
+	if !ok {
+		return
+	}
+	if existing, found := schedules.Get(c.Param("id")); found {
+		s.Request = restoreRequestJSON(s.Request, existing.Request)
+	}
+	var request DownloadRequest
+	if json.Unmarshal(s.Request, &request) == nil && hasRedacted(request) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:    400,
+			Message: "无效的下载请求",
+			Data:    "无法还原的 Webhook 签名密钥或请求头取值，请重新填写",
+		})
+		return
+	}
+
+	updated, err := schedules.Update(c.Param("id"), s)
+	if os.IsNotExist(err) {
+		scheduleNotFound(c)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:    400,
+			Message: "修改定时任务失败",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "定时任务已修改",
+		Data:    redactSchedule(updated),
+	})
+}
+
+// HandleDeleteSchedule 删除定时任务，已产生的下载历史保留
+func HandleDeleteSchedule(c *gin.Context) {
+	deleted, err := schedules.Delete(c.Param("id"))
+	if !deleted {
+		scheduleNotFound(c)
+		return
+	}
+	if err != nil {
+		logger.Error("保存定时任务失败", "error", err)
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "定时任务已删除",
+	})
+}
+
+// HandleRunSchedule 立即执行一次定时任务
+func HandleRunSchedule(c *gin.Context) {
+	run, err := schedules.Trigger(c.Param("id"))
+	if os.IsNotExist(err) {
+		scheduleNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "定时任务已执行",
+		Data:    run,
+	})
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"PaiDownloader/download"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 服务的生命周期状态
+const (
+	stateStarting     int32 = iota // 正在恢复任务，尚未就绪
+	stateReady                     // 正常接受任务
+	stateShuttingDown              // 正在关闭，不再接受新任务
+)
+
+const shutdownMessage = "服务正在关闭，不再接受新任务" // 关闭期间拒绝新任务的提示
+
+var (
+	serverState  int32                 // 当前的生命周期状态
+	shutdownCh   = make(chan struct{}) // 关闭时关闭该通道，通知 SSE 与 WebSocket 连接结束
+	shutdownOnce sync.Once             // 保证关闭流程只执行一次
+)
+
+// MarkReady 任务恢复与定时任务调度启动后将服务标记为就绪
+func MarkReady() {
+	atomic.CompareAndSwapInt32(&serverState, stateStarting, stateReady)
+}
+
+// shuttingDown 判断服务是否正在关闭
+func shuttingDown() bool {
+	return atomic.LoadInt32(&serverState) == stateShuttingDown
+}
+
+// Shutdown 停止接受新任务与定时任务，等待下载中的文件在 grace 内结束，然后结束所有事件流
+// 返回 false 表示超时时仍有文件在下载，这些文件保留临时文件并在重启后续传
+func Shutdown(grace time.Duration) bool {
+	drained := true
+	shutdownOnce.Do(func() {
+		atomic.StoreInt32(&serverState, stateShuttingDown)
+		logger.Info("开始关闭服务", "grace_period", grace.String())
+
+		schedules.Stop()
+		_, busy := jobs.Workers()
+		logger.Info("等待下载中的文件结束", "downloading", busy, "queued", download.Scheduler.Pending())
+		if drained = jobs.Drain(grace); !drained {
+			_, busy = jobs.Workers()
+			logger.Warn("等待超时，未完成的文件将在重启后续传", "downloading", busy)
+		}
+
+		close(shutdownCh)
+		waitStreams(wsWriteTimeout)
+	})
+	return drained
+}
+
+// PersistState 保存历史记录与 Webhook 投递日志并关闭任务日志，应在 HTTP 服务关闭后调用
+// 尚未开始的文件已记录在任务日志中，重启后恢复
+func PersistState() {
+	historyLock.Lock()
+	if err := saveDownloadHistory(); err != nil {
+		logger.Error("保存历史记录失败", "error", err)
+	}
+	historyLock.Unlock()
+	webhooks.Flush()
+
+	if err := jobs.Close(); err != nil {
+		logger.Error("关闭任务日志失败", "error", err)
+	}
+	logger.Info("服务已关闭")
+
+	logCloserLock.Lock()
+	if logCloser != nil {
+		logCloser.Close()
+		logCloser = nil
+	}
+	logCloserLock.Unlock()
+}
+
+// waitStreams 等待 WebSocket 连接发出关闭帧，最多等待 timeout
+// SSE 连接由 HTTP 服务关闭时等待，WebSocket 连接已脱离 HTTP 服务需单独等待
+func waitStreams(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		wsSessions.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
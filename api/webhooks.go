@@ -0,0 +1,219 @@
+package api
+
+import (
+	"PaiDownloader/config"
+	"PaiDownloader/download"
+	"PaiDownloader/webhook"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var webhookDeliveriesPath = "webhook_deliveries.json" // Webhook 投递日志文件的路径
+
+var webhooks = webhook.NewDispatcher(webhookDeliveriesPath) // Webhook 事件投递器
+
+const defaultDeliveryLimit = 50 // 投递日志默认返回的条数
+
+// ConfigureWebhooks 设置全局 Webhook 接收地址并加载投递日志
+func ConfigureWebhooks(endpoints []webhook.Endpoint) error {
+	if err := validateWebhooks(endpoints); err != nil {
+		return err
+	}
+	webhooks.SetEndpoints(endpoints)
+	webhooks.SetErrorLog(func(message string, err error) {
+		logger.Error(message, "error", err)
+	})
+	if err := webhooks.Load(); err != nil {
+		logger.Error("加载 Webhook 投递日志失败", "error", err)
+	}
+	return nil
+}
+
+// validateWebhooks 检查全局 Webhook 接收地址与订阅的事件，启动与重新加载配置时使用同样的校验
+func validateWebhooks(endpoints []webhook.Endpoint) error {
+	for i, endpoint := range endpoints {
+		if err := endpoint.Validate(); err != nil {
+			return &config.FieldError{Field: fmt.Sprintf("webhooks[%d]", i), Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+// jobWebhooks 返回任务请求中指定的 Webhook 接收地址，历史记录中的签名密钥已隐藏，从完整请求参数中读取
+func jobWebhooks(historyID string) []webhook.Endpoint {
+	request, ok := jobRequest(historyID)
+	if !ok {
+		return nil
+	}
+	return request.Webhooks
+}
+
+// JobWebhookPayload 任务结束事件的数据，只包含任务的结果，不包含请求参数
+type JobWebhookPayload struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Status     string    `json:"status"`
+	OutputDir  string    `json:"output_dir"`
+	ScheduleID string    `json:"schedule_id,omitempty"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	Total      int       `json:"total"`
+	Completed  int       `json:"completed"`
+	Skipped    int       `json:"skipped"`
+	Failed     int       `json:"failed"`
+	Cancelled  int       `json:"cancelled"`
+}
+
+// notifyJob 向全局及任务级接收地址投递任务事件
+func notifyJob(historyID, event string, data interface{}) {
+	webhooks.Dispatch(event, historyID, data, jobWebhooks(historyID))
+}
+
+// notifyFile 投递单个文件结束的事件，取消的文件不发送
+func notifyFile(historyID string, entry download.DownloadHistoryEntry) {
+	switch {
+	case entry.HasFile():
+		notifyJob(historyID, webhook.EventFileCompleted, entry)
+	case entry.Status == "failed":
+		notifyJob(historyID, webhook.EventFileFailed, entry)
+	}
+}
+
+// notifyJobFinished 任务结束后投递 job_finished，所有文件均失败时投递 job_failed
+func notifyJobFinished(historyID string) {
+	history, ok := findHistory(historyID)
+	if !ok {
+		return
+	}
+
+	event := webhook.EventJobFinished
+	if history.Status == "failed" {
+		event = webhook.EventJobFailed
+	}
+	notifyJob(historyID, event, JobWebhookPayload{
+		ID:         history.ID,
+		URL:        history.URL,
+		Status:     history.Status,
+		OutputDir:  history.OutputDir,
+		ScheduleID: history.ScheduleID,
+		StartTime:  history.StartTime,
+		EndTime:    history.EndTime,
+		Total:      history.Total,
+		Completed:  history.Completed,
+		Skipped:    history.Skipped,
+		Failed:     history.Failed,
+		Cancelled:  history.Cancelled,
+	})
+}
+
+// HandleListWebhooks 返回全局 Webhook 接收地址，不返回签名密钥
+func HandleListWebhooks(c *gin.Context) {
+	type endpointInfo struct {
+		URL    string   `json:"url"`
+		Signed bool     `json:"signed"`
+		Events []string `json:"events,omitempty"`
+	}
+
+	endpoints := webhooks.Endpoints()
+	list := make([]endpointInfo, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		list = append(list, endpointInfo{URL: endpoint.URL, Signed: endpoint.Secret != "", Events: endpoint.Events})
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "Success",
+		Data:    list,
+	})
+}
+
+// HandleListDeliveries 返回 Webhook 投递日志，支持 job_id 筛选与 limit 限制条数
+func HandleListDeliveries(c *gin.Context) {
+	limit := defaultDeliveryLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Code:    400,
+				Message: "无效的查询参数",
+				Data:    fmt.Sprintf("limit 无效: %s", raw),
+			})
+			return
+		}
+		limit = n
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "Success",
+		Data:    webhooks.Deliveries(c.Query("job_id"), limit),
+	})
+}
+
+// HandleGetDelivery 返回单条投递记录及每次尝试的结果
+func HandleGetDelivery(c *gin.Context) {
+	delivery, ok := webhooks.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Code:    404,
+			Message: "投递记录不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "Success",
+		Data:    delivery,
+	})
+}
+
+// HandleTestWebhook 向请求体中的接收地址发送一次 ping 事件，未指定地址时测试所有全局接收地址
+func HandleTestWebhook(c *gin.Context) {
+	var endpoint webhook.Endpoint
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&endpoint); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Code:    400,
+				Message: "无效的请求参数",
+				Data:    err.Error(),
+			})
+			return
+		}
+	}
+
+	endpoints := webhooks.Endpoints()
+	if endpoint.URL != "" {
+		if err := endpoint.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Code:    400,
+				Message: "无效的 Webhook 配置",
+				Data:    err.Error(),
+			})
+			return
+		}
+		endpoints = []webhook.Endpoint{endpoint}
+	}
+	if len(endpoints) == 0 {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:    400,
+			Message: "未配置 Webhook 接收地址",
+		})
+		return
+	}
+
+	deliveries := make([]webhook.Delivery, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		deliveries = append(deliveries, webhooks.Test(endpoint))
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:    200,
+		Message: "测试投递已完成",
+		Data:    deliveries,
+	})
+}
@@ -0,0 +1,377 @@
+package api
+
+import (
+	"PaiDownloader/download"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+// WebSocket 命令类型
+const (
+	WSCommandStart        = "start"        // 启动下载任务，携带 request
+	WSCommandCancel       = "cancel"       // 取消任务，可携带 keep_partial
+	WSCommandPause        = "pause"        // 暂停任务
+	WSCommandResume       = "resume"       // 恢复任务
+	WSCommandReprioritize = "reprioritize" // 调整尚未开始的文件的优先级，携带 url 与 priority
+	WSCommandSubscribe    = "subscribe"    // 订阅任务事件，可携带 last_event_id 补发之后的事件
+	WSCommandUnsubscribe  = "unsubscribe"  // 取消订阅任务事件
+)
+
+const (
+	wsSendBuffer   = 256              // 每个连接待发送消息的缓冲数
+	wsPingInterval = 30 * time.Second // 服务端 ping 的间隔
+	wsWriteTimeout = 10 * time.Second // 单条消息的写超时
+)
+
+var wsSessions sync.WaitGroup // 写协程仍在运行的连接，关闭服务时等待关闭帧发出
+
+// wsGoingAway 服务关闭时发送的关闭帧
+var wsGoingAway = ws.MustCompileFrame(ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusGoingAway, "服务正在关闭")))
+
+// WSCommand 客户端发送的命令，ID 由客户端生成，原样返回在对应的响应中
+type WSCommand struct {
+	ID          string           `json:"id"`
+	Type        string           `json:"type"`
+	JobID       string           `json:"job_id,omitempty"`
+	Request     *DownloadRequest `json:"request,omitempty"`
+	URL         string           `json:"url,omitempty"`
+	Priority    int              `json:"priority,omitempty"`
+	KeepPartial bool             `json:"keep_partial,omitempty"`
+	LastEventID uint64           `json:"last_event_id,omitempty"`
+}
+
+// WSMessage 服务端发送的消息：type 为 response 时是命令的响应，为 event 时是订阅任务的事件
+type WSMessage struct {
+	Type    string             `json:"type"`
+	ID      string             `json:"id,omitempty"`
+	Code    int                `json:"code,omitempty"`
+	Message string             `json:"message,omitempty"`
+	Data    interface{}        `json:"data,omitempty"`
+	JobID   string             `json:"job_id,omitempty"`
+	Event   *download.JobEvent `json:"event,omitempty"`
+}
+
+// wsSession 一个 WebSocket 连接的会话状态
+type wsSession struct {
+	conn net.Conn
+	out  chan []byte // 已编码的待发送帧
+	done chan struct{}
+	once sync.Once
+
+	lock sync.Mutex
+	subs map[string]chan struct{} // 已订阅的任务 ID 与停止订阅的信号
+}
+
+// HandleWebSocket 建立 WebSocket 连接，客户端通过同一连接发送控制命令并接收所订阅任务的事件
+// 浏览器发起的连接只接受与服务同源的页面，其他网页不能借用户的浏览器控制下载任务
+func HandleWebSocket(c *gin.Context) {
+	if !sameOrigin(c.Request) {
+		c.JSON(http.StatusForbidden, APIResponse{
+			Code:    403,
+			Message: "不允许跨域建立 WebSocket 连接",
+		})
+		return
+	}
+
+	conn, _, _, err := ws.UpgradeHTTP(c.Request, c.Writer)
+	if err != nil {
+		logger.Warn("WebSocket 握手失败", "error", err)
+		return
+	}
+
+	session := &wsSession{
+		conn: conn,
+		out:  make(chan []byte, wsSendBuffer),
+		done: make(chan struct{}),
+		subs: make(map[string]chan struct{}),
+	}
+	wsSessions.Add(1)
+	go func() {
+		defer wsSessions.Done()
+		session.writeLoop()
+	}()
+	session.readLoop()
+}
+
+// sameOrigin 判断请求的 Origin 是否与服务的主机相同，没有 Origin 的请求来自非浏览器客户端，允许连接
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	return strings.EqualFold(parsed.Host, r.Host)
+}
+
+// readLoop 读取并处理客户端命令，连接断开后关闭会话
+// 控制帧的响应(pong、close)先写入缓冲区再交给写协程发送，避免与其他消息的帧交错
+func (s *wsSession) readLoop() {
+	defer s.close()
+
+	var control bytes.Buffer
+	handler := wsutil.ControlFrameHandler(&control, ws.StateServerSide)
+	reader := &wsutil.Reader{
+		Source:         s.conn,
+		State:          ws.StateServerSide,
+		CheckUTF8:      true,
+		OnIntermediate: handler,
+	}
+	for {
+		header, err := reader.NextFrame()
+		if err != nil {
+			return
+		}
+		if header.OpCode.IsControl() {
+			err = handler(header, reader)
+			s.flushControl(&control)
+			if err != nil {
+				return
+			}
+			continue
+		}
+		if header.OpCode != ws.OpText {
+			if err := reader.Discard(); err != nil {
+				return
+			}
+			continue
+		}
+
+		data, err := io.ReadAll(reader)
+		s.flushControl(&control)
+		if err != nil {
+			return
+		}
+
+		var command WSCommand
+		if err := json.Unmarshal(data, &command); err != nil {
+			s.respond(WSCommand{}, http.StatusBadRequest, "无效的命令格式", err.Error())
+			continue
+		}
+		s.handle(command)
+	}
+}
+
+// writeLoop 串行写出队列中的帧并定期发送 ping，写入失败时关闭会话
+func (s *wsSession) writeLoop() {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	defer s.close()
+
+	for {
+		var err error
+		select {
+		case <-s.done:
+			return
+		case <-shutdownCh:
+			s.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			s.conn.Write(wsGoingAway)
+			return
+		case frame := <-s.out:
+			s.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			_, err = s.conn.Write(frame)
+		case <-ping.C:
+			s.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			_, err = s.conn.Write(ws.CompiledPing)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// close 关闭连接并停止所有订阅，可重复调用
+func (s *wsSession) close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.conn.Close()
+	})
+}
+
+// send 将消息编码为文本帧放入发送队列，队列已满时等待，会话关闭后丢弃
+func (s *wsSession) send(message WSMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	frame, err := ws.CompileFrame(ws.NewTextFrame(data))
+	if err != nil {
+		return
+	}
+	s.enqueue(frame)
+}
+
+// flushControl 将缓冲区中的控制帧响应放入发送队列
+func (s *wsSession) flushControl(control *bytes.Buffer) {
+	if control.Len() == 0 {
+		return
+	}
+	frame := append([]byte(nil), control.Bytes()...)
+	control.Reset()
+	s.enqueue(frame)
+}
+
+// enqueue 将已编码的帧放入发送队列
+func (s *wsSession) enqueue(frame []byte) {
+	select {
+	case s.out <- frame:
+	case <-s.done:
+	}
+}
+
+// respond 发送命令的响应
+func (s *wsSession) respond(command WSCommand, code int, message string, data interface{}) {
+	s.send(WSMessage{Type: "response", ID: command.ID, Code: code, Message: message, Data: data})
+}
+
+// handle 执行单条命令并返回响应
+func (s *wsSession) handle(command WSCommand) {
+	switch command.Type {
+	case WSCommandStart:
+		// 抓取页面可能较慢，在独立协程中执行，不阻塞同一连接上的其他命令
+		go s.start(command)
+	case WSCommandPause, WSCommandResume, WSCommandCancel:
+		var job *download.Job
+		var err error
+		var message string
+		switch command.Type {
+		case WSCommandPause:
+			job, err = pauseJob(command.JobID)
+			message = "任务已暂停"
+		case WSCommandResume:
+			job, err = resumeJob(command.JobID)
+			message = "任务已恢复"
+		default:
+			job, err = cancelJob(command.JobID, command.KeepPartial)
+			message = "任务已取消"
+		}
+		if err != nil {
+			s.respond(command, jobControlStatus(err), err.Error(), nil)
+			return
+		}
+		s.respond(command, http.StatusOK, message, job.Summary())
+	case WSCommandReprioritize:
+		job, err := jobs.Reprioritize(command.JobID, command.URL, command.Priority)
+		if err != nil {
+			s.respond(command, jobControlStatus(err), err.Error(), nil)
+			return
+		}
+		s.respond(command, http.StatusOK, "优先级已调整", job.Summary())
+	case WSCommandSubscribe:
+		job, ok := jobs.Get(command.JobID)
+		if !ok {
+			s.respond(command, http.StatusNotFound, download.ErrJobNotFound.Error(), nil)
+			return
+		}
+		s.respond(command, http.StatusOK, "已订阅任务事件", job.Summary())
+		s.subscribe(job, command.LastEventID)
+	case WSCommandUnsubscribe:
+		s.unsubscribe(command.JobID)
+		s.respond(command, http.StatusOK, "已取消订阅", nil)
+	default:
+		s.respond(command, http.StatusBadRequest, fmt.Sprintf("未知的命令: %s", command.Type), nil)
+	}
+}
+
+// start 启动下载任务并自动订阅其事件
+func (s *wsSession) start(command WSCommand) {
+	if command.Request == nil {
+		s.respond(command, http.StatusBadRequest, "无效的请求参数", "缺少 request")
+		return
+	}
+	request := *command.Request
+	request.ScheduleID = ""
+	if err := binding.Validator.ValidateStruct(&request); err != nil {
+		s.respond(command, http.StatusBadRequest, "无效的请求参数", err.Error())
+		return
+	}
+
+	history, jobErr := startDownloadJob(request)
+	if jobErr != nil {
+		var data interface{}
+		if jobErr.Err != nil {
+			data = jobErr.Err.Error()
+		}
+		s.respond(command, jobErr.Status, jobErr.Message, data)
+		return
+	}
+	if history == nil {
+		s.respond(command, http.StatusOK, "未找到可下载的资源", nil)
+		return
+	}
+
+	s.respond(command, http.StatusOK, "下载任务已开始", map[string]interface{}{
+		"job_id":      history.ID,
+		"history_id":  history.ID,
+		"total_tasks": history.Total,
+		"started_at":  history.StartTime.Format(time.RFC3339),
+	})
+	if job, ok := jobs.Get(history.ID); ok {
+		s.subscribe(job, 0)
+	}
+}
+
+// subscribe 转发任务中 ID 大于 lastID 的事件，任务结束事件发出后自动取消订阅
+// 重复订阅同一任务时替换原有订阅
+func (s *wsSession) subscribe(job *download.Job, lastID uint64) {
+	stop := make(chan struct{})
+	s.lock.Lock()
+	if previous, ok := s.subs[job.ID]; ok {
+		close(previous)
+	}
+	s.subs[job.ID] = stop
+	s.lock.Unlock()
+
+	notify, unsubscribe := job.Events.Subscribe()
+	go func() {
+		defer unsubscribe()
+		for {
+			events, _ := job.Events.Since(lastID)
+			for i := range events {
+				s.send(WSMessage{Type: "event", JobID: job.ID, Event: &events[i]})
+				lastID = events[i].ID
+				if events[i].Type == download.EventJobFinished {
+					s.lock.Lock()
+					if s.subs[job.ID] == stop {
+						delete(s.subs, job.ID)
+					}
+					s.lock.Unlock()
+					return
+				}
+			}
+
+			select {
+			case <-notify:
+			case <-stop:
+				return
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// unsubscribe 停止转发任务的事件
+func (s *wsSession) unsubscribe(jobID string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if stop, ok := s.subs[jobID]; ok {
+		close(stop)
+		delete(s.subs, jobID)
+	}
+}
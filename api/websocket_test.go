@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		name   string
+		host   string
+		origin string
+		want   bool
+	}{
+		{name: "非浏览器客户端", host: "localhost:8080", origin: "", want: true},
+		{name: "同源", host: "localhost:8080", origin: "http://localhost:8080", want: true},
+		{name: "同源 https", host: "downloader.example.com", origin: "https://downloader.example.com", want: true},
+		{name: "主机名不区分大小写", host: "Downloader.Example.com", origin: "https://downloader.example.com", want: true},
+		{name: "其他网站", host: "localhost:8080", origin: "https://evil.example.com", want: false},
+		{name: "端口不同", host: "localhost:8080", origin: "http://localhost:3000", want: false},
+		{name: "null 来源", host: "localhost:8080", origin: "null", want: false},
+		{name: "无法解析", host: "localhost:8080", origin: "http://%zz", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			r.Host = tt.host
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := sameOrigin(r); got != tt.want {
+				t.Errorf("sameOrigin(Host=%s, Origin=%s) = %v，期望 %v", tt.host, tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebSocketRejectsCrossOrigin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", HandleWebSocket)
+
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	r.Header.Set("Origin", "https://evil.example.com")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, r)
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("跨域握手返回 %d，期望 403", recorder.Code)
+	}
+}
@@ -2,37 +2,112 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 )
 
 // AppConfig 定义应用程序的配置结构，用于存储服务器端口、下载目录和最大并发数等信息。
+// 每个非 map/切片字段都可以通过 PAIDL_<JSON 字段名大写> 环境变量覆盖，嵌套字段以下划线连接，如 PAIDL_LOG_LEVEL
 type AppConfig struct {
-	ServerPort    string `json:"server_port"`
-	DownloadDir   string `json:"download_dir"`
-	MaxConcurrent int    `json:"max_concurrent"`
-	ProxyURL      string `json:"proxy_url"` // 代理url
+	ServerPort     string `json:"server_port"`
+	BindAddress    string `json:"bind_address"` // 监听地址，为空时监听所有地址
+	DownloadDir    string `json:"download_dir"`
+	MaxConcurrent  int    `json:"max_concurrent"`
+	RetryTimes     int    `json:"retry_times"`     // 下载失败的最大重试次数
+	TimeoutSeconds int    `json:"timeout_seconds"` // 等待响应头与每次读取数据的超时时间(秒)，不限制整个下载的时长
+	UserAgent      string `json:"user_agent"`      // 请求使用的 User-Agent
+	ProxyURL       string `json:"proxy_url"`       // 代理url
+	RateLimit      string `json:"rate_limit"`      // API 请求频率限制，格式为 <次数>-<S|M|H|D>，如 100-H，为空时不限制
+
+	BandwidthLimit      int64            `json:"bandwidth_limit"`       // 全局下载限速(字节/秒)，0 表示不限速
+	HostBandwidthLimits map[string]int64 `json:"host_bandwidth_limits"` // 按主机的下载限速(字节/秒)
+
+	MaxPerHost    int                     `json:"max_per_host"`   // 同一主机的最大并发连接数
+	HostDelayMs   int                     `json:"host_delay_ms"`  // 同一主机两次请求之间的最小间隔(毫秒)
+	HostJitterMs  int                     `json:"host_jitter_ms"` // 请求间隔的随机抖动上限(毫秒)
+	HostOverrides map[string]HostOverride `json:"host_overrides"` // 按主机覆盖的调度策略
+
+	ResumePaused bool `json:"resume_paused"` // 重启后恢复的未完成任务以暂停状态启动
+
+	ShutdownGraceSeconds int `json:"shutdown_grace_seconds"` // 关闭时等待下载中的文件结束的最长时间(秒)，0 表示不等待
+	ConfigWatchSeconds   int `json:"config_watch_seconds"`   // 检查配置文件是否修改的间隔(秒)，0 表示不监视
+
+	Webhooks []Webhook `json:"webhooks"` // 全局 Webhook 接收地址，接收所有任务的事件
+
+	Log LogConfig `json:"log"` // 日志级别、输出位置与轮转策略
+}
+
+// LogConfig 定义日志的级别、输出位置与日志文件的轮转策略
+type LogConfig struct {
+	Level       string `json:"level"`        // 日志级别(debug/info/warn/error)，为空时为 info
+	Output      string `json:"output"`       // 输出位置(stdout/file/both)，为空时为 both
+	File        string `json:"file"`         // 日志文件路径，为空时为 download.log
+	MaxSizeMB   int    `json:"max_size_mb"`  // 日志文件超过该大小(MB)时轮转，0 表示不按大小轮转
+	RotateHours int    `json:"rotate_hours"` // 日志文件写入超过该时长(小时)时轮转，0 表示不按时间轮转
+	MaxAgeDays  int    `json:"max_age_days"` // 删除早于该天数的已轮转文件，0 表示不按时间删除
+	MaxBackups  int    `json:"max_backups"`  // 最多保留的已轮转文件数，0 表示不限
+}
+
+// Webhook 定义一个全局 Webhook 接收地址
+type Webhook struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"` // HMAC-SHA256 签名密钥，为空时不签名
+	Events []string `json:"events"` // 订阅的事件，为空时只接收任务开始、结束与失败事件
+}
+
+// HostOverride 定义单个主机的调度策略，覆盖全局的并发与间隔设置
+type HostOverride struct {
+	MaxConnections int `json:"max_connections"`
+	DelayMs        int `json:"delay_ms"`
+	JitterMs       int `json:"jitter_ms"`
 }
 
+// DefaultConfig 返回默认配置，配置文件中未出现的字段保持默认值
+func DefaultConfig() *AppConfig {
+	return &AppConfig{
+		ServerPort:     "8080",            // 服务端口
+		DownloadDir:    "./download_data", // 文件下载存放目录
+		MaxConcurrent:  5,                 // 最大并发数
+		RetryTimes:     3,                 // 下载失败重试次数
+		TimeoutSeconds: 30,                // 请求超时
+		UserAgent:      DefaultUserAgent,  // 请求使用的 User-Agent
+		RateLimit:      "100-H",           // 每个客户端每小时 100 次请求
+		MaxPerHost:     3,                 // 同一主机最大并发数
+		HostDelayMs:    100,               // 同一主机请求间隔
+		HostJitterMs:   50,                // 请求间隔随机抖动
+
+		ShutdownGraceSeconds: 30, // 关闭时等待下载结束的时间
+		ConfigWatchSeconds:   2,  // 配置文件修改后自动重新加载
+		Log: LogConfig{
+			Level:      "info",
+			Output:     "both",
+			File:       "download.log",
+			MaxSizeMB:  100,
+			MaxAgeDays: 30,
+			MaxBackups: 10,
+		},
+	}
+}
+
+// DefaultUserAgent 默认的 User-Agent
+const DefaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
+
 // LoadConfig 函数用于加载配置文件。如果配置文件不存在，则创建一个默认配置文件。
 // 参数 configPath 配置文件的路径，如果为空，则使用默认路径 "config.json"。
-// 返回值 AppConfig 指针和可能出现的错误。
+// 配置文件中的值覆盖默认值，PAIDL_* 环境变量再覆盖配置文件，最后校验所有配置项。
+// 返回值 AppConfig 指针和可能出现的错误，配置项无效时错误为 *FieldError。
 func LoadConfig(configPath string) (*AppConfig, error) {
 	// 如果未提供配置文件路径，则使用默认路径
 	if configPath == "" {
 		configPath = "config.json"
 	}
+	config := DefaultConfig()
 
 	// 检查配置文件是否存在
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		// 创建默认配置
-		defaultConfig := &AppConfig{
-			ServerPort:    "8080",            // 服务端口
-			DownloadDir:   "./download_data", // 文件下载存放目录
-			MaxConcurrent: 5,                 // 最大并发数
-		}
-
 		// 将默认配置转换为 JSON 格式
-		data, err := json.MarshalIndent(defaultConfig, "", "  ")
+		data, err := json.MarshalIndent(config, "", "  ")
 		if err != nil {
 			return nil, err
 		}
@@ -41,21 +116,30 @@ func LoadConfig(configPath string) (*AppConfig, error) {
 		if err := os.WriteFile(configPath, data, 0644); err != nil {
 			return nil, err
 		}
+	} else {
+		// 读取配置文件内容
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, err
+		}
 
-		return defaultConfig, nil
+		// 将 JSON 数据解析到 AppConfig 结构体中
+		if err := json.Unmarshal(data, config); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) && typeErr.Field != "" {
+				return nil, &FieldError{Field: typeErr.Field, Reason: fmt.Sprintf("类型应为 %s", typeErr.Type)}
+			}
+			return nil, fmt.Errorf("解析配置文件 %s 失败: %w", configPath, err)
+		}
 	}
 
-	// 读取配置文件内容
-	data, err := os.ReadFile(configPath)
-	if err != nil {
+	// 环境变量覆盖配置文件
+	if err := applyEnv(config, os.LookupEnv); err != nil {
 		return nil, err
 	}
 
-	var config AppConfig
-	// 将 JSON 数据解析到 AppConfig 结构体中
-	if err := json.Unmarshal(data, &config); err != nil {
+	if err := config.Validate(); err != nil {
 		return nil, err
 	}
-
-	return &config, nil
+	return config, nil
 }
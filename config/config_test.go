@@ -0,0 +1,205 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// envLookup 以 map 模拟环境变量
+func envLookup(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		check     func(c *AppConfig) bool
+		wantField string // 期望出错的配置项，为空表示不出错
+	}{
+		{
+			name:  "未设置环境变量",
+			env:   map[string]string{},
+			check: func(c *AppConfig) bool { return reflect.DeepEqual(c, DefaultConfig()) },
+		},
+		{
+			name:  "字符串",
+			env:   map[string]string{"PAIDL_SERVER_PORT": "9090", "PAIDL_USER_AGENT": "test-agent"},
+			check: func(c *AppConfig) bool { return c.ServerPort == "9090" && c.UserAgent == "test-agent" },
+		},
+		{
+			name:  "整数允许首尾空白",
+			env:   map[string]string{"PAIDL_MAX_CONCURRENT": " 12 ", "PAIDL_BANDWIDTH_LIMIT": "1048576"},
+			check: func(c *AppConfig) bool { return c.MaxConcurrent == 12 && c.BandwidthLimit == 1048576 },
+		},
+		{
+			name:  "布尔值",
+			env:   map[string]string{"PAIDL_RESUME_PAUSED": "true"},
+			check: func(c *AppConfig) bool { return c.ResumePaused },
+		},
+		{
+			name:  "嵌套配置项",
+			env:   map[string]string{"PAIDL_LOG_LEVEL": "debug", "PAIDL_LOG_MAX_BACKUPS": "3"},
+			check: func(c *AppConfig) bool { return c.Log.Level == "debug" && c.Log.MaxBackups == 3 },
+		},
+		{
+			name:  "空字符串覆盖为空",
+			env:   map[string]string{"PAIDL_PROXY_URL": ""},
+			check: func(c *AppConfig) bool { return c.ProxyURL == "" },
+		},
+		{
+			name:  "忽略其他前缀",
+			env:   map[string]string{"MAX_CONCURRENT": "99", "paidl_max_concurrent": "99"},
+			check: func(c *AppConfig) bool { return c.MaxConcurrent == DefaultConfig().MaxConcurrent },
+		},
+		{
+			name:      "无效的整数",
+			env:       map[string]string{"PAIDL_MAX_CONCURRENT": "many"},
+			wantField: "max_concurrent",
+		},
+		{
+			name:      "无效的布尔值",
+			env:       map[string]string{"PAIDL_RESUME_PAUSED": "maybe"},
+			wantField: "resume_paused",
+		},
+		{
+			name:      "嵌套配置项无效",
+			env:       map[string]string{"PAIDL_LOG_MAX_SIZE_MB": "1.5"},
+			wantField: "log.max_size_mb",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultConfig()
+			err := applyEnv(c, envLookup(tt.env))
+			if tt.wantField != "" {
+				var fieldErr *FieldError
+				if !errors.As(err, &fieldErr) || fieldErr.Field != tt.wantField {
+					t.Fatalf("applyEnv() error = %v，期望配置项 %s 无效", err, tt.wantField)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEnv() error = %v", err)
+			}
+			if !tt.check(c) {
+				t.Errorf("覆盖后的配置不符合预期: %+v", c)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(c *AppConfig)
+		wantField string // 期望无效的配置项，为空表示配置有效
+	}{
+		{name: "默认配置", modify: func(c *AppConfig) {}},
+		{name: "监听 localhost", modify: func(c *AppConfig) { c.BindAddress = "localhost" }},
+		{name: "socks5 代理", modify: func(c *AppConfig) { c.ProxyURL = "socks5://127.0.0.1:1080" }},
+		{name: "频率限制", modify: func(c *AppConfig) { c.RateLimit = "100-H" }},
+		{name: "日志级别 warning", modify: func(c *AppConfig) { c.Log.Level = "warning" }},
+		{name: "端口为 0", modify: func(c *AppConfig) { c.ServerPort = "0" }, wantField: "server_port"},
+		{name: "端口不是数字", modify: func(c *AppConfig) { c.ServerPort = "http" }, wantField: "server_port"},
+		{name: "监听地址无效", modify: func(c *AppConfig) { c.BindAddress = "example.com" }, wantField: "bind_address"},
+		{name: "下载目录为空", modify: func(c *AppConfig) { c.DownloadDir = "" }, wantField: "download_dir"},
+		{name: "并发数为 0", modify: func(c *AppConfig) { c.MaxConcurrent = 0 }, wantField: "max_concurrent"},
+		{name: "重试次数为负数", modify: func(c *AppConfig) { c.RetryTimes = -1 }, wantField: "retry_times"},
+		{name: "超时为 0", modify: func(c *AppConfig) { c.TimeoutSeconds = 0 }, wantField: "timeout_seconds"},
+		{name: "User-Agent 为空", modify: func(c *AppConfig) { c.UserAgent = "" }, wantField: "user_agent"},
+		{name: "不支持的代理协议", modify: func(c *AppConfig) { c.ProxyURL = "ftp://127.0.0.1" }, wantField: "proxy_url"},
+		{name: "代理缺少主机", modify: func(c *AppConfig) { c.ProxyURL = "http://" }, wantField: "proxy_url"},
+		{name: "频率限制次数为 0", modify: func(c *AppConfig) { c.RateLimit = "0-H" }, wantField: "rate_limit"},
+		{name: "频率限制单位无效", modify: func(c *AppConfig) { c.RateLimit = "100-W" }, wantField: "rate_limit"},
+		{name: "限速为负数", modify: func(c *AppConfig) { c.BandwidthLimit = -1 }, wantField: "bandwidth_limit"},
+		{
+			name:      "主机限速为负数",
+			modify:    func(c *AppConfig) { c.HostBandwidthLimits = map[string]int64{"example.com": -1} },
+			wantField: "host_bandwidth_limits[example.com]",
+		},
+		{
+			name:      "主机请求间隔为负数",
+			modify:    func(c *AppConfig) { c.HostOverrides = map[string]HostOverride{"example.com": {DelayMs: -1}} },
+			wantField: "host_overrides[example.com].delay_ms",
+		},
+		{name: "关闭等待时间为负数", modify: func(c *AppConfig) { c.ShutdownGraceSeconds = -1 }, wantField: "shutdown_grace_seconds"},
+		{name: "配置检查间隔为负数", modify: func(c *AppConfig) { c.ConfigWatchSeconds = -1 }, wantField: "config_watch_seconds"},
+		{
+			name:      "Webhook 地址无效",
+			modify:    func(c *AppConfig) { c.Webhooks = []Webhook{{URL: "https://example.com/hook"}, {URL: "example.com"}} },
+			wantField: "webhooks[1].url",
+		},
+		{name: "日志级别无效", modify: func(c *AppConfig) { c.Log.Level = "verbose" }, wantField: "log.level"},
+		{name: "日志输出位置无效", modify: func(c *AppConfig) { c.Log.Output = "syslog" }, wantField: "log.output"},
+		{name: "日志保留数量为负数", modify: func(c *AppConfig) { c.Log.MaxBackups = -1 }, wantField: "log.max_backups"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultConfig()
+			tt.modify(c)
+			err := c.Validate()
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != tt.wantField {
+				t.Errorf("Validate() error = %v，期望配置项 %s 无效", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"max_concurrent": 4, "log": {"level": "warn"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PAIDL_MAX_CONCURRENT", "6")
+
+	// 环境变量覆盖配置文件，配置文件中未出现的配置项使用默认值
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if c.MaxConcurrent != 6 {
+		t.Errorf("max_concurrent = %d，期望环境变量中的 6", c.MaxConcurrent)
+	}
+	if c.Log.Level != "warn" {
+		t.Errorf("log.level = %q，期望配置文件中的 warn", c.Log.Level)
+	}
+	if c.UserAgent != DefaultConfig().UserAgent {
+		t.Errorf("user_agent = %q，期望默认值", c.UserAgent)
+	}
+
+	// 覆盖后的配置同样需要通过校验
+	t.Setenv("PAIDL_MAX_CONCURRENT", "0")
+	_, err = LoadConfig(path)
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Field != "max_concurrent" {
+		t.Errorf("LoadConfig() error = %v，期望配置项 max_concurrent 无效", err)
+	}
+}
+
+func TestLoadConfigTypeError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"log": {"max_size_mb": "10"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadConfig(path)
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Field != "log.max_size_mb" {
+		t.Errorf("LoadConfig() error = %v，期望配置项 log.max_size_mb 无效", err)
+	}
+}
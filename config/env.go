@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix 覆盖配置项的环境变量前缀
+const EnvPrefix = "PAIDL_"
+
+// applyEnv 用 PAIDL_* 环境变量覆盖配置项，变量名为 JSON 字段路径的大写形式，如 PAIDL_MAX_CONCURRENT、PAIDL_LOG_LEVEL
+// map 与切片类型的配置项只能在配置文件中设置
+func applyEnv(config *AppConfig, lookup func(string) (string, bool)) error {
+	return applyEnvStruct(reflect.ValueOf(config).Elem(), "", lookup)
+}
+
+// applyEnvStruct 递归覆盖结构体中的字段，prefix 为上层字段的 JSON 路径
+func applyEnvStruct(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		field := prefix + name
+		value := v.Field(i)
+
+		if value.Kind() == reflect.Struct {
+			if err := applyEnvStruct(value, field+".", lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		envName := EnvPrefix + strings.ToUpper(strings.ReplaceAll(field, ".", "_"))
+		raw, ok := lookup(envName)
+		if !ok {
+			continue
+		}
+		if err := setFromEnv(value, raw); err != nil {
+			return &FieldError{Field: field, Reason: fmt.Sprintf("环境变量 %s=%q %v", envName, raw, err)}
+		}
+	}
+	return nil
+}
+
+// setFromEnv 将环境变量的字符串值解析为字段的类型并赋值
+func setFromEnv(value reflect.Value, raw string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return fmt.Errorf("不是有效的整数")
+		}
+		value.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("不是有效的布尔值")
+		}
+		value.SetBool(b)
+	}
+	return nil
+}
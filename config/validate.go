@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FieldError 配置项无效的错误，Field 为配置项的 JSON 路径(如 log.level)
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+// Error 实现 error 接口
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("配置项 %s 无效: %s", e.Field, e.Reason)
+}
+
+var rateLimitPattern = regexp.MustCompile(`^[1-9][0-9]*-[SMHD]$`) // API 请求频率限制的格式
+
+// Validate 校验所有配置项，返回第一个无效配置项的 *FieldError
+func (c *AppConfig) Validate() error {
+	if port, err := strconv.Atoi(c.ServerPort); err != nil || port < 1 || port > 65535 {
+		return &FieldError{Field: "server_port", Reason: fmt.Sprintf("%q 不是 1-65535 之间的端口号", c.ServerPort)}
+	}
+	if c.BindAddress != "" && c.BindAddress != "localhost" && net.ParseIP(c.BindAddress) == nil {
+		return &FieldError{Field: "bind_address", Reason: fmt.Sprintf("%q 不是有效的 IP 地址", c.BindAddress)}
+	}
+	if strings.TrimSpace(c.DownloadDir) == "" {
+		return &FieldError{Field: "download_dir", Reason: "不能为空"}
+	}
+	if c.MaxConcurrent < 1 {
+		return &FieldError{Field: "max_concurrent", Reason: "必须大于 0"}
+	}
+	if c.RetryTimes < 0 {
+		return &FieldError{Field: "retry_times", Reason: "不能为负数"}
+	}
+	if c.TimeoutSeconds < 1 {
+		return &FieldError{Field: "timeout_seconds", Reason: "必须大于 0"}
+	}
+	if strings.TrimSpace(c.UserAgent) == "" {
+		return &FieldError{Field: "user_agent", Reason: "不能为空"}
+	}
+	if c.ProxyURL != "" {
+		proxy, err := url.Parse(c.ProxyURL)
+		if err != nil || proxy.Host == "" ||
+			(proxy.Scheme != "http" && proxy.Scheme != "https" && proxy.Scheme != "socks5") {
+			return &FieldError{Field: "proxy_url", Reason: fmt.Sprintf("%q 不是有效的 http/https/socks5 代理地址", c.ProxyURL)}
+		}
+	}
+	if c.RateLimit != "" && !rateLimitPattern.MatchString(c.RateLimit) {
+		return &FieldError{Field: "rate_limit", Reason: fmt.Sprintf("%q 格式应为 <次数>-<S|M|H|D>，如 100-H", c.RateLimit)}
+	}
+
+	if c.BandwidthLimit < 0 {
+		return &FieldError{Field: "bandwidth_limit", Reason: "不能为负数"}
+	}
+	for host, limit := range c.HostBandwidthLimits {
+		if limit < 0 {
+			return &FieldError{Field: fmt.Sprintf("host_bandwidth_limits[%s]", host), Reason: "不能为负数"}
+		}
+	}
+
+	if c.MaxPerHost < 0 {
+		return &FieldError{Field: "max_per_host", Reason: "不能为负数"}
+	}
+	if c.HostDelayMs < 0 {
+		return &FieldError{Field: "host_delay_ms", Reason: "不能为负数"}
+	}
+	if c.HostJitterMs < 0 {
+		return &FieldError{Field: "host_jitter_ms", Reason: "不能为负数"}
+	}
+	for host, o := range c.HostOverrides {
+		field := fmt.Sprintf("host_overrides[%s]", host)
+		switch {
+		case o.MaxConnections < 0:
+			return &FieldError{Field: field + ".max_connections", Reason: "不能为负数"}
+		case o.DelayMs < 0:
+			return &FieldError{Field: field + ".delay_ms", Reason: "不能为负数"}
+		case o.JitterMs < 0:
+			return &FieldError{Field: field + ".jitter_ms", Reason: "不能为负数"}
+		}
+	}
+
+	if c.ShutdownGraceSeconds < 0 {
+		return &FieldError{Field: "shutdown_grace_seconds", Reason: "不能为负数"}
+	}
+	if c.ConfigWatchSeconds < 0 {
+		return &FieldError{Field: "config_watch_seconds", Reason: "不能为负数"}
+	}
+	for i, w := range c.Webhooks {
+		if parsed, err := url.Parse(w.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return &FieldError{Field: fmt.Sprintf("webhooks[%d].url", i), Reason: fmt.Sprintf("%q 不是有效的 http/https 地址", w.URL)}
+		}
+	}
+	return c.Log.validate()
+}
+
+// validate 校验日志配置
+func (l LogConfig) validate() error {
+	switch strings.ToLower(l.Level) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		return &FieldError{Field: "log.level", Reason: fmt.Sprintf("%q 应为 debug/info/warn/error", l.Level)}
+	}
+	switch l.Output {
+	case "", "stdout", "file", "both":
+	default:
+		return &FieldError{Field: "log.output", Reason: fmt.Sprintf("%q 应为 stdout/file/both", l.Output)}
+	}
+	switch {
+	case l.MaxSizeMB < 0:
+		return &FieldError{Field: "log.max_size_mb", Reason: "不能为负数"}
+	case l.RotateHours < 0:
+		return &FieldError{Field: "log.rotate_hours", Reason: "不能为负数"}
+	case l.MaxAgeDays < 0:
+		return &FieldError{Field: "log.max_age_days", Reason: "不能为负数"}
+	case l.MaxBackups < 0:
+		return &FieldError{Field: "log.max_backups", Reason: "不能为负数"}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package download
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// 支持的归档格式
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+// ManifestFile 描述清单中的单个文件，Path 为相对输出目录的路径（<type>/<filename>）
+type ManifestFile struct {
+	Path string `json:"path"`
+	URL  string `json:"url"`
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+	Checksums
+}
+
+// Manifest 任务清单，记录每个文件的来源 URL 与校验值，既写入任务目录也随归档附带
+type Manifest struct {
+	JobID     string         `json:"job_id"`
+	SourceURL string         `json:"source_url"`
+	CreatedAt time.Time      `json:"created_at"`
+	Files     []ManifestFile `json:"files"`
+}
+
+// NormalizeArchiveFormat 规范化归档格式参数，无法识别时返回错误
+func NormalizeArchiveFormat(format string) (string, error) {
+	switch format {
+	case "", "zip":
+		return ArchiveZip, nil
+	case "tar.gz", "tgz", "targz":
+		return ArchiveTarGz, nil
+	default:
+		return "", fmt.Errorf("不支持的归档格式: %s", format)
+	}
+}
+
+// WriteArchive 将 baseDir 下的文件按原有目录结构流式写入归档，不在磁盘上暂存副本
+func WriteArchive(w io.Writer, format, baseDir string, manifest Manifest) error {
+	switch format {
+	case ArchiveZip:
+		return writeZipArchive(w, baseDir, manifest)
+	case ArchiveTarGz:
+		return writeTarGzArchive(w, baseDir, manifest)
+	default:
+		return fmt.Errorf("不支持的归档格式: %s", format)
+	}
+}
+
+// writeZipArchive 以 ZIP 格式写出归档
+func writeZipArchive(w io.Writer, baseDir string, manifest Manifest) error {
+	zw := zip.NewWriter(w)
+
+	for _, f := range manifest.Files {
+		file, err := os.Open(filepath.Join(baseDir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return fmt.Errorf("打开文件失败: %v", err)
+		}
+
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("读取文件信息失败: %v", err)
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("创建归档头失败: %v", err)
+		}
+		header.Name = path.Clean(f.Path)
+		header.Method = zip.Deflate
+
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("写入归档头失败: %v", err)
+		}
+		_, err = io.Copy(entry, file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("写入归档内容失败: %v", err)
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     "manifest.json",
+		Method:   zip.Deflate,
+		Modified: manifest.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("写入清单失败: %v", err)
+	}
+	if _, err := entry.Write(data); err != nil {
+		return fmt.Errorf("写入清单失败: %v", err)
+	}
+
+	return zw.Close()
+}
+
+// writeTarGzArchive 以 tar.gz 格式写出归档
+func writeTarGzArchive(w io.Writer, baseDir string, manifest Manifest) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, f := range manifest.Files {
+		file, err := os.Open(filepath.Join(baseDir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return fmt.Errorf("打开文件失败: %v", err)
+		}
+
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("读取文件信息失败: %v", err)
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("创建归档头失败: %v", err)
+		}
+		header.Name = path.Clean(f.Path)
+
+		if err := tw.WriteHeader(header); err != nil {
+			file.Close()
+			return fmt.Errorf("写入归档头失败: %v", err)
+		}
+		_, err = io.Copy(tw, file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("写入归档内容失败: %v", err)
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    "manifest.json",
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: manifest.CreatedAt,
+	}); err != nil {
+		return fmt.Errorf("写入清单失败: %v", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("写入清单失败: %v", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,213 @@
+package download
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const throttleChunkSize = 32 * 1024 // 限速读取时单次读取的最大字节数
+
+// Bandwidth 全局带宽管理器，负责全局、按主机和按任务的下载限速
+var Bandwidth = NewBandwidthManager()
+
+// RateLimiter 令牌桶限速器，rate 为每秒允许的字节数，0 表示不限速
+type RateLimiter struct {
+	lock   sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter 创建一个限速器
+func NewRateLimiter(rate int64) *RateLimiter {
+	return &RateLimiter{rate: rate, tokens: float64(rate), last: time.Now()}
+}
+
+// SetRate 调整限速值，正在等待的读取会在下一次读取时使用新速率
+func (l *RateLimiter) SetRate(rate int64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.rate = rate
+	l.tokens = float64(rate)
+	l.last = time.Now()
+}
+
+// Rate 返回当前限速值
+func (l *RateLimiter) Rate() int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.rate
+}
+
+// WaitN 消耗 n 个令牌，令牌不足时阻塞到补足为止，桶容量为一秒的流量
+// ctx 结束时提前返回其错误，使任务取消不必等待限速结束
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	l.lock.Lock()
+	if l.rate <= 0 {
+		l.lock.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+	if l.tokens > float64(l.rate) {
+		l.tokens = float64(l.rate)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	}
+	l.lock.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// BandwidthLimits 描述当前生效的各级限速值(字节/秒)
+type BandwidthLimits struct {
+	Global int64            `json:"global"`
+	Hosts  map[string]int64 `json:"hosts"`
+	Jobs   map[string]int64 `json:"jobs"`
+}
+
+// BandwidthManager 管理全局、按主机和按任务的限速器，限速值可在运行时调整
+type BandwidthManager struct {
+	lock   sync.RWMutex
+	global *RateLimiter
+	hosts  map[string]*RateLimiter
+	jobs   map[string]*RateLimiter
+}
+
+// NewBandwidthManager 创建一个不限速的带宽管理器
+func NewBandwidthManager() *BandwidthManager {
+	return &BandwidthManager{
+		global: NewRateLimiter(0),
+		hosts:  make(map[string]*RateLimiter),
+		jobs:   make(map[string]*RateLimiter),
+	}
+}
+
+// SetGlobalLimit 设置全局限速
+func (m *BandwidthManager) SetGlobalLimit(rate int64) {
+	m.global.SetRate(rate)
+}
+
+// SetHostLimit 设置指定主机的限速，rate 不大于 0 时取消限速
+func (m *BandwidthManager) SetHostLimit(host string, rate int64) {
+	host = strings.ToLower(host)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if rate <= 0 {
+		delete(m.hosts, host)
+		return
+	}
+	if limiter, ok := m.hosts[host]; ok {
+		limiter.SetRate(rate)
+		return
+	}
+	m.hosts[host] = NewRateLimiter(rate)
+}
+
+// SetJobLimit 设置指定任务的限速，rate 不大于 0 时取消限速
+func (m *BandwidthManager) SetJobLimit(jobID string, rate int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if rate <= 0 {
+		delete(m.jobs, jobID)
+		return
+	}
+	if limiter, ok := m.jobs[jobID]; ok {
+		limiter.SetRate(rate)
+		return
+	}
+	m.jobs[jobID] = NewRateLimiter(rate)
+}
+
+// RemoveJob 任务结束后移除其限速器
+func (m *BandwidthManager) RemoveJob(jobID string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.jobs, jobID)
+}
+
+// Limits 返回当前生效的限速配置
+func (m *BandwidthManager) Limits() BandwidthLimits {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	limits := BandwidthLimits{
+		Global: m.global.Rate(),
+		Hosts:  make(map[string]int64, len(m.hosts)),
+		Jobs:   make(map[string]int64, len(m.jobs)),
+	}
+	for host, limiter := range m.hosts {
+		limits.Hosts[host] = limiter.Rate()
+	}
+	for jobID, limiter := range m.jobs {
+		limits.Jobs[jobID] = limiter.Rate()
+	}
+	return limits
+}
+
+// limiters 返回作用于指定主机和任务的全部限速器
+func (m *BandwidthManager) limiters(host, jobID string) []*RateLimiter {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	limiters := []*RateLimiter{m.global}
+	if limiter, ok := m.hosts[host]; ok {
+		limiters = append(limiters, limiter)
+	}
+	if limiter, ok := m.jobs[jobID]; ok {
+		limiters = append(limiters, limiter)
+	}
+	return limiters
+}
+
+// Throttle 包装响应体，读取时同时受全局、主机和任务限速约束，ctx 结束时停止等待
+func (m *BandwidthManager) Throttle(ctx context.Context, r io.Reader, rawURL, jobID string) io.Reader {
+	return &throttledReader{ctx: ctx, reader: r, manager: m, host: taskHost(rawURL), jobID: jobID}
+}
+
+// throttledReader 限速读取器，每次读取后按读取量消耗令牌
+type throttledReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	manager *BandwidthManager
+	host    string
+	jobID   string
+}
+
+// Read 实现 io.Reader 接口
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunkSize {
+		p = p[:throttleChunkSize]
+	}
+	n, err := t.reader.Read(p)
+	if n > 0 {
+		// 每次读取时重新获取限速器，使运行时调整的主机限速立即生效
+		for _, limiter := range t.manager.limiters(t.host, t.jobID) {
+			if waitErr := limiter.WaitN(t.ctx, n); waitErr != nil {
+				return n, waitErr
+			}
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,164 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWaitN(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     int64
+		reads    []int // 依次消耗的令牌数
+		wantWait time.Duration
+	}{
+		{name: "不限速", rate: 0, reads: []int{1 << 20, 1 << 20}},
+		{name: "桶内令牌足够", rate: 10000, reads: []int{4000, 6000}},
+		{name: "令牌不足时等待补足", rate: 10000, reads: []int{10000, 2000}, wantWait: 200 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter(tt.rate)
+			start := time.Now()
+			for _, n := range tt.reads {
+				if err := limiter.WaitN(context.Background(), n); err != nil {
+					t.Fatal(err)
+				}
+			}
+			assertElapsed(t, time.Since(start), tt.wantWait)
+		})
+	}
+}
+
+func TestRateLimiterWaitNCancelled(t *testing.T) {
+	limiter := NewRateLimiter(1000)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	// 桶内只有 1000 个令牌，消耗 11000 个需要等待 10 秒
+	err := limiter.WaitN(ctx, 11000)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitN() error = %v，期望 %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ctx 结束后 WaitN 仍等待了 %v", elapsed)
+	}
+}
+
+func TestBandwidthManagerLimiters(t *testing.T) {
+	manager := NewBandwidthManager()
+	manager.SetGlobalLimit(1000)
+	manager.SetHostLimit("Example.COM", 2000)
+	manager.SetHostLimit("other.com", 3000)
+	manager.SetJobLimit("job-1", 4000)
+
+	want := BandwidthLimits{
+		Global: 1000,
+		Hosts:  map[string]int64{"example.com": 2000, "other.com": 3000},
+		Jobs:   map[string]int64{"job-1": 4000},
+	}
+	if got := manager.Limits(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Limits() = %+v，期望 %+v", got, want)
+	}
+
+	tests := []struct {
+		name      string
+		host      string
+		jobID     string
+		wantRates []int64
+	}{
+		{name: "全局、主机与任务", host: "example.com", jobID: "job-1", wantRates: []int64{1000, 2000, 4000}},
+		{name: "主机没有限速", host: "unknown.com", jobID: "job-1", wantRates: []int64{1000, 4000}},
+		{name: "任务没有限速", host: "other.com", jobID: "job-2", wantRates: []int64{1000, 3000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rates []int64
+			for _, limiter := range manager.limiters(tt.host, tt.jobID) {
+				rates = append(rates, limiter.Rate())
+			}
+			if !reflect.DeepEqual(rates, tt.wantRates) {
+				t.Errorf("limiters() 的限速值为 %v，期望 %v", rates, tt.wantRates)
+			}
+		})
+	}
+
+	// 调整已有限速器时保留同一个实例，使进行中的读取立即使用新速率
+	before := manager.limiters("example.com", "")[1]
+	manager.SetHostLimit("example.com", 5000)
+	if after := manager.limiters("example.com", "")[1]; after != before || after.Rate() != 5000 {
+		t.Errorf("调整主机限速后限速器为 %p(%d)，期望 %p(5000)", after, after.Rate(), before)
+	}
+
+	manager.SetHostLimit("other.com", 0)
+	manager.RemoveJob("job-1")
+	want = BandwidthLimits{Global: 1000, Hosts: map[string]int64{"example.com": 5000}, Jobs: map[string]int64{}}
+	if got := manager.Limits(); !reflect.DeepEqual(got, want) {
+		t.Errorf("取消限速后 Limits() = %+v，期望 %+v", got, want)
+	}
+}
+
+func TestThrottleUsesStrictestLimit(t *testing.T) {
+	const size = 30000 // 读取的字节数
+
+	tests := []struct {
+		name     string
+		global   int64
+		host     int64
+		job      int64
+		wantWait time.Duration // 桶内初始令牌为一秒的流量，超出部分按最严格的限速计算等待时间
+	}{
+		{name: "不限速", wantWait: 0},
+		{name: "全局限速", global: 20000, wantWait: 500 * time.Millisecond},
+		{name: "主机限速更严格", global: 100000, host: 24000, wantWait: 250 * time.Millisecond},
+		{name: "任务限速更严格", global: 100000, host: 100000, job: 20000, wantWait: 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewBandwidthManager()
+			manager.SetGlobalLimit(tt.global)
+			manager.SetHostLimit("example.com", tt.host)
+			manager.SetJobLimit("job-1", tt.job)
+
+			reader := manager.Throttle(context.Background(), bytes.NewReader(make([]byte, size)), "https://EXAMPLE.com/file.bin", "job-1")
+			start := time.Now()
+			n, err := io.Copy(io.Discard, reader)
+			if err != nil || n != size {
+				t.Fatalf("读取 %d 字节，error = %v，期望 %d 字节", n, err, size)
+			}
+			assertElapsed(t, time.Since(start), tt.wantWait)
+		})
+	}
+}
+
+func TestThrottleStopsWhenCancelled(t *testing.T) {
+	manager := NewBandwidthManager()
+	manager.SetJobLimit("job-1", 1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := io.Copy(io.Discard, manager.Throttle(ctx, bytes.NewReader(make([]byte, 1<<20)), "https://example.com/", "job-1"))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("读取 error = %v，期望 %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("取消后仍等待了 %v", elapsed)
+	}
+}
+
+// assertElapsed 检查耗时不少于期望等待时间的八成，且不超出太多
+func assertElapsed(t *testing.T, elapsed, want time.Duration) {
+	t.Helper()
+	if elapsed < want*8/10 || elapsed > want+300*time.Millisecond {
+		t.Errorf("耗时 %v，期望约 %v", elapsed, want)
+	}
+}
@@ -0,0 +1,159 @@
+package download
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const resourceCacheFile = ".resource_cache.json" // 输出目录下记录资源校验信息的文件
+
+// 资源相对上次运行的变化
+const (
+	ChangeNew       = "new"       // 首次下载
+	ChangeUpdated   = "updated"   // 远端资源已更新，重新下载
+	ChangeUnchanged = "unchanged" // 远端资源未变化，跳过下载
+)
+
+// errNotModified 表示资源自上次下载后未发生变化，任务应计为跳过
+var errNotModified = errors.New("资源未修改")
+
+var resourceCaches = make(map[string]*ResourceCache) // 按输出目录缓存的资源校验信息
+var resourceCachesLock sync.Mutex                    // 保护 resourceCaches 的并发访问
+
+// ResourceMeta 记录资源上次下载时服务器返回的校验信息
+type ResourceMeta struct {
+	ETag         string    `json:"etag"`
+	LastModified string    `json:"last_modified"`
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ResourceCache 保存一个输出目录下所有资源的 ETag 与 Last-Modified，用于条件请求
+type ResourceCache struct {
+	lock    sync.Mutex
+	path    string
+	entries map[string]ResourceMeta
+	dirty   bool
+}
+
+// ResourceCacheFor 返回输出目录对应的资源缓存，首次访问时从磁盘加载
+func ResourceCacheFor(outputDir string) *ResourceCache {
+	resourceCachesLock.Lock()
+	defer resourceCachesLock.Unlock()
+
+	key := filepath.Clean(outputDir)
+	if cache, ok := resourceCaches[key]; ok {
+		return cache
+	}
+
+	cache := &ResourceCache{
+		path:    filepath.Join(key, resourceCacheFile),
+		entries: make(map[string]ResourceMeta),
+	}
+	if data, err := os.ReadFile(cache.path); err == nil {
+		json.Unmarshal(data, &cache.entries)
+	}
+	resourceCaches[key] = cache
+	return cache
+}
+
+// Get 返回资源上次下载时的校验信息
+func (c *ResourceCache) Get(rawURL string) (ResourceMeta, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	meta, ok := c.entries[rawURL]
+	return meta, ok
+}
+
+// Put 更新资源的校验信息
+func (c *ResourceCache) Put(rawURL string, meta ResourceMeta) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	meta.UpdatedAt = time.Now()
+	c.entries[rawURL] = meta
+	c.dirty = true
+}
+
+// Save 将有变化的缓存写回磁盘，先写临时文件再重命名以保证原子性
+func (c *ResourceCache) Save() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// skipUnchanged 本地文件仍为最新时补全任务的大小与校验值，并返回 errNotModified
+func skipUnchanged(task *DownloadTask, downloader *ResourceDownloader, savePath string) error {
+	info, err := os.Stat(savePath)
+	if err != nil {
+		return fmt.Errorf("读取文件信息失败: %v", err)
+	}
+	sums, err := HashFile(savePath, downloader.Checksums)
+	if err != nil {
+		return fmt.Errorf("计算校验值失败: %v", err)
+	}
+	task.Size = info.Size()
+	task.Checksums = sums
+	return errNotModified
+}
+
+// recordResourceChange 对比上次下载记录判断资源的变化，并更新资源缓存
+func recordResourceChange(task *DownloadTask, downloader *ResourceDownloader) string {
+	cache := ResourceCacheFor(downloader.OutputDir)
+	previous, existed := cache.Get(task.URL)
+
+	change := ChangeNew
+	switch {
+	case task.Status == "skipped":
+		change = ChangeUnchanged
+	case existed && previous.SHA256 != "" && previous.SHA256 == task.SHA256:
+		change = ChangeUnchanged
+	case existed:
+		change = ChangeUpdated
+	}
+
+	meta := ResourceMeta{
+		ETag:   task.ETag,
+		Path:   path.Join(task.Type, task.Filename),
+		Size:   task.Size,
+		SHA256: task.SHA256,
+	}
+	if !task.LastModified.IsZero() {
+		meta.LastModified = task.LastModified.UTC().Format(http.TimeFormat)
+	}
+	if task.Status == "skipped" {
+		// 304 响应不一定携带校验信息，沿用上次记录的值
+		if meta.ETag == "" {
+			meta.ETag = previous.ETag
+		}
+		if meta.LastModified == "" {
+			meta.LastModified = previous.LastModified
+		}
+	}
+	cache.Put(task.URL, meta)
+	return change
+}
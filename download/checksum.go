@@ -0,0 +1,185 @@
+package download
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 支持的校验算法
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumMD5    = "md5"
+	ChecksumSHA1   = "sha1"
+)
+
+// Checksums 记录文件的各项校验值，SHA256 始终计算，MD5/SHA1 按需计算
+type Checksums struct {
+	SHA256 string `json:"sha256,omitempty"`
+	MD5    string `json:"md5,omitempty"`
+	SHA1   string `json:"sha1,omitempty"`
+}
+
+// multiHasher 在写入数据的同时计算多种校验值
+type multiHasher struct {
+	sha256 hash.Hash
+	md5    hash.Hash
+	sha1   hash.Hash
+	writer io.Writer
+}
+
+// newMultiHasher 根据额外算法列表创建校验计算器，未知算法会被忽略
+func newMultiHasher(extra []string) *multiHasher {
+	h := &multiHasher{sha256: sha256.New()}
+	writers := []io.Writer{h.sha256}
+	for _, algo := range extra {
+		switch strings.ToLower(algo) {
+		case ChecksumMD5:
+			if h.md5 == nil {
+				h.md5 = md5.New()
+				writers = append(writers, h.md5)
+			}
+		case ChecksumSHA1:
+			if h.sha1 == nil {
+				h.sha1 = sha1.New()
+				writers = append(writers, h.sha1)
+			}
+		}
+	}
+	h.writer = io.MultiWriter(writers...)
+	return h
+}
+
+// Write 实现 io.Writer 接口
+func (h *multiHasher) Write(p []byte) (int, error) {
+	return h.writer.Write(p)
+}
+
+// Sums 返回当前已写入数据的校验值
+func (h *multiHasher) Sums() Checksums {
+	sums := Checksums{SHA256: hex.EncodeToString(h.sha256.Sum(nil))}
+	if h.md5 != nil {
+		sums.MD5 = hex.EncodeToString(h.md5.Sum(nil))
+	}
+	if h.sha1 != nil {
+		sums.SHA1 = hex.EncodeToString(h.sha1.Sum(nil))
+	}
+	return sums
+}
+
+// HashFile 计算磁盘上文件的校验值
+func HashFile(path string, extra []string) (Checksums, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Checksums{}, err
+	}
+	defer file.Close()
+
+	h := newMultiHasher(extra)
+	if _, err := io.Copy(h, file); err != nil {
+		return Checksums{}, err
+	}
+	return h.Sums(), nil
+}
+
+// ValidateChecksumAlgorithms 校验额外算法列表是否均受支持
+func ValidateChecksumAlgorithms(algos []string) error {
+	for _, algo := range algos {
+		switch strings.ToLower(algo) {
+		case ChecksumSHA256, ChecksumMD5, ChecksumSHA1:
+		default:
+			return fmt.Errorf("不支持的校验算法: %s", algo)
+		}
+	}
+	return nil
+}
+
+// JobManifestDir 返回任务清单所在的目录 <输出目录>/.jobs/<任务 ID>，多个任务共享输出目录时互不覆盖
+func JobManifestDir(outputDir, jobID string) string {
+	return filepath.Join(outputDir, ".jobs", jobID)
+}
+
+// WriteJobManifest 在任务清单目录下写出 manifest.json 与 SHA256SUMS 文件
+// SHA256SUMS 中的路径相对于输出目录，可在输出目录下执行 sha256sum -c .jobs/<任务 ID>/SHA256SUMS
+func WriteJobManifest(outputDir string, manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := JobManifestDir(outputDir, manifest.JobID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建清单目录失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), data, 0644); err != nil {
+		return fmt.Errorf("写入清单文件失败: %v", err)
+	}
+
+	files := make([]ManifestFile, 0, len(manifest.Files))
+	for _, f := range manifest.Files {
+		if f.SHA256 != "" {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	var sb strings.Builder
+	for _, f := range files {
+		fmt.Fprintf(&sb, "%s  %s\n", f.SHA256, f.Path)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "SHA256SUMS"), []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("写入校验文件失败: %v", err)
+	}
+	return nil
+}
+
+// ReadJobManifest 读取任务清单目录下的 manifest.json
+func ReadJobManifest(outputDir, jobID string) (Manifest, error) {
+	var manifest Manifest
+	data, err := os.ReadFile(filepath.Join(JobManifestDir(outputDir, jobID), "manifest.json"))
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("解析清单文件失败: %v", err)
+	}
+	return manifest, nil
+}
+
+// VerifyResult 记录校验结果
+type VerifyResult struct {
+	Total    int      `json:"total"`
+	OK       int      `json:"ok"`
+	Missing  []string `json:"missing"`
+	Modified []string `json:"modified"`
+}
+
+// VerifyFiles 重新计算磁盘上文件的 SHA256 并与清单比对，报告缺失或被修改的文件
+func VerifyFiles(outputDir string, files []ManifestFile) VerifyResult {
+	result := VerifyResult{Missing: []string{}, Modified: []string{}}
+	for _, f := range files {
+		if f.SHA256 == "" {
+			continue
+		}
+		result.Total++
+
+		sums, err := HashFile(filepath.Join(outputDir, filepath.FromSlash(f.Path)), nil)
+		switch {
+		case os.IsNotExist(err):
+			result.Missing = append(result.Missing, f.Path)
+		case err != nil || sums.SHA256 != f.SHA256:
+			result.Modified = append(result.Modified, f.Path)
+		default:
+			result.OK++
+		}
+	}
+	return result
+}
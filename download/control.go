@@ -0,0 +1,167 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// errPaused 表示任务已暂停，下载中断并保留临时文件，恢复后从断点续传
+var errPaused = errors.New("任务已暂停")
+
+// JobControl 控制单个任务的暂停、恢复与取消，由任务的所有下载请求共享
+type JobControl struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lock        sync.Mutex
+	cond        *sync.Cond
+	paused      bool
+	keepPartial bool
+}
+
+// NewJobControl 创建任务控制器
+func NewJobControl() *JobControl {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &JobControl{ctx: ctx, cancel: cancel}
+	c.cond = sync.NewCond(&c.lock)
+	return c
+}
+
+// Context 返回任务的上下文，任务取消后所有使用它的 HTTP 请求随之中止
+func (c *JobControl) Context() context.Context {
+	return c.ctx
+}
+
+// Pause 暂停任务，正在进行的下载在下一次读取时断开连接并保留临时文件，恢复后从断点续传
+// 暂停期间不占用连接，也不会因服务器关闭空闲连接或读取超时而消耗重试次数
+func (c *JobControl) Pause() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.paused = true
+}
+
+// Resume 恢复任务，唤醒所有挂起的读取
+func (c *JobControl) Resume() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.paused = false
+	c.cond.Broadcast()
+}
+
+// Paused 判断任务是否处于暂停状态
+func (c *JobControl) Paused() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.paused
+}
+
+// Cancel 取消任务并中止进行中的请求；keepPartial 为 true 时保留临时文件供以后续传
+func (c *JobControl) Cancel(keepPartial bool) {
+	c.lock.Lock()
+	c.keepPartial = keepPartial
+	c.paused = false
+	c.cond.Broadcast()
+	c.lock.Unlock()
+	c.cancel()
+}
+
+// Cancelled 判断任务是否已取消
+func (c *JobControl) Cancelled() bool {
+	return c.ctx.Err() != nil
+}
+
+// KeepPartial 判断取消任务时是否保留临时文件
+func (c *JobControl) KeepPartial() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.keepPartial
+}
+
+// Wait 任务暂停时阻塞直到恢复或取消，任务已取消时返回上下文错误
+func (c *JobControl) Wait() error {
+	c.lock.Lock()
+	for c.paused && c.ctx.Err() == nil {
+		c.cond.Wait()
+	}
+	c.lock.Unlock()
+	return c.ctx.Err()
+}
+
+// Reader 包装响应体，读取前检查任务是否暂停或取消，暂停时返回 errPaused
+func (c *JobControl) Reader(r io.Reader) io.Reader {
+	return &controlledReader{r: r, control: c}
+}
+
+// controlledReader 受任务控制器约束的读取器
+type controlledReader struct {
+	r       io.Reader
+	control *JobControl
+}
+
+// Read 实现 io.Reader 接口
+func (cr *controlledReader) Read(p []byte) (int, error) {
+	if err := cr.control.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if cr.control.Paused() {
+		return 0, errPaused
+	}
+	return cr.r.Read(p)
+}
+
+// context 返回下载器所属任务的上下文，未关联任务时返回 Background
+func (d *ResourceDownloader) context() context.Context {
+	if d.Control == nil {
+		return context.Background()
+	}
+	return d.Control.Context()
+}
+
+// controlled 为响应体附加任务的暂停与取消控制
+func (d *ResourceDownloader) controlled(r io.Reader) io.Reader {
+	if d.Control == nil {
+		return r
+	}
+	return d.Control.Reader(r)
+}
+
+// sleep 等待指定时长，任务取消时提前返回上下文错误
+func (d *ResourceDownloader) sleep(wait time.Duration) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-d.context().Done():
+		return d.context().Err()
+	}
+}
+
+// cancelTask 将任务记为已取消，未要求保留时删除下载到一半的临时文件，返回文件的下载结果
+func cancelTask(task DownloadTask, downloader *ResourceDownloader, progress *Progress, taskStatuses *[]TaskStatus) DownloadHistoryEntry {
+	task.EndTime = time.Now()
+	task.Status = "cancelled"
+
+	if downloader.Control == nil || !downloader.Control.KeepPartial() {
+		removePartial(filepath.Join(downloader.OutputDir, task.Type, task.Filename))
+	}
+
+	TaskStatusLock.Lock()
+	for index := range *taskStatuses {
+		if (*taskStatuses)[index].URL == task.URL {
+			(*taskStatuses)[index].Status = task.Status
+			finishTransfer(&(*taskStatuses)[index], 0, false)
+			break
+		}
+	}
+	TaskStatusLock.Unlock()
+
+	progress.Lock.Lock()
+	progress.Cancelled++
+	progress.Lock.Unlock()
+	return task.historyEntry()
+}
@@ -3,7 +3,9 @@ package download
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -21,22 +23,30 @@ import (
 	"golang.org/x/text/transform"
 )
 
-var TaskStatusLock sync.Mutex              // 公共锁变量，保护并发访问任务状态
-var DownloadHistory []DownloadHistoryEntry // 存储下载历史记录
-var HistoryLock sync.Mutex                 // 保护下载历史记录的并发访问
-var downloader *ResourceDownloader         // 资源下载器实例
+var TaskStatusLock sync.Mutex      // 公共锁变量，保护并发访问任务状态
+var downloader *ResourceDownloader // 资源下载器实例
 
 // ResourceDownloader 定义资源下载器的结构体，包含下载所需的各种配置和客户端
 type ResourceDownloader struct {
-	BaseURL       *url.URL      // 目标网页的URL
-	OutputDir     string        // 下载文件存放目录
-	MaxConcurrent int           // 最大并发下载数
-	FileTypes     []string      // 允许下载的文件类型
-	Client        *http.Client  // HTTP客户端
-	LogFile       *os.File      // 日志文件
-	UserAgent     string        // 用户代理
-	RetryTimes    int           // 下载失败重试次数
-	Timeout       time.Duration // 请求超时时间
+	BaseURL          *url.URL      // 目标网页的URL
+	OutputDir        string        // 下载文件存放目录
+	MaxConcurrent    int           // 最大并发下载数
+	FileTypes        []string      // 允许下载的文件类型
+	Client           *http.Client  // HTTP客户端
+	Proxy            *url.URL      // 代理地址，为空时直连
+	Logger           *Logger       // 日志，任务的下载器附加了 job_id 字段
+	UserAgent        string        // 用户代理
+	RetryTimes       int           // 下载失败重试次数
+	Timeout          time.Duration // 等待响应头与每次读取数据的超时时间，不限制整个下载的时长
+	Checksums        []string      // 除 SHA256 外额外计算的校验算法(md5、sha1)
+	Segments         int           // 分段下载的连接数，不大于 1 时禁用分段下载
+	SegmentThreshold int64         // 启用分段下载的最小文件大小(字节)
+	RetryPolicy      *RetryPolicy  // 重试策略，为空时使用默认策略并以 RetryTimes 作为最大重试次数
+	Control          *JobControl   // 所属任务的暂停与取消控制，为空时不受控制
+	Events           *EventLog     // 所属任务的事件缓冲区，为空时不发布事件
+
+	Headers       map[string]string // 任务指定的额外请求头，覆盖同名的默认请求头
+	RefererPolicy string            // Referer 策略(page/origin/none)，为空时为 page
 }
 
 // DownloadTask 定义下载任务的结构体，包含任务的各种信息
@@ -51,6 +61,12 @@ type DownloadTask struct {
 	StartTime    time.Time // 开始时间
 	EndTime      time.Time // 结束时间
 	HistoryID    string    // 历史记录 ID
+	ETag         string    // 服务器返回的 ETag
+	Change       string    // 相对上次运行的变化(new/updated/unchanged)
+	ErrorClass   string    // 最终失败的错误分类
+	Error        string    // 最终失败的错误信息
+	Priority     int       // 调度优先级，数值越大越先下载
+	Checksums              // 文件校验值
 }
 
 // Progress 定义下载进度的结构体，记录下载任务的总体进度
@@ -59,6 +75,7 @@ type Progress struct {
 	Completed int       // 已完成数
 	Failed    int       // 失败数
 	Skipped   int       // 跳过数
+	Cancelled int       // 取消数
 	StartTime time.Time // 开始时间
 	Lock      sync.Mutex
 }
@@ -72,27 +89,44 @@ type APIResponse struct {
 
 // TaskStatus 定义任务状态的结构体，记录每个下载任务的详细状态
 type TaskStatus struct {
-	URL          string `json:"url"`
-	Filename     string `json:"filename"`
-	Type         string `json:"type"`
-	Size         int64  `json:"size"`
-	Status       string `json:"status"`
-	RetryCount   int    `json:"retry_count"`
-	LastModified string `json:"last_modified"`
+	URL          string  `json:"url"`
+	Filename     string  `json:"filename"`
+	Type         string  `json:"type"`
+	Size         int64   `json:"size"`
+	Status       string  `json:"status"`
+	RetryCount   int     `json:"retry_count"`
+	LastModified string  `json:"last_modified"`
+	Change       string  `json:"change,omitempty"`
+	ErrorClass   string  `json:"error_class,omitempty"`
+	Error        string  `json:"error,omitempty"`
+	BytesDone    int64   `json:"bytes_done"`    // 已接收的字节数
+	BytesTotal   int64   `json:"bytes_total"`   // 文件总字节数，未知时为 0
+	Speed        float64 `json:"speed"`         // 瞬时速度(字节/秒)
+	AvgSpeed     float64 `json:"avg_speed"`     // 移动平均速度(字节/秒)
+	ETA          float64 `json:"eta,omitempty"` // 预计剩余秒数，总大小未知时省略
+	Priority     int     `json:"priority"`      // 调度优先级，数值越大越先下载
+	Checksums
 }
 
 // DownloadProgress 定义下载进度信息的结构体，用于返回给客户端
 type DownloadProgress struct {
-	Total     int          `json:"total"`
-	Completed int          `json:"completed"`
-	Failed    int          `json:"failed"`
-	Skipped   int          `json:"skipped"`
-	Duration  string       `json:"duration"`
-	Tasks     []TaskStatus `json:"tasks"`
-	Rate      float64      `json:"rate"`
+	Total      int          `json:"total"`
+	Completed  int          `json:"completed"`
+	Failed     int          `json:"failed"`
+	Skipped    int          `json:"skipped"`
+	Cancelled  int          `json:"cancelled"`
+	Status     string       `json:"status,omitempty"`
+	Duration   string       `json:"duration"`
+	Tasks      []TaskStatus `json:"tasks"`
+	Rate       float64      `json:"rate"`
+	BytesDone  int64        `json:"bytes_done"`  // 所有文件已接收的字节数
+	BytesTotal int64        `json:"bytes_total"` // 已知大小的文件总字节数
+	Speed      float64      `json:"speed"`       // 下载中文件的瞬时速度之和(字节/秒)
+	AvgSpeed   float64      `json:"avg_speed"`   // 下载中文件的移动平均速度之和(字节/秒)
+	SpeedMBps  float64      `json:"speed_mbps"`  // 瞬时速度(MB/秒)
 }
 
-// 历史记录结构体，记录每个下载任务的详细历史信息
+// DownloadHistoryEntry 单个文件的下载结果，保存在所属任务的历史记录中
 type DownloadHistoryEntry struct {
 	URL          string    `json:"url"`
 	Filename     string    `json:"filename"`
@@ -103,6 +137,16 @@ type DownloadHistoryEntry struct {
 	EndTime      time.Time `json:"end_time"`
 	RetryCount   int       `json:"retry_count"`
 	LastModified time.Time `json:"last_modified"`
+	HistoryID    string    `json:"history_id"`
+	Change       string    `json:"change,omitempty"`
+	ErrorClass   string    `json:"error_class,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	Checksums
+}
+
+// HasFile 判断记录对应的文件是否保存在本地(下载完成或因资源未变化而跳过)
+func (e DownloadHistoryEntry) HasFile() bool {
+	return e.Status == "completed" || e.Status == "skipped"
 }
 
 // fileExtensions 定义不同资源类型对应的文件扩展名映射
@@ -123,11 +167,13 @@ var fileExtensions = map[string][]string{
 // NewResourceDownloader 创建一个新的资源下载器实例，使用默认配置
 func NewResourceDownloader() *ResourceDownloader {
 	return &ResourceDownloader{
-		UserAgent:     "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/110.0.0.0 Safari/537.36",
-		OutputDir:     "./download_data",
-		MaxConcurrent: 5,
-		RetryTimes:    5,
-		Timeout:       40 * time.Second,
+		UserAgent:        "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/110.0.0.0 Safari/537.36",
+		OutputDir:        "./download_data",
+		MaxConcurrent:    5,
+		RetryTimes:       5,
+		Timeout:          40 * time.Second,
+		Segments:         DefaultSegments,
+		SegmentThreshold: DefaultSegmentThreshold,
 	}
 }
 
@@ -142,6 +188,7 @@ func (d *ResourceDownloader) GetHTTPClient() *http.Client {
 // createHTTPClient 创建一个新的 HTTP 客户端实例，配置 TLS 连接和连接池
 func (d *ResourceDownloader) createHTTPClient() *http.Client {
 	transport := &http.Transport{
+		Proxy: http.ProxyURL(d.Proxy),
 		TLSClientConfig: &tls.Config{
 			MinVersion: tls.VersionTLS12,
 			CurvePreferences: []tls.CurveID{
@@ -158,11 +205,13 @@ func (d *ResourceDownloader) createHTTPClient() *http.Client {
 		MaxIdleConns:        d.MaxConcurrent * 2,
 		MaxIdleConnsPerHost: d.MaxConcurrent,
 		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
 	}
 
+	// 不设置 Client.Timeout：它限制包括读取响应体在内的整个请求，限速下的大文件会被中途中断
+	// 请求超时由 doRequest 按下载器的 Timeout 分别限制等待响应头与每次读取的时间
 	client := &http.Client{
-		Timeout:   d.Timeout,
-		Transport: transport,
+		Transport: &metricsTransport{base: transport},
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return nil
 		},
@@ -171,74 +220,68 @@ func (d *ResourceDownloader) createHTTPClient() *http.Client {
 	return client
 }
 
-// FetchHTML 获取目标网页的 HTML 内容，包含重试逻辑
+// FetchHTML 获取目标网页的 HTML 内容，失败时与资源下载使用相同的重试策略、错误分类与退避等待
 func (d *ResourceDownloader) FetchHTML() (string, error) {
-	maxRetries := 3
-	for i := 0; i < maxRetries; i++ {
-		client := d.GetHTTPClient()
-
-		req, err := http.NewRequest("GET", d.BaseURL.String(), nil)
-		if err != nil {
-			if i == maxRetries-1 {
-				return "", fmt.Errorf("创建请求失败: %v", err)
+	policy := d.retryPolicy()
+	for i := 0; ; i++ {
+		content, err := d.fetchHTMLOnce()
+		if err == nil {
+			utf8Content, err := convertToUTF8(content)
+			if err != nil {
+				return "", fmt.Errorf("编码转换失败: %v", err)
 			}
-			continue
+			return string(utf8Content), nil
 		}
-		req.Header.Set("User-Agent", d.UserAgent)
-		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8")
-		req.Header.Set("Accept-Language", "zh-CN,zh;q=0.8,en-US;q=0.5,en;q=0.3")
-		req.Header.Set("Accept-Encoding", "gzip, deflate, br")
-		req.Header.Set("Referer", d.BaseURL.String())
 
-		resp, err := client.Do(req)
-		if err != nil {
-			if i == maxRetries-1 {
-				return "", fmt.Errorf("请求失败: %v", err)
-			}
-			continue
+		if !policy.ShouldRetry(err, i) {
+			return "", err
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			if i == maxRetries-1 {
-				return "", fmt.Errorf("HTTP状态码错误: %d", resp.StatusCode)
-			}
-			continue
+		wait := policy.Backoff(i, err)
+		retriesTotal.Inc(ClassifyError(err))
+		d.logger().Warn("获取网页失败，等待重试", "url", d.BaseURL.String(), "error_class", ClassifyError(err),
+			"retry_count", i+1, "retry_in_ms", wait.Milliseconds(), "error", err)
+		if err := d.sleep(wait); err != nil {
+			return "", err
 		}
+	}
+}
 
-		var reader io.Reader
-		switch resp.Header.Get("Content-Encoding") {
-		case "gzip":
-			gz, err := gzip.NewReader(resp.Body)
-			if err != nil {
-				if i == maxRetries-1 {
-					return "", fmt.Errorf("解压响应体失败: %v", err)
-				}
-				continue
-			}
-			defer gz.Close()
-			reader = gz
-		default:
-			reader = resp.Body
-		}
+// fetchHTMLOnce 请求一次目标网页并返回响应体，非 200 响应返回 *HTTPStatusError
+func (d *ResourceDownloader) fetchHTMLOnce() ([]byte, error) {
+	req, err := http.NewRequestWithContext(d.context(), "GET", d.BaseURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8")
+	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.8,en-US;q=0.5,en;q=0.3")
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	d.setRequestHeaders(req)
 
-		content, err := io.ReadAll(reader)
-		if err != nil {
-			if i == maxRetries-1 {
-				return "", fmt.Errorf("读取响应体失败: %v", err)
-			}
-			continue
-		}
+	resp, err := d.doRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
 
-		utf8Content, err := convertToUTF8(content)
+	if resp.StatusCode != http.StatusOK {
+		return nil, newHTTPStatusError(resp)
+	}
+
+	var reader io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
 		if err != nil {
-			return "", fmt.Errorf("编码转换失败: %v", err)
+			return nil, fmt.Errorf("解压响应体失败: %w", err)
 		}
-
-		return string(utf8Content), nil
+		defer gz.Close()
+		reader = gz
 	}
 
-	return "", fmt.Errorf("达到最大重试次数，仍未成功获取HTML")
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应体失败: %w", err)
+	}
+	return content, nil
 }
 
 // ExtractResources 从 HTML 内容中提取可下载的资源任务
@@ -370,36 +413,40 @@ func (d *ResourceDownloader) ProcessTasks(tasks []DownloadTask) ([]DownloadTask,
 	return uniqueTasks, nil
 }
 
-// DownloadWithRetry 带有重试逻辑的下载函数，尝试多次下载任务
-func DownloadWithRetry(task DownloadTask, downloader *ResourceDownloader, progress *Progress, taskStatuses *[]TaskStatus) {
+// DownloadWithRetry 带有重试逻辑的下载函数，按重试策略对可恢复的错误进行指数退避重试
+// 资源未变化时任务计为跳过，并记录资源相对上次运行的变化；返回文件的下载结果
+func DownloadWithRetry(task DownloadTask, downloader *ResourceDownloader, progress *Progress, taskStatuses *[]TaskStatus) DownloadHistoryEntry {
 	task.StartTime = time.Now()
+	policy := downloader.retryPolicy()
 	var lastErr error
-	for i := 0; i <= downloader.RetryTimes; i++ {
+	for i := 0; ; i++ {
+		// 任务暂停时等待恢复后再发起请求
+		if downloader.Control != nil {
+			if err := downloader.Control.Wait(); err != nil {
+				lastErr = err
+				break
+			}
+		}
+
 		task.RetryCount = i
-		if err := DownloadResource(task, downloader, progress, taskStatuses); err == nil {
+		err := DownloadResource(&task, downloader, progress, taskStatuses)
+		if err == nil || errors.Is(err, errNotModified) {
 			task.EndTime = time.Now()
 			task.Status = "completed"
-
-			HistoryLock.Lock()
-			DownloadHistory = append(DownloadHistory, DownloadHistoryEntry{
-				URL:          task.URL,
-				Filename:     task.Filename,
-				Type:         task.Type,
-				Size:         task.Size,
-				Status:       task.Status,
-				StartTime:    task.StartTime,
-				EndTime:      task.EndTime,
-				RetryCount:   task.RetryCount,
-				LastModified: task.LastModified,
-			})
-
-			HistoryLock.Unlock()
+			if err != nil {
+				task.Status = "skipped"
+			}
+			task.Change = recordResourceChange(&task, downloader)
 
 			TaskStatusLock.Lock()
 			for index := range *taskStatuses {
 				if (*taskStatuses)[index].URL == task.URL {
-					(*taskStatuses)[index].Status = "completed"
+					(*taskStatuses)[index].Status = task.Status
 					(*taskStatuses)[index].RetryCount = i
+					(*taskStatuses)[index].Size = task.Size
+					(*taskStatuses)[index].Change = task.Change
+					(*taskStatuses)[index].Checksums = task.Checksums
+					finishTransfer(&(*taskStatuses)[index], task.Size, true)
 					if !task.LastModified.IsZero() {
 						(*taskStatuses)[index].LastModified = task.LastModified.Format(time.RFC3339)
 					}
@@ -409,39 +456,60 @@ func DownloadWithRetry(task DownloadTask, downloader *ResourceDownloader, progre
 			TaskStatusLock.Unlock()
 
 			progress.Lock.Lock()
-			progress.Completed++
+			if task.Status == "skipped" {
+				progress.Skipped++
+			} else {
+				progress.Completed++
+			}
 			progress.Lock.Unlock()
-			return
-		} else {
+			return task.historyEntry()
+		}
+
+		// 暂停时已断开连接并保留临时文件，恢复后从断点继续，不计入重试次数
+		if errors.Is(err, errPaused) {
+			i--
+			continue
+		}
+
+		lastErr = err
+		if !policy.ShouldRetry(err, i) {
+			break
+		}
+		wait := policy.Backoff(i, err)
+		retriesTotal.Inc(ClassifyError(err))
+		downloader.logger().Warn("下载失败，等待重试", "task", task.URL, "error_class", ClassifyError(err),
+			"retry_count", i+1, "retry_in_ms", wait.Milliseconds(), "error", err)
+		downloader.publishProgress(task.URL, TaskRetryEvent{
+			URL:        task.URL,
+			Status:     "retrying",
+			RetryCount: i + 1,
+			RetryIn:    wait.Milliseconds(),
+			ErrorClass: ClassifyError(err),
+			Error:      err.Error(),
+		})
+		if err := downloader.sleep(wait); err != nil {
 			lastErr = err
-			if i < downloader.RetryTimes {
-				time.Sleep(time.Duration(i+1) * time.Second)
-			}
+			break
 		}
 	}
 
+	if errors.Is(lastErr, context.Canceled) || (downloader.Control != nil && downloader.Control.Cancelled()) {
+		return cancelTask(task, downloader, progress, taskStatuses)
+	}
+
 	task.EndTime = time.Now()
 	task.Status = "failed"
-
-	HistoryLock.Lock()
-	DownloadHistory = append(DownloadHistory, DownloadHistoryEntry{
-		URL:          task.URL,
-		Filename:     task.Filename,
-		Type:         task.Type,
-		Size:         task.Size,
-		Status:       task.Status,
-		StartTime:    task.StartTime,
-		EndTime:      task.EndTime,
-		RetryCount:   task.RetryCount,
-		LastModified: task.LastModified,
-	})
-	HistoryLock.Unlock()
+	task.ErrorClass = ClassifyError(lastErr)
+	task.Error = lastErr.Error()
 
 	TaskStatusLock.Lock()
 	for index := range *taskStatuses {
 		if (*taskStatuses)[index].URL == task.URL {
 			(*taskStatuses)[index].Status = "failed"
-			(*taskStatuses)[index].RetryCount = downloader.RetryTimes
+			(*taskStatuses)[index].RetryCount = task.RetryCount
+			(*taskStatuses)[index].ErrorClass = task.ErrorClass
+			(*taskStatuses)[index].Error = task.Error
+			finishTransfer(&(*taskStatuses)[index], 0, false)
 			break
 		}
 	}
@@ -451,86 +519,191 @@ func DownloadWithRetry(task DownloadTask, downloader *ResourceDownloader, progre
 	progress.Failed++
 	progress.Lock.Unlock()
 
-	LogError(downloader.LogFile, fmt.Sprintf("下载失败: %s", lastErr.Error()))
+	downloader.logger().Error("下载失败", "task", task.URL, "error_class", task.ErrorClass,
+		"retry_count", task.RetryCount, "error", lastErr)
+	return task.historyEntry()
 }
 
-// DownloadResource 下载单个资源任务，处理文件保存和错误处理
-func DownloadResource(task DownloadTask, downloader *ResourceDownloader, progress *Progress, taskStatuses *[]TaskStatus) error {
+// historyEntry 将任务转换为文件的下载结果
+func (t DownloadTask) historyEntry() DownloadHistoryEntry {
+	return DownloadHistoryEntry{
+		URL:          t.URL,
+		Filename:     t.Filename,
+		Type:         t.Type,
+		Size:         t.Size,
+		Status:       t.Status,
+		StartTime:    t.StartTime,
+		EndTime:      t.EndTime,
+		RetryCount:   t.RetryCount,
+		LastModified: t.LastModified,
+		HistoryID:    t.HistoryID,
+		Change:       t.Change,
+		ErrorClass:   t.ErrorClass,
+		Error:        t.Error,
+		Checksums:    t.Checksums,
+	}
+}
+
+// DownloadResource 下载单个资源任务，处理文件保存和错误处理，并在写入时计算校验值
+// 数据先写入 <name>.part，完成后原子重命名；中断后再次调用会通过 Range/If-Range 从断点继续
+func DownloadResource(task *DownloadTask, downloader *ResourceDownloader, progress *Progress, taskStatuses *[]TaskStatus) error {
 	saveDir := filepath.Join(downloader.OutputDir, task.Type)
 	if err := os.MkdirAll(saveDir, 0755); err != nil {
 		return fmt.Errorf("创建目录失败: %v", err)
 	}
 
 	savePath := filepath.Join(saveDir, task.Filename)
-	if info, err := os.Stat(savePath); err == nil {
-		if task.Size > 0 && info.Size() == task.Size {
-			return nil
+	meter := newTransferMeter(task, downloader, taskStatuses)
+	info, statErr := os.Stat(savePath)
+	if statErr == nil && task.Size > 0 && info.Size() == task.Size {
+		return skipUnchanged(task, downloader, savePath)
+	}
+
+	// 本地文件存在且记录过校验信息时发起条件请求，资源未变化则跳过下载
+	cached, conditional := ResourceCacheFor(downloader.OutputDir).Get(task.URL)
+	conditional = conditional && statErr == nil && (cached.ETag != "" || cached.LastModified != "")
+
+	// 继续上次未完成的分段下载
+	if !conditional {
+		if handled, err := downloader.resumeSegmentedDownload(task, savePath, meter); handled {
+			return err
 		}
 	}
 
-	req, err := http.NewRequest("GET", task.URL, nil)
+	// 检查是否存在可续传的临时文件
+	offset, meta := resumeOffset(savePath, task.URL)
+
+	req, err := http.NewRequestWithContext(downloader.context(), "GET", task.URL, nil)
 	if err != nil {
 		return fmt.Errorf("创建请求失败: %v", err)
 	}
-	req.Header.Set("User-Agent", downloader.UserAgent)
+	downloader.setRequestHeaders(req)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", meta.ifRangeValidator())
+	} else if conditional {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
 
-	resp, err := downloader.GetHTTPClient().Do(req)
+	resp, err := downloader.doRequest(req)
 	if err != nil {
-		return fmt.Errorf("请求失败: %v", err)
+		return fmt.Errorf("请求失败: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP状态码错误: %d", resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// 服务器忽略了范围请求或资源已变化，从头开始下载
+		offset = 0
+	case http.StatusNotModified:
+		task.ETag = cached.ETag
+		return skipUnchanged(task, downloader, savePath)
+	case http.StatusPartialContent:
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			removePartial(savePath)
+			return fmt.Errorf("续传偏移不匹配: %s", resp.Header.Get("Content-Range"))
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// 临时文件已失效，清理后重新下载
+		removePartial(savePath)
+		if offset > 0 {
+			resp.Body.Close()
+			return DownloadResource(task, downloader, progress, taskStatuses)
+		}
+		return newHTTPStatusError(resp)
+	default:
+		return newHTTPStatusError(resp)
 	}
 
-	file, err := os.Create(savePath)
+	// 大文件在首个响应表明支持范围请求时改为多连接分段下载，该响应作为第一个分段，不额外发送探测请求
+	if offset == 0 && downloader.canSegment(task, resp) {
+		err := downloader.startSegmentedDownload(task, savePath, meter, resp)
+		if !errors.Is(err, errRangeUnsupported) {
+			return err
+		}
+		// 服务器未按预期响应范围请求，以单连接重新下载
+		resp.Body.Close()
+		single := *downloader
+		single.Segments = 1
+		return DownloadResource(task, &single, progress, taskStatuses)
+	}
+
+	// 记录远端资源的校验信息，供后续续传使用
+	meta = partMeta{
+		URL:          task.URL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if err := savePartMeta(savePath, meta); err != nil {
+		return fmt.Errorf("写入续传信息失败: %v", err)
+	}
+	task.ETag = meta.ETag
+	if lastModified, err := http.ParseTime(meta.LastModified); err == nil {
+		task.LastModified = lastModified
+	}
+
+	// 文本类型需在下载完成后整体转换编码，校验值以转换后的内容为准
+	hasher := newMultiHasher(downloader.Checksums)
+	var streamHasher io.Writer = hasher
+	if isTextType(task.Type) {
+		streamHasher = io.Discard
+	}
+
+	file, err := openPartFile(savePath, offset, resp, streamHasher)
 	if err != nil {
-		return fmt.Errorf("创建文件失败: %v", err)
+		return err
 	}
 
-	defer func() {
-		if cerr := file.Close(); cerr != nil && err == nil {
-			err = fmt.Errorf("关闭文件失败: %v", cerr)
-		}
-	}()
+	total := int64(0)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	meter.Start(offset, total)
 
-	// 添加断点续传支持
-	if info, err := os.Stat(savePath); err == nil {
-		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", info.Size()))
-		if resp.StatusCode == http.StatusPartialContent {
-			file, err = os.OpenFile(savePath, os.O_APPEND|os.O_WRONLY, 0644)
-			if err != nil {
-				return fmt.Errorf("打开文件失败: %v", err)
-			}
-			file.Seek(0, io.SeekEnd)
-		}
+	// 下载中断时保留临时文件，供重试或重启后续传
+	body := meter.Reader(downloader.controlled(Bandwidth.Throttle(downloader.context(), resp.Body, task.URL, task.HistoryID)))
+	if _, err := io.Copy(io.MultiWriter(file, streamHasher), body); err != nil {
+		file.Close()
+		return fmt.Errorf("下载失败: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("关闭文件失败: %v", err)
 	}
 
 	if isTextType(task.Type) {
-		content, err := io.ReadAll(resp.Body)
+		content, err := os.ReadFile(partPath(savePath))
 		if err != nil {
-			os.Remove(savePath)
 			return fmt.Errorf("读取内容失败: %v", err)
 		}
 
 		utf8Content, err := convertToUTF8(content)
 		if err != nil {
-			os.Remove(savePath)
+			removePartial(savePath)
 			return fmt.Errorf("编码转换失败: %v", err)
 		}
 
-		if _, err := file.Write(utf8Content); err != nil {
-			os.Remove(savePath)
+		if err := os.WriteFile(partPath(savePath), utf8Content, 0644); err != nil {
 			return fmt.Errorf("写入文件失败: %v", err)
 		}
-	} else {
-		if _, err := io.Copy(file, resp.Body); err != nil {
-			os.Remove(savePath)
-			return fmt.Errorf("下载失败: %v", err)
-		}
+		hasher.Write(utf8Content)
 	}
 
+	info, err = os.Stat(partPath(savePath))
+	if err != nil {
+		return fmt.Errorf("读取文件信息失败: %v", err)
+	}
+	if err := os.Rename(partPath(savePath), savePath); err != nil {
+		return fmt.Errorf("重命名文件失败: %v", err)
+	}
+	os.Remove(partMetaPath(savePath))
+
+	task.Size = info.Size()
+	task.Checksums = hasher.Sums()
 	return nil
 }
 
@@ -713,25 +886,18 @@ func convertToUTF8(content []byte) ([]byte, error) {
 	return io.ReadAll(reader)
 }
 
-// GetDownloadHistory 获取下载历史记录，使用锁保护并发访问
-func GetDownloadHistory() []DownloadHistoryEntry {
-	HistoryLock.Lock()
-	defer HistoryLock.Unlock()
-	return DownloadHistory
-}
-
-// SetProxy 支持设置代理配置
+// SetProxy 支持设置代理配置，为空时取消代理，之后使用新建的 HTTP 客户端
 func (d *ResourceDownloader) SetProxy(proxyURL string) error {
-	proxy, err := url.Parse(proxyURL)
-	if err != nil {
-		return err
+	var proxy *url.URL
+	if proxyURL != "" {
+		parsed, err := url.Parse(proxyURL)
+		if err != nil {
+			return err
+		}
+		proxy = parsed
 	}
 
-	d.Client = &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(proxy),
-		},
-		Timeout: d.Timeout,
-	}
+	d.Proxy = proxy
+	d.Client = d.createHTTPClient()
 	return nil
 }
@@ -0,0 +1,183 @@
+package download
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// 任务事件类型
+const (
+	EventTaskStarted   = "task_started"   // 文件开始下载
+	EventTaskProgress  = "task_progress"  // 文件下载过程中的状态变化
+	EventTaskCompleted = "task_completed" // 文件下载完成或因未变化而跳过
+	EventTaskFailed    = "task_failed"    // 文件下载失败或被取消
+	EventJobFinished   = "job_finished"   // 任务所有文件均已结束
+)
+
+const eventLogCapacity = 1000 // 每个任务保留的最近事件数，不含进度事件
+
+// JobEvent 任务事件，ID 在任务内单调递增
+type JobEvent struct {
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// TaskStartedEvent 文件开始下载事件的数据
+type TaskStartedEvent struct {
+	URL      string `json:"url"`
+	Filename string `json:"filename"`
+	Type     string `json:"type"`
+}
+
+// TaskRetryEvent 文件下载出错、即将重试时的事件数据
+type TaskRetryEvent struct {
+	URL        string `json:"url"`
+	Status     string `json:"status"`
+	RetryCount int    `json:"retry_count"`
+	RetryIn    int64  `json:"retry_in_ms"`
+	ErrorClass string `json:"error_class"`
+	Error      string `json:"error"`
+}
+
+// EventLog 保存任务最近事件的环形缓冲区，断线重连的客户端可从指定事件之后继续接收
+// 进度事件发布频繁，不写入缓冲区，每个文件只保留最近一次，避免覆盖文件开始、结束等状态事件
+type EventLog struct {
+	lock        sync.Mutex
+	events      []JobEvent
+	start       int                 // 最早事件在缓冲区中的位置
+	lastID      uint64              // 最近一次发布的事件 ID
+	dropped     uint64              // 最近一次被覆盖的事件 ID
+	progress    map[string]JobEvent // 每个文件最近一次的进度事件
+	finished    bool
+	subscribers map[chan struct{}]struct{}
+}
+
+// NewEventLog 创建事件缓冲区
+func NewEventLog() *EventLog {
+	return &EventLog{
+		events:      make([]JobEvent, 0, eventLogCapacity),
+		progress:    make(map[string]JobEvent),
+		subscribers: make(map[chan struct{}]struct{}),
+	}
+}
+
+// Publish 发布事件并通知所有订阅者，缓冲区已满时覆盖最早的事件
+func (l *EventLog) Publish(eventType string, data interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.publishLocked(eventType, data)
+}
+
+// PublishProgress 发布文件的进度事件并通知所有订阅者，替换该文件之前的进度事件
+func (l *EventLog) PublishProgress(taskURL string, data interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.lastID++
+	l.progress[taskURL] = JobEvent{ID: l.lastID, Type: EventTaskProgress, Time: time.Now(), Data: data}
+	l.notifyLocked()
+}
+
+// Finish 发布任务结束事件，重复调用时只发布一次
+func (l *EventLog) Finish(data interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.finished {
+		return
+	}
+	l.finished = true
+	l.publishLocked(EventJobFinished, data)
+}
+
+// publishLocked 写入事件并唤醒订阅者，调用方需持有锁
+func (l *EventLog) publishLocked(eventType string, data interface{}) {
+	l.lastID++
+	event := JobEvent{ID: l.lastID, Type: eventType, Time: time.Now(), Data: data}
+	if len(l.events) < eventLogCapacity {
+		l.events = append(l.events, event)
+	} else {
+		l.dropped = l.events[l.start].ID
+		l.events[l.start] = event
+		l.start = (l.start + 1) % eventLogCapacity
+	}
+	l.notifyLocked()
+}
+
+// notifyLocked 唤醒所有订阅者，调用方需持有锁
+func (l *EventLog) notifyLocked() {
+	for ch := range l.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// 已有未处理的通知，订阅者会一并读取新事件
+		}
+	}
+}
+
+// Since 按 ID 顺序返回 ID 大于 lastID 的事件，每个文件的进度事件只返回最近一次
+// lastID 之后有事件已被覆盖时 complete 为 false；被替换的进度事件不影响 complete
+// lastID 大于最近的事件 ID 时(如服务重启后事件重新编号)返回缓冲区中的全部事件
+func (l *EventLog) Since(lastID uint64) (events []JobEvent, complete bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if lastID > l.lastID {
+		lastID = 0
+	}
+	complete = l.dropped <= lastID
+	for i := 0; i < len(l.events); i++ {
+		event := l.events[(l.start+i)%len(l.events)]
+		if event.ID > lastID {
+			events = append(events, event)
+		}
+	}
+
+	merged := false
+	for _, event := range l.progress {
+		if event.ID > lastID {
+			events = append(events, event)
+			merged = true
+		}
+	}
+	if merged {
+		sort.Slice(events, func(a, b int) bool { return events[a].ID < events[b].ID })
+	}
+	return events, complete
+}
+
+// Finished 判断任务结束事件是否已发布
+func (l *EventLog) Finished() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.finished
+}
+
+// Subscribe 订阅新事件的通知，返回的函数用于取消订阅
+// 通知只表示有新事件，订阅者需通过 Since 读取
+func (l *EventLog) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	l.lock.Lock()
+	l.subscribers[ch] = struct{}{}
+	l.lock.Unlock()
+	return ch, func() {
+		l.lock.Lock()
+		delete(l.subscribers, ch)
+		l.lock.Unlock()
+	}
+}
+
+// publish 向下载器所属任务发布事件，未关联任务时忽略
+func (d *ResourceDownloader) publish(eventType string, data interface{}) {
+	if d.Events != nil {
+		d.Events.Publish(eventType, data)
+	}
+}
+
+// publishProgress 向下载器所属任务发布文件的进度事件，未关联任务时忽略
+func (d *ResourceDownloader) publishProgress(taskURL string, data interface{}) {
+	if d.Events != nil {
+		d.Events.PublishProgress(taskURL, data)
+	}
+}
@@ -0,0 +1,180 @@
+package download
+
+import (
+	"fmt"
+	"testing"
+)
+
+// publishedEvent 测试中发布的一个事件，URL 非空时作为该文件的进度事件发布
+type publishedEvent struct {
+	Type string
+	URL  string
+}
+
+// publishAll 依次发布事件
+func publishAll(l *EventLog, events []publishedEvent) {
+	for _, e := range events {
+		if e.URL != "" {
+			l.PublishProgress(e.URL, e.URL)
+			continue
+		}
+		l.Publish(e.Type, nil)
+	}
+}
+
+// eventIDs 返回事件的 ID 列表
+func eventIDs(events []JobEvent) []uint64 {
+	ids := make([]uint64, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestEventLogSince(t *testing.T) {
+	tests := []struct {
+		name         string
+		published    []publishedEvent
+		lastID       uint64 // 客户端的 Last-Event-ID
+		wantIDs      []uint64
+		wantComplete bool
+	}{
+		{
+			name:         "没有事件",
+			lastID:       0,
+			wantIDs:      []uint64{},
+			wantComplete: true,
+		},
+		{
+			name:         "首次连接返回全部事件",
+			published:    []publishedEvent{{Type: EventTaskStarted}, {Type: EventTaskCompleted}},
+			lastID:       0,
+			wantIDs:      []uint64{1, 2},
+			wantComplete: true,
+		},
+		{
+			name:         "从 Last-Event-ID 之后继续",
+			published:    []publishedEvent{{Type: EventTaskStarted}, {Type: EventTaskCompleted}, {Type: EventJobFinished}},
+			lastID:       2,
+			wantIDs:      []uint64{3},
+			wantComplete: true,
+		},
+		{
+			name:         "已收到全部事件",
+			published:    []publishedEvent{{Type: EventTaskStarted}},
+			lastID:       1,
+			wantIDs:      []uint64{},
+			wantComplete: true,
+		},
+		{
+			name:         "Last-Event-ID 大于最近事件时返回全部事件",
+			published:    []publishedEvent{{Type: EventTaskStarted}, {Type: EventTaskCompleted}},
+			lastID:       99,
+			wantIDs:      []uint64{1, 2},
+			wantComplete: true,
+		},
+		{
+			name: "每个文件只保留最近一次进度事件",
+			published: []publishedEvent{
+				{Type: EventTaskStarted},
+				{URL: "a"}, {URL: "b"}, {URL: "a"}, {URL: "a"},
+				{Type: EventTaskCompleted},
+			},
+			lastID:       0,
+			wantIDs:      []uint64{1, 3, 5, 6},
+			wantComplete: true,
+		},
+		{
+			name: "进度事件按 ID 与状态事件合并",
+			published: []publishedEvent{
+				{Type: EventTaskStarted}, {URL: "a"}, {Type: EventTaskStarted}, {URL: "b"}, {Type: EventTaskCompleted},
+			},
+			lastID:       1,
+			wantIDs:      []uint64{2, 3, 4, 5},
+			wantComplete: true,
+		},
+		{
+			name:         "已收到的进度事件不再返回",
+			published:    []publishedEvent{{URL: "a"}, {Type: EventTaskCompleted}},
+			lastID:       1,
+			wantIDs:      []uint64{2},
+			wantComplete: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewEventLog()
+			publishAll(l, tt.published)
+			events, complete := l.Since(tt.lastID)
+			if got := eventIDs(events); fmt.Sprint(got) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("Since(%d) = %v，期望 %v", tt.lastID, got, tt.wantIDs)
+			}
+			if complete != tt.wantComplete {
+				t.Errorf("Since(%d) complete = %v，期望 %v", tt.lastID, complete, tt.wantComplete)
+			}
+		})
+	}
+}
+
+func TestEventLogOverwrite(t *testing.T) {
+	l := NewEventLog()
+	total := eventLogCapacity + 10
+	for i := 0; i < total; i++ {
+		l.Publish(EventTaskStarted, i)
+		// 进度事件不占用缓冲区，不会覆盖状态事件
+		l.PublishProgress("a", i)
+	}
+
+	tests := []struct {
+		name         string
+		lastID       uint64
+		wantFirst    uint64
+		wantComplete bool
+	}{
+		{name: "最早的事件已被覆盖", lastID: 0, wantFirst: 21, wantComplete: false},
+		{name: "已收到被覆盖的事件", lastID: 19, wantFirst: 21, wantComplete: true},
+		{name: "缓冲区内的事件", lastID: 1001, wantFirst: 1003, wantComplete: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, complete := l.Since(tt.lastID)
+			if complete != tt.wantComplete {
+				t.Errorf("complete = %v，期望 %v", complete, tt.wantComplete)
+			}
+			if len(events) == 0 || events[0].ID != tt.wantFirst {
+				t.Fatalf("第一个事件为 %v，期望 ID %d", eventIDs(events), tt.wantFirst)
+			}
+			last := events[len(events)-1]
+			if last.Type != EventTaskProgress || last.ID != uint64(2*total) {
+				t.Errorf("最后一个事件为 %s #%d，期望最近一次进度事件 #%d", last.Type, last.ID, 2*total)
+			}
+			for i := 1; i < len(events); i++ {
+				if events[i].ID <= events[i-1].ID {
+					t.Fatalf("事件未按 ID 排序: %v", eventIDs(events))
+				}
+			}
+		})
+	}
+}
+
+func TestEventLogFinishOnce(t *testing.T) {
+	l := NewEventLog()
+	notify, unsubscribe := l.Subscribe()
+	defer unsubscribe()
+
+	l.Finish("summary")
+	l.Finish("summary")
+	if !l.Finished() {
+		t.Fatal("Finished() = false")
+	}
+	select {
+	case <-notify:
+	default:
+		t.Fatal("订阅者未收到通知")
+	}
+	events, _ := l.Since(0)
+	if len(events) != 1 || events[0].Type != EventJobFinished {
+		t.Fatalf("events = %v，期望只有一个 job_finished", events)
+	}
+}
@@ -0,0 +1,569 @@
+package download
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 下载任务(Job)的状态
+const (
+	JobStatusRunning   = "running"   // 仍有文件在等待或下载中
+	JobStatusPaused    = "paused"    // 已暂停，不再分发新文件，进行中的读取被挂起
+	JobStatusCancelled = "cancelled" // 已取消
+	JobStatusFinished  = "finished"  // 所有文件均已结束
+)
+
+// 任务控制操作的错误
+var (
+	ErrJobNotFound   = errors.New("任务不存在")
+	ErrJobNotRunning = errors.New("任务已结束或已取消")
+	ErrTaskNotQueued = errors.New("文件不在等待队列中，可能已开始下载或已结束")
+)
+
+const maxFinishedJobs = 100 // 内存中保留的已结束任务数
+
+// Job 表示一次下载请求，拥有独立的下载器配置、进度与文件状态
+type Job struct {
+	ID         string
+	URL        string
+	Downloader *ResourceDownloader
+	Progress   *Progress
+	Tasks      []TaskStatus    // 每个文件的状态，受 TaskStatusLock 保护
+	Control    *JobControl     // 暂停、恢复与取消控制，与 Downloader.Control 相同
+	Events     *EventLog       // 任务事件，与 Downloader.Events 相同
+	Request    json.RawMessage // 创建任务时的请求参数，写入任务日志供重启后恢复
+	CreatedAt  time.Time
+	finalized  int32 // 任务结束后的处理(写出清单、通知)是否已执行
+}
+
+// MarkFinalized 标记任务结束后的处理已执行，只有第一次调用返回 true
+// 多个工作协程可能同时观察到任务结束，标记随任务一起被清理
+func (j *Job) MarkFinalized() bool {
+	return atomic.CompareAndSwapInt32(&j.finalized, 0, 1)
+}
+
+// JobSummary 任务列表中单个任务的概要信息
+type JobSummary struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	OutputDir string    `json:"output_dir"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	Total     int       `json:"total"`
+	Completed int       `json:"completed"`
+	Failed    int       `json:"failed"`
+	Skipped   int       `json:"skipped"`
+	Cancelled int       `json:"cancelled"`
+}
+
+// Finished 判断任务的所有文件是否均已结束
+func (j *Job) Finished() bool {
+	j.Progress.Lock.Lock()
+	defer j.Progress.Lock.Unlock()
+	return j.Progress.Completed+j.Progress.Failed+j.Progress.Skipped+j.Progress.Cancelled >= j.Progress.Total
+}
+
+// Status 返回任务当前的状态
+func (j *Job) Status() string {
+	switch {
+	case j.Control.Cancelled():
+		return JobStatusCancelled
+	case j.Finished():
+		return JobStatusFinished
+	case j.Control.Paused():
+		return JobStatusPaused
+	default:
+		return JobStatusRunning
+	}
+}
+
+// Snapshot 返回任务当前进度与文件状态的副本
+func (j *Job) Snapshot() DownloadProgress {
+	j.Progress.Lock.Lock()
+	elapsed := time.Since(j.Progress.StartTime).Seconds()
+	result := DownloadProgress{
+		Total:     j.Progress.Total,
+		Completed: j.Progress.Completed,
+		Failed:    j.Progress.Failed,
+		Skipped:   j.Progress.Skipped,
+		Cancelled: j.Progress.Cancelled,
+	}
+	j.Progress.Lock.Unlock()
+
+	result.Status = j.Status()
+	result.Duration = fmt.Sprintf("%f", elapsed)
+	if elapsed > 0 {
+		result.Rate = float64(result.Completed) / elapsed
+	}
+
+	TaskStatusLock.Lock()
+	result.Tasks = make([]TaskStatus, len(j.Tasks))
+	copy(result.Tasks, j.Tasks)
+	TaskStatusLock.Unlock()
+
+	for _, task := range result.Tasks {
+		result.BytesDone += task.BytesDone
+		result.BytesTotal += task.BytesTotal
+		if task.Status == "downloading" {
+			result.Speed += task.Speed
+			result.AvgSpeed += task.AvgSpeed
+		}
+	}
+	result.SpeedMBps = result.Speed / (1024 * 1024)
+	return result
+}
+
+// taskStatus 返回指定文件当前的状态
+func (j *Job) taskStatus(url string) string {
+	TaskStatusLock.Lock()
+	defer TaskStatusLock.Unlock()
+	for _, status := range j.Tasks {
+		if status.URL == url {
+			return status.Status
+		}
+	}
+	return ""
+}
+
+// Summary 返回任务的概要信息
+func (j *Job) Summary() JobSummary {
+	j.Progress.Lock.Lock()
+	summary := JobSummary{
+		ID:        j.ID,
+		URL:       j.URL,
+		OutputDir: j.Downloader.OutputDir,
+		CreatedAt: j.CreatedAt,
+		Total:     j.Progress.Total,
+		Completed: j.Progress.Completed,
+		Failed:    j.Progress.Failed,
+		Skipped:   j.Progress.Skipped,
+		Cancelled: j.Progress.Cancelled,
+	}
+	j.Progress.Lock.Unlock()
+	summary.Status = j.Status()
+	return summary
+}
+
+// JobManager 管理所有下载任务，各任务的文件共享一个有界的工作协程池
+type JobManager struct {
+	lock       sync.Mutex
+	jobs       map[string]*Job
+	workers    int        // 同时下载的文件数上限，可在运行时调整
+	spawned    int        // 已启动的工作协程数，不小于历史上的最大上限
+	slots      int        // 已领取名额的工作协程数
+	slotCond   *sync.Cond // 名额释放或上限调整时唤醒等待的工作协程
+	closing    bool       // 调度器已关闭，工作协程不再领取名额
+	busy       int64      // 正在下载文件的工作协程数
+	started    bool
+	running    sync.WaitGroup // 运行中的工作协程
+	journal    *Journal
+	onTaskDone func(job *Job, entry DownloadHistoryEntry)
+}
+
+// NewJobManager 创建任务管理器，workers 为共享工作协程数，onTaskDone 在每个文件结束(含取消)后以其下载结果调用
+func NewJobManager(workers int, onTaskDone func(job *Job, entry DownloadHistoryEntry)) *JobManager {
+	if workers <= 0 {
+		workers = 1
+	}
+	m := &JobManager{
+		jobs:       make(map[string]*Job),
+		workers:    workers,
+		onTaskDone: onTaskDone,
+	}
+	m.slotCond = sync.NewCond(&m.lock)
+	return m
+}
+
+// SetJournal 设置任务日志，之后的任务与文件状态变更都会写入日志
+func (m *JobManager) SetJournal(journal *Journal) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.journal = journal
+}
+
+// Add 注册任务并写入任务日志，随后将其文件提交到调度器，首次调用时启动工作协程池
+func (m *JobManager) Add(job *Job, tasks []DownloadTask) {
+	spec := &JobSpec{
+		ID:        job.ID,
+		URL:       job.URL,
+		CreatedAt: job.CreatedAt,
+		Request:   job.Request,
+		Tasks:     make([]JournalTask, len(tasks)),
+	}
+	for i, task := range tasks {
+		spec.Tasks[i] = JournalTask{URL: task.URL, Type: task.Type, Filename: task.Filename}
+	}
+	m.register(job, tasks, nil)
+	m.record(job, JournalRecord{Op: JournalJobAdded, Job: spec})
+	m.submit(job, tasks, nil)
+}
+
+// Restore 恢复重启前未完成的任务：已结束的文件沿用记录的状态，其余文件重新提交
+// 临时文件仍在时会从断点续传；paused 为 true 时任务以暂停状态恢复
+func (m *JobManager) Restore(job *Job, tasks []DownloadTask, done map[string]string, paused bool) {
+	m.register(job, tasks, done)
+	if job.Finished() {
+		// 重启前所有文件均已结束，只是未来得及记录任务结束
+		m.record(job, JournalRecord{Op: JournalJobFinished})
+		job.Events.Finish(job.Summary())
+		return
+	}
+	if paused {
+		job.Control.Pause()
+		Scheduler.SetJobPaused(job.ID, true)
+		m.record(job, JournalRecord{Op: JournalJobPaused})
+	}
+	m.submit(job, tasks, done)
+}
+
+// register 初始化任务的控制器、进度与文件状态并加入管理器
+func (m *JobManager) register(job *Job, tasks []DownloadTask, done map[string]string) {
+	job.Control = NewJobControl()
+	job.Downloader.Control = job.Control
+	job.Events = NewEventLog()
+	job.Downloader.Events = job.Events
+	job.Downloader.Logger = job.Downloader.logger().With("job_id", job.ID)
+	job.Progress = &Progress{
+		Total:     len(tasks),
+		StartTime: job.CreatedAt,
+	}
+	job.Tasks = make([]TaskStatus, len(tasks))
+	for i, task := range tasks {
+		status, ok := done[task.URL]
+		if !ok {
+			status = "pending"
+		}
+		switch status {
+		case "completed":
+			job.Progress.Completed++
+		case "skipped":
+			job.Progress.Skipped++
+		case "failed":
+			job.Progress.Failed++
+		case "cancelled":
+			job.Progress.Cancelled++
+		}
+		job.Tasks[i] = TaskStatus{
+			URL:      task.URL,
+			Filename: task.Filename,
+			Type:     task.Type,
+			Status:   status,
+		}
+	}
+
+	m.lock.Lock()
+	m.jobs[job.ID] = job
+	m.pruneLocked()
+	if !m.started {
+		m.started = true
+		m.spawnLocked()
+	}
+	m.lock.Unlock()
+}
+
+// submit 将尚未结束的文件提交到调度器
+func (m *JobManager) submit(job *Job, tasks []DownloadTask, done map[string]string) {
+	for _, task := range tasks {
+		if _, ok := done[task.URL]; ok {
+			continue
+		}
+		task.HistoryID = job.ID
+		Scheduler.Submit(task)
+	}
+}
+
+// record 将任务的状态变更写入任务日志
+func (m *JobManager) record(job *Job, record JournalRecord) {
+	m.lock.Lock()
+	journal := m.journal
+	m.lock.Unlock()
+	if journal == nil {
+		return
+	}
+
+	record.JobID = job.ID
+	if err := journal.Append(record); err != nil {
+		job.Downloader.logger().Error("写入任务日志失败", "op", record.Op, "error", err)
+	}
+}
+
+// Get 返回指定 ID 的任务
+func (m *JobManager) Get(id string) (*Job, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+// Latest 返回最近创建的任务
+func (m *JobManager) Latest() (*Job, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var latest *Job
+	for _, job := range m.jobs {
+		if latest == nil || job.CreatedAt.After(latest.CreatedAt) {
+			latest = job
+		}
+	}
+	return latest, latest != nil
+}
+
+// List 返回所有任务的概要信息，按创建时间倒序排列
+func (m *JobManager) List() []JobSummary {
+	m.lock.Lock()
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job)
+	}
+	m.lock.Unlock()
+
+	summaries := make([]JobSummary, 0, len(jobs))
+	for _, job := range jobs {
+		summaries = append(summaries, job.Summary())
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].CreatedAt.After(summaries[j].CreatedAt) })
+	return summaries
+}
+
+// Pause 暂停任务：调度器不再分发其文件，进行中的下载在下一次读取时挂起
+func (m *JobManager) Pause(id string) (*Job, error) {
+	job, err := m.runningJob(id)
+	if err != nil {
+		return nil, err
+	}
+	job.Control.Pause()
+	Scheduler.SetJobPaused(id, true)
+	m.record(job, JournalRecord{Op: JournalJobPaused})
+	return job, nil
+}
+
+// Resume 恢复已暂停的任务
+func (m *JobManager) Resume(id string) (*Job, error) {
+	job, err := m.runningJob(id)
+	if err != nil {
+		return nil, err
+	}
+	Scheduler.SetJobPaused(id, false)
+	job.Control.Resume()
+	m.record(job, JournalRecord{Op: JournalJobResumed})
+	return job, nil
+}
+
+// Cancel 取消任务：中止进行中的请求，尚未开始的文件直接记为已取消
+// keepPartial 为 true 时保留临时文件，以后重新下载同一资源时可续传
+func (m *JobManager) Cancel(id string, keepPartial bool) (*Job, error) {
+	job, err := m.runningJob(id)
+	if err != nil {
+		return nil, err
+	}
+	job.Control.Cancel(keepPartial)
+	m.record(job, JournalRecord{Op: JournalJobCancelled})
+	for _, task := range Scheduler.RemoveJob(id) {
+		m.taskDone(job, cancelTask(task, job.Downloader, job.Progress, &job.Tasks))
+	}
+	return job, nil
+}
+
+// taskDone 发布文件结束事件，所有文件均已结束时发布任务结束事件，然后通知调用方
+func (m *JobManager) taskDone(job *Job, entry DownloadHistoryEntry) {
+	observeTask(entry)
+	if entry.HasFile() {
+		job.Events.Publish(EventTaskCompleted, entry)
+	} else {
+		job.Events.Publish(EventTaskFailed, entry)
+	}
+	if job.Finished() {
+		job.Events.Finish(job.Summary())
+	}
+
+	if m.onTaskDone != nil {
+		m.onTaskDone(job, entry)
+	}
+}
+
+// Reprioritize 调整任务中尚未开始的文件的优先级，数值越大越先下载
+func (m *JobManager) Reprioritize(id, taskURL string, priority int) (*Job, error) {
+	job, err := m.runningJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if !Scheduler.Reprioritize(id, taskURL, priority) {
+		return nil, ErrTaskNotQueued
+	}
+
+	TaskStatusLock.Lock()
+	for index := range job.Tasks {
+		if job.Tasks[index].URL == taskURL {
+			job.Tasks[index].Priority = priority
+			break
+		}
+	}
+	TaskStatusLock.Unlock()
+	return job, nil
+}
+
+// Workers 返回同时下载的文件数上限与正在下载文件的协程数
+func (m *JobManager) Workers() (total, busy int) {
+	m.lock.Lock()
+	total = m.workers
+	m.lock.Unlock()
+	return total, int(atomic.LoadInt64(&m.busy))
+}
+
+// SetWorkers 在运行时调整同时下载的文件数上限
+// 调大时立即启动新的工作协程；调小时正在下载的文件不受影响，之后按新上限领取文件
+func (m *JobManager) SetWorkers(workers int) {
+	if workers <= 0 {
+		workers = 1
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.workers = workers
+	if m.started {
+		m.spawnLocked()
+	}
+	m.slotCond.Broadcast()
+}
+
+// spawnLocked 启动工作协程直到数量达到上限，调用方需持有锁
+func (m *JobManager) spawnLocked() {
+	for m.spawned < m.workers {
+		m.running.Add(1)
+		go m.worker(m.spawned)
+		m.spawned++
+	}
+}
+
+// acquireSlot 等待领取一个下载名额，调度器关闭后返回 false
+func (m *JobManager) acquireSlot() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for !m.closing && m.slots >= m.workers {
+		m.slotCond.Wait()
+	}
+	if m.closing {
+		return false
+	}
+	m.slots++
+	return true
+}
+
+// releaseSlot 归还下载名额
+func (m *JobManager) releaseSlot() {
+	m.lock.Lock()
+	m.slots--
+	m.lock.Unlock()
+	m.slotCond.Signal()
+}
+
+// Drain 关闭调度器使工作协程不再领取新文件，并等待下载中的文件结束，最多等待 timeout
+// 尚未开始的文件保留在任务日志中，重启后恢复；超时返回 false，此时仍在下载的文件保留临时文件以便续传
+func (m *JobManager) Drain(timeout time.Duration) bool {
+	m.lock.Lock()
+	m.closing = true
+	m.lock.Unlock()
+	m.slotCond.Broadcast()
+	Scheduler.Close()
+
+	done := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Close 关闭任务日志，之后的状态变更不再写入日志
+func (m *JobManager) Close() error {
+	m.lock.Lock()
+	journal := m.journal
+	m.journal = nil
+	m.lock.Unlock()
+	if journal == nil {
+		return nil
+	}
+	return journal.Close()
+}
+
+// runningJob 返回尚未结束且未取消的任务
+func (m *JobManager) runningJob(id string) (*Job, error) {
+	job, ok := m.Get(id)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	if job.Control.Cancelled() || job.Finished() {
+		return nil, ErrJobNotRunning
+	}
+	return job, nil
+}
+
+// pruneLocked 已结束的任务超过上限时移除最早的任务，调用方需持有锁
+func (m *JobManager) pruneLocked() {
+	var finished []*Job
+	for _, job := range m.jobs {
+		if job.Finished() {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].CreatedAt.Before(finished[j].CreatedAt) })
+	for _, job := range finished[:len(finished)-maxFinishedJobs] {
+		delete(m.jobs, job.ID)
+	}
+}
+
+// worker 领取下载名额后从调度器中按主机轮询获取文件，使用所属任务的下载器配置下载
+func (m *JobManager) worker(workerID int) {
+	defer m.running.Done()
+	for {
+		if !m.acquireSlot() {
+			return
+		}
+		task, ok := Scheduler.Next()
+		if !ok {
+			m.releaseSlot()
+			return
+		}
+
+		job, ok := m.Get(task.HistoryID)
+		if !ok {
+			Scheduler.Done(task)
+			m.releaseSlot()
+			continue
+		}
+
+		logger := job.Downloader.logger()
+		logger.Info("开始下载文件", "worker", workerID, "task", task.URL)
+		job.Events.Publish(EventTaskStarted, TaskStartedEvent{URL: task.URL, Filename: task.Filename, Type: task.Type})
+		atomic.AddInt64(&m.busy, 1)
+		entry := DownloadWithRetry(task, job.Downloader, job.Progress, &job.Tasks)
+		atomic.AddInt64(&m.busy, -1)
+		Scheduler.Done(task)
+		logger.Info("文件下载结束", "worker", workerID, "task", task.URL, "status", entry.Status)
+
+		// 任务取消后不再记录文件状态，日志中已没有该任务
+		if !job.Control.Cancelled() {
+			m.record(job, JournalRecord{Op: JournalTaskDone, URL: task.URL, Status: job.taskStatus(task.URL)})
+		}
+
+		// 回调写入任务的最终结果后再记录任务结束，进程在两者之间退出时重启后按日志补录
+		m.taskDone(job, entry)
+		if !job.Control.Cancelled() && job.Finished() {
+			m.record(job, JournalRecord{Op: JournalJobFinished})
+		}
+		m.releaseSlot()
+	}
+}
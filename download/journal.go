@@ -0,0 +1,250 @@
+package download
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 任务日志记录的操作类型
+const (
+	JournalJobAdded     = "job_added"     // 新建任务，携带任务参数与文件列表
+	JournalTaskDone     = "task_done"     // 单个文件结束，携带最终状态
+	JournalJobPaused    = "job_paused"    // 任务暂停
+	JournalJobResumed   = "job_resumed"   // 任务恢复
+	JournalJobCancelled = "job_cancelled" // 任务取消
+	JournalJobFinished  = "job_finished"  // 任务所有文件均已结束
+)
+
+const journalCompactEvery = 500 // 追加多少条记录后压缩一次日志
+
+// JobSpec 重建任务所需的全部信息
+type JobSpec struct {
+	ID        string          `json:"id"`
+	URL       string          `json:"url"`
+	CreatedAt time.Time       `json:"created_at"`
+	Request   json.RawMessage `json:"request"` // 创建任务时的原始请求参数，由调用方解析
+	Tasks     []JournalTask   `json:"tasks"`
+}
+
+// JournalTask 任务中单个文件的信息
+type JournalTask struct {
+	URL      string `json:"url"`
+	Type     string `json:"type"`
+	Filename string `json:"filename"`
+}
+
+// JournalRecord 任务日志中的一条状态变更记录
+type JournalRecord struct {
+	Op     string    `json:"op"`
+	JobID  string    `json:"job_id"`
+	Time   time.Time `json:"time"`
+	Job    *JobSpec  `json:"job,omitempty"`
+	URL    string    `json:"url,omitempty"`
+	Status string    `json:"status,omitempty"`
+}
+
+// JournalJob 重放日志后得到的未完成任务
+type JournalJob struct {
+	Spec   JobSpec
+	Done   map[string]string // 已结束文件的 URL 与最终状态
+	Paused bool
+}
+
+// Journal 以追加写的方式记录任务与文件的状态变更，进程重启后重放以恢复未完成的任务
+type Journal struct {
+	lock     sync.Mutex
+	path     string
+	file     *os.File
+	jobs     map[string]*JournalJob // 当前未完成的任务
+	appended int
+}
+
+// OpenJournal 打开任务日志并重放已有记录，压缩后返回未完成的任务(按创建时间排序)
+func OpenJournal(path string) (*Journal, []JournalJob, error) {
+	j := &Journal{
+		path: path,
+		jobs: make(map[string]*JournalJob),
+	}
+
+	if file, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			var record JournalRecord
+			// 进程在写入中途被终止时最后一行可能不完整，忽略即可
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				continue
+			}
+			j.apply(record)
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, nil, fmt.Errorf("读取任务日志失败: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	if err := j.compactLocked(); err != nil {
+		j.Close()
+		return nil, nil, err
+	}
+
+	pending := make([]JournalJob, 0, len(j.jobs))
+	for _, job := range j.jobs {
+		done := make(map[string]string, len(job.Done))
+		for url, status := range job.Done {
+			done[url] = status
+		}
+		pending = append(pending, JournalJob{Spec: job.Spec, Done: done, Paused: job.Paused})
+	}
+	sort.Slice(pending, func(a, b int) bool { return pending[a].Spec.CreatedAt.Before(pending[b].Spec.CreatedAt) })
+	return j, pending, nil
+}
+
+// apply 将一条记录应用到内存中的任务状态
+func (j *Journal) apply(record JournalRecord) {
+	switch record.Op {
+	case JournalJobAdded:
+		if record.Job != nil {
+			j.jobs[record.JobID] = &JournalJob{Spec: *record.Job, Done: make(map[string]string)}
+		}
+	case JournalTaskDone:
+		if job, ok := j.jobs[record.JobID]; ok {
+			job.Done[record.URL] = record.Status
+		}
+	case JournalJobPaused:
+		if job, ok := j.jobs[record.JobID]; ok {
+			job.Paused = true
+		}
+	case JournalJobResumed:
+		if job, ok := j.jobs[record.JobID]; ok {
+			job.Paused = false
+		}
+	case JournalJobCancelled, JournalJobFinished:
+		delete(j.jobs, record.JobID)
+	}
+}
+
+// Append 追加一条记录并同步到磁盘，记录数达到阈值时压缩日志
+func (j *Journal) Append(record JournalRecord) error {
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if j.file == nil {
+		return fmt.Errorf("任务日志已关闭")
+	}
+	// 写入成功后才更新内存中的状态，失败时截断写入了一半的记录，保持内存与磁盘一致
+	info, err := j.file.Stat()
+	if err != nil {
+		return fmt.Errorf("写入任务日志失败: %v", err)
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		j.file.Truncate(info.Size())
+		return fmt.Errorf("写入任务日志失败: %v", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		j.file.Truncate(info.Size())
+		return fmt.Errorf("同步任务日志失败: %v", err)
+	}
+	j.apply(record)
+
+	j.appended++
+	if j.appended >= journalCompactEvery {
+		return j.compactLocked()
+	}
+	return nil
+}
+
+// Compact 只保留未完成任务的记录，重写日志文件
+func (j *Journal) Compact() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.compactLocked()
+}
+
+// compactLocked 将当前状态写入临时文件后原子替换日志，并重新打开以便追加，调用方需持有锁
+// 任一步骤失败时删除临时文件并保持日志可追加，替换失败时继续追加到原日志
+func (j *Journal) compactLocked() error {
+	tmp := j.path + ".tmp"
+	if err := j.writeSnapshotLocked(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// 部分系统不允许替换已打开的文件，替换前先关闭
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+	renameErr := os.Rename(tmp, j.path)
+	if renameErr != nil {
+		os.Remove(tmp)
+	}
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("打开任务日志失败: %v", err)
+	}
+	j.file = file
+	if renameErr != nil {
+		return fmt.Errorf("替换任务日志失败: %v", renameErr)
+	}
+	j.appended = 0
+	return nil
+}
+
+// writeSnapshotLocked 将未完成任务的记录写入 path 并同步到磁盘，调用方需持有锁
+func (j *Journal) writeSnapshotLocked(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建任务日志失败: %v", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for id, job := range j.jobs {
+		spec := job.Spec
+		records := []JournalRecord{{Op: JournalJobAdded, JobID: id, Time: spec.CreatedAt, Job: &spec}}
+		for url, status := range job.Done {
+			records = append(records, JournalRecord{Op: JournalTaskDone, JobID: id, URL: url, Status: status})
+		}
+		if job.Paused {
+			records = append(records, JournalRecord{Op: JournalJobPaused, JobID: id})
+		}
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Close 关闭日志文件
+func (j *Journal) Close() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
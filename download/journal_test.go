@@ -0,0 +1,278 @@
+package download
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestJournal 在临时目录中打开任务日志
+func openTestJournal(t *testing.T, path string) (*Journal, []JournalJob) {
+	t.Helper()
+	j, pending, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal: %v", err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return j, pending
+}
+
+// appendRecords 依次追加记录
+func appendRecords(t *testing.T, j *Journal, records []JournalRecord) {
+	t.Helper()
+	for _, record := range records {
+		if err := j.Append(record); err != nil {
+			t.Fatalf("Append(%s %s): %v", record.Op, record.JobID, err)
+		}
+	}
+}
+
+// jobAdded 新建任务的记录
+func jobAdded(id string, created time.Time, urls ...string) JournalRecord {
+	spec := &JobSpec{ID: id, URL: "https://example.com/" + id, CreatedAt: created}
+	for _, url := range urls {
+		spec.Tasks = append(spec.Tasks, JournalTask{URL: url, Type: "image", Filename: filepath.Base(url)})
+	}
+	return JournalRecord{Op: JournalJobAdded, JobID: id, Job: spec}
+}
+
+func TestJournalReplay(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		records []JournalRecord
+		want    map[string]JournalJob // 按任务 ID 期望的未完成任务，只比较 Done 与 Paused
+		order   []string              // 期望的返回顺序
+	}{
+		{
+			name:    "空日志",
+			records: nil,
+			want:    map[string]JournalJob{},
+		},
+		{
+			name: "记录已结束的文件",
+			records: []JournalRecord{
+				jobAdded("a", base, "https://example.com/1.png", "https://example.com/2.png"),
+				{Op: JournalTaskDone, JobID: "a", URL: "https://example.com/1.png", Status: "completed"},
+			},
+			want: map[string]JournalJob{
+				"a": {Done: map[string]string{"https://example.com/1.png": "completed"}},
+			},
+			order: []string{"a"},
+		},
+		{
+			name: "完成与取消的任务不再恢复",
+			records: []JournalRecord{
+				jobAdded("a", base, "https://example.com/1.png"),
+				jobAdded("b", base.Add(time.Second), "https://example.com/2.png"),
+				jobAdded("c", base.Add(2*time.Second), "https://example.com/3.png"),
+				{Op: JournalJobFinished, JobID: "a"},
+				{Op: JournalJobCancelled, JobID: "c"},
+			},
+			want:  map[string]JournalJob{"b": {Done: map[string]string{}}},
+			order: []string{"b"},
+		},
+		{
+			name: "暂停与恢复",
+			records: []JournalRecord{
+				jobAdded("a", base, "https://example.com/1.png"),
+				jobAdded("b", base.Add(time.Second), "https://example.com/2.png"),
+				{Op: JournalJobPaused, JobID: "a"},
+				{Op: JournalJobPaused, JobID: "b"},
+				{Op: JournalJobResumed, JobID: "b"},
+			},
+			want: map[string]JournalJob{
+				"a": {Done: map[string]string{}, Paused: true},
+				"b": {Done: map[string]string{}},
+			},
+			order: []string{"a", "b"},
+		},
+		{
+			name: "按创建时间排序",
+			records: []JournalRecord{
+				jobAdded("late", base.Add(time.Hour)),
+				jobAdded("early", base),
+			},
+			want: map[string]JournalJob{
+				"late":  {Done: map[string]string{}},
+				"early": {Done: map[string]string{}},
+			},
+			order: []string{"early", "late"},
+		},
+		{
+			name: "忽略未知任务的记录",
+			records: []JournalRecord{
+				{Op: JournalTaskDone, JobID: "missing", URL: "https://example.com/1.png", Status: "completed"},
+				{Op: JournalJobPaused, JobID: "missing"},
+			},
+			want: map[string]JournalJob{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "jobs.journal")
+			j, _ := openTestJournal(t, path)
+			appendRecords(t, j, tt.records)
+			if err := j.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			_, pending := openTestJournal(t, path)
+			if len(pending) != len(tt.want) {
+				t.Fatalf("恢复了 %d 个任务，期望 %d 个", len(pending), len(tt.want))
+			}
+			for i, job := range pending {
+				if tt.order != nil && job.Spec.ID != tt.order[i] {
+					t.Errorf("第 %d 个任务为 %s，期望 %s", i, job.Spec.ID, tt.order[i])
+				}
+				want, ok := tt.want[job.Spec.ID]
+				if !ok {
+					t.Errorf("不应恢复任务 %s", job.Spec.ID)
+					continue
+				}
+				if job.Paused != want.Paused {
+					t.Errorf("任务 %s Paused = %v，期望 %v", job.Spec.ID, job.Paused, want.Paused)
+				}
+				if len(job.Done) != len(want.Done) {
+					t.Errorf("任务 %s Done = %v，期望 %v", job.Spec.ID, job.Done, want.Done)
+				}
+				for url, status := range want.Done {
+					if job.Done[url] != status {
+						t.Errorf("任务 %s 文件 %s 状态为 %q，期望 %q", job.Spec.ID, url, job.Done[url], status)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestJournalIgnoresTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.journal")
+	j, _ := openTestJournal(t, path)
+	appendRecords(t, j, []JournalRecord{jobAdded("a", time.Now(), "https://example.com/1.png")})
+	j.Close()
+
+	// 模拟进程在写入中途被终止
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"op":"task_done","job_id":"a","url":"https://exa`)
+	file.Close()
+
+	_, pending := openTestJournal(t, path)
+	if len(pending) != 1 || len(pending[0].Done) != 0 {
+		t.Fatalf("pending = %+v，期望任务 a 且没有已结束的文件", pending)
+	}
+}
+
+func TestJournalCompactRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.journal")
+	j, _ := openTestJournal(t, path)
+
+	// 超过压缩阈值，追加过程中会自动压缩
+	appendRecords(t, j, []JournalRecord{
+		jobAdded("keep", time.Now(), "https://example.com/keep.png"),
+		{Op: JournalJobPaused, JobID: "keep"},
+	})
+	for i := 0; i < journalCompactEvery; i++ {
+		appendRecords(t, j, []JournalRecord{jobAdded("done", time.Now()), {Op: JournalJobFinished, JobID: "done"}})
+	}
+	appendRecords(t, j, []JournalRecord{
+		{Op: JournalTaskDone, JobID: "keep", URL: "https://example.com/keep.png", Status: "failed"},
+	})
+	if j.appended >= journalCompactEvery {
+		t.Fatalf("追加 %d 条记录后未压缩", j.appended)
+	}
+	if err := j.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	j.Close()
+
+	// 压缩后只保留未完成任务的记录：新建、已结束文件与暂停各一条
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 3 {
+		t.Errorf("压缩后日志有 %d 行，期望 3 行", lines)
+	}
+
+	_, pending := openTestJournal(t, path)
+	if len(pending) != 1 {
+		t.Fatalf("恢复了 %d 个任务，期望 1 个", len(pending))
+	}
+	job := pending[0]
+	if job.Spec.ID != "keep" || !job.Paused || job.Done["https://example.com/keep.png"] != "failed" {
+		t.Errorf("恢复的任务为 %+v", job)
+	}
+	if len(job.Spec.Tasks) != 1 || job.Spec.Tasks[0].Filename != "keep.png" {
+		t.Errorf("恢复的文件列表为 %+v", job.Spec.Tasks)
+	}
+}
+
+func TestJournalCompactFailureKeepsAppending(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.journal")
+	j, _ := openTestJournal(t, path)
+	appendRecords(t, j, []JournalRecord{jobAdded("a", time.Now(), "https://example.com/1.png")})
+
+	// 临时文件路径被目录占用，无法写入压缩结果
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Compact(); err == nil {
+		t.Fatal("Compact 应返回错误")
+	}
+	appendRecords(t, j, []JournalRecord{
+		{Op: JournalTaskDone, JobID: "a", URL: "https://example.com/1.png", Status: "completed"},
+	})
+	j.Close()
+
+	os.Remove(path + ".tmp")
+	_, pending := openTestJournal(t, path)
+	if len(pending) != 1 || pending[0].Done["https://example.com/1.png"] != "completed" {
+		t.Fatalf("压缩失败后追加的记录丢失: %+v", pending)
+	}
+}
+
+func TestJournalAppendFailureKeepsState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.journal")
+	j, _ := openTestJournal(t, path)
+	appendRecords(t, j, []JournalRecord{jobAdded("a", time.Now(), "https://example.com/1.png")})
+
+	// 以只读方式替换日志文件，使写入失败
+	readOnly, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.lock.Lock()
+	j.file.Close()
+	j.file = readOnly
+	j.lock.Unlock()
+
+	failed := []JournalRecord{
+		jobAdded("b", time.Now(), "https://example.com/2.png"),
+		{Op: JournalTaskDone, JobID: "a", URL: "https://example.com/1.png", Status: "completed"},
+		{Op: JournalJobCancelled, JobID: "a"},
+	}
+	for _, record := range failed {
+		if err := j.Append(record); err == nil {
+			t.Fatalf("Append(%s %s) 应返回错误", record.Op, record.JobID)
+		}
+	}
+
+	// 压缩按内存中的状态重写日志，写入失败的记录不应出现
+	if err := j.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	j.Close()
+
+	_, pending := openTestJournal(t, path)
+	if len(pending) != 1 || pending[0].Spec.ID != "a" || len(pending[0].Done) != 0 {
+		t.Fatalf("写入失败的记录改变了任务状态: %+v", pending)
+	}
+}
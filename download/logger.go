@@ -0,0 +1,208 @@
+package download
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogLevel 日志级别
+type LogLevel int32
+
+// 日志级别，低于当前级别的日志不输出
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// 日志输出位置
+const (
+	LogOutputStdout = "stdout" // 只输出到标准输出
+	LogOutputFile   = "file"   // 只输出到日志文件
+	LogOutputBoth   = "both"   // 同时输出到标准输出与日志文件
+)
+
+var logLevelNames = map[LogLevel]string{
+	LevelDebug: "DEBUG",
+	LevelInfo:  "INFO",
+	LevelWarn:  "WARN",
+	LevelError: "ERROR",
+}
+
+// String 返回日志级别的名称
+func (l LogLevel) String() string {
+	if name, ok := logLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("LEVEL(%d)", int32(l))
+}
+
+// ParseLogLevel 解析日志级别名称(不区分大小写)，为空时返回 INFO
+func ParseLogLevel(name string) (LogLevel, error) {
+	if name == "" {
+		return LevelInfo, nil
+	}
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	if strings.EqualFold(name, "warning") {
+		return LevelWarn, nil
+	}
+	return LevelInfo, fmt.Errorf("未知的日志级别: %s", name)
+}
+
+// LoggerConfig 日志的级别、输出位置与日志文件的轮转策略
+type LoggerConfig struct {
+	Level       string // 日志级别(debug/info/warn/error)
+	Output      string // 输出位置(stdout/file/both)，为空时为 both
+	File        string // 日志文件路径，为空时为 download.log
+	MaxSizeMB   int    // 日志文件超过该大小(MB)时轮转，0 表示不按大小轮转
+	RotateHours int    // 日志文件写入超过该时长(小时)时轮转，0 表示不按时间轮转
+	MaxAgeDays  int    // 删除早于该天数的已轮转文件，0 表示不按时间删除
+	MaxBackups  int    // 最多保留的已轮转文件数，0 表示不限
+}
+
+// logSink 日志的输出目标，由同一 Logger 派生的所有 Logger 共享，可在运行时替换
+type logSink struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// Write 串行写入一行日志
+func (s *logSink) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.w.Write(p)
+}
+
+// Logger 分级的结构化日志，每行为一个 JSON 对象，包含通过 With 附加的字段(如 job_id、task)
+type Logger struct {
+	level  *int32
+	sink   *logSink
+	fields map[string]interface{}
+}
+
+// NewLogger 创建输出到 w 的日志
+func NewLogger(w io.Writer, level LogLevel) *Logger {
+	l := &Logger{level: new(int32), sink: &logSink{w: w}}
+	l.SetLevel(level)
+	return l
+}
+
+// With 返回附加了字段的 Logger，与原 Logger 共享级别与输出目标
+func (l *Logger) With(key string, value interface{}) *Logger {
+	fields := make(map[string]interface{}, len(l.fields)+1)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	return &Logger{level: l.level, sink: l.sink, fields: fields}
+}
+
+// SetLevel 设置日志级别，对所有派生的 Logger 立即生效
+func (l *Logger) SetLevel(level LogLevel) {
+	atomic.StoreInt32(l.level, int32(level))
+}
+
+// Level 返回当前的日志级别
+func (l *Logger) Level() LogLevel {
+	return LogLevel(atomic.LoadInt32(l.level))
+}
+
+// SetOutput 替换输出目标，返回原输出目标以便调用方关闭
+func (l *Logger) SetOutput(w io.Writer) io.Writer {
+	l.sink.lock.Lock()
+	defer l.sink.lock.Unlock()
+	previous := l.sink.w
+	l.sink.w = w
+	return previous
+}
+
+// Debug 输出 DEBUG 级别日志，keyvals 为交替的字段名与字段值
+func (l *Logger) Debug(message string, keyvals ...interface{}) {
+	l.log(LevelDebug, message, keyvals)
+}
+
+// Info 输出 INFO 级别日志
+func (l *Logger) Info(message string, keyvals ...interface{}) {
+	l.log(LevelInfo, message, keyvals)
+}
+
+// Warn 输出 WARN 级别日志
+func (l *Logger) Warn(message string, keyvals ...interface{}) {
+	l.log(LevelWarn, message, keyvals)
+}
+
+// Error 输出 ERROR 级别日志
+func (l *Logger) Error(message string, keyvals ...interface{}) {
+	l.log(LevelError, message, keyvals)
+}
+
+// log 合并字段后以结构化格式输出一行日志
+func (l *Logger) log(level LogLevel, message string, keyvals []interface{}) {
+	if level < l.Level() {
+		return
+	}
+
+	fields := make(map[string]interface{}, len(l.fields)+len(keyvals)/2+1)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		value := keyvals[i+1]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		fields[key] = value
+	}
+	fields["message"] = message
+	LogStructured(l.sink, level.String(), fields)
+}
+
+// OpenLogOutput 按配置打开日志的输出目标，返回的 io.Closer 用于关闭日志文件(只输出到标准输出时为 nil)
+func OpenLogOutput(config LoggerConfig) (io.Writer, io.Closer, error) {
+	output := config.Output
+	if output == "" {
+		output = LogOutputBoth
+	}
+	if output == LogOutputStdout {
+		return os.Stdout, nil, nil
+	}
+	if output != LogOutputFile && output != LogOutputBoth {
+		return nil, nil, fmt.Errorf("未知的日志输出位置: %s", config.Output)
+	}
+
+	path := config.File
+	if path == "" {
+		path = "download.log"
+	}
+	file, err := newRotatingFile(path, int64(config.MaxSizeMB)*1024*1024,
+		time.Duration(config.RotateHours)*time.Hour,
+		time.Duration(config.MaxAgeDays)*24*time.Hour, config.MaxBackups)
+	if err != nil {
+		return nil, nil, err
+	}
+	if output == LogOutputBoth {
+		return io.MultiWriter(os.Stdout, file), file, nil
+	}
+	return file, file, nil
+}
+
+// logger 返回下载器的日志，未设置时输出到标准输出
+func (d *ResourceDownloader) logger() *Logger {
+	if d.Logger != nil {
+		return d.Logger
+	}
+	return defaultLogger
+}
+
+var defaultLogger = NewLogger(os.Stdout, LevelInfo) // 下载器未设置日志时使用
@@ -0,0 +1,221 @@
+package download
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "20060102-150405.000" // 已轮转文件名中的时间格式
+
+// rotatingFile 按大小与写入时长轮转的日志文件
+// 轮转后的文件重命名为 <名称>-<时间><扩展名> 并在后台压缩为 .gz，超过保留天数或数量的文件被删除
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxAge     time.Duration
+	maxBackups int
+
+	lock     sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	cleanupLock sync.Mutex // 串行执行压缩与清理
+}
+
+// newRotatingFile 打开日志文件，文件已存在时追加写入
+func newRotatingFile(path string, maxSize int64, interval, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, interval: interval, maxAge: maxAge, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	go r.cleanup("")
+	return r, nil
+}
+
+// open 以追加模式打开日志文件
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	r.openedAt = time.Now()
+	return nil
+}
+
+// Write 写入日志，写入前检查是否需要轮转
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.shouldRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// shouldRotate 判断写入 n 字节前是否需要轮转
+func (r *rotatingFile) shouldRotate(n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.maxSize > 0 && r.size+n > r.maxSize {
+		return true
+	}
+	return r.interval > 0 && time.Since(r.openedAt) >= r.interval
+}
+
+// rotate 关闭当前文件并重命名，然后打开新文件并在后台压缩旧文件
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	backup := r.backupName(time.Now())
+	if err := os.Rename(r.path, backup); err != nil {
+		return err
+	}
+	if err := r.open(); err != nil {
+		r.file = nil
+		return err
+	}
+	go r.cleanup(backup)
+	return nil
+}
+
+// backupName 返回轮转文件的名称
+func (r *rotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(r.path)
+	return strings.TrimSuffix(r.path, ext) + "-" + t.Format(backupTimeFormat) + ext
+}
+
+// cleanup 压缩刚轮转的文件(为空时跳过)，再按保留天数与数量删除旧文件
+func (r *rotatingFile) cleanup(backup string) {
+	r.cleanupLock.Lock()
+	defer r.cleanupLock.Unlock()
+
+	if backup != "" {
+		if err := compressFile(backup); err != nil {
+			defaultLogger.Error("压缩日志文件失败", "file", backup, "error", err)
+		}
+	}
+
+	backups := r.backups()
+	for i, path := range backups {
+		expired := r.maxBackups > 0 && i >= r.maxBackups
+		if !expired && r.maxAge > 0 {
+			if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > r.maxAge {
+				expired = true
+			}
+		}
+		if expired {
+			os.Remove(path)
+		}
+	}
+}
+
+// backups 返回已轮转的文件，按时间从新到旧排序
+func (r *rotatingFile) backups() []string {
+	ext := filepath.Ext(r.path)
+	prefix := filepath.Base(strings.TrimSuffix(r.path, ext)) + "-"
+	entries, err := os.ReadDir(filepath.Dir(r.path))
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(stamp, prefix)); err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	// 文件名中的时间格式按字典序即按时间排序
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(filepath.Dir(r.path), name)
+	}
+	return paths
+}
+
+// Close 关闭日志文件
+func (r *rotatingFile) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// compressFile 将文件压缩为同名 .gz 文件并删除原文件，保留原文件的修改时间
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path+".gz"); err != nil {
+		return err
+	}
+	os.Chtimes(path+".gz", info.ModTime(), info.ModTime())
+	src.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,181 @@
+package download
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openTestRotatingFile 在临时目录中打开轮转日志文件，测试结束时关闭
+func openTestRotatingFile(t *testing.T, dir string, maxSize int64, interval, maxAge time.Duration, maxBackups int) *rotatingFile {
+	t.Helper()
+	r, err := newRotatingFile(filepath.Join(dir, "app.log"), maxSize, interval, maxAge, maxBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		r.Close()
+		r.cleanupLock.Lock()
+		r.cleanupLock.Unlock()
+	})
+	return r
+}
+
+// writeRotated 依次写入每一行，两次写入之间间隔几毫秒，避免轮转文件名中的时间重复
+func writeRotated(t *testing.T, r *rotatingFile, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		time.Sleep(2 * time.Millisecond)
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// compressedBackups 等待后台压缩与清理完成，返回按新到旧排序的轮转文件解压后的内容
+func compressedBackups(t *testing.T, r *rotatingFile, want int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		backups := r.backups()
+		done := len(backups) == want
+		for _, path := range backups {
+			if !strings.HasSuffix(path, ".gz") {
+				done = false
+			}
+		}
+		if done {
+			contents := make([]string, len(backups))
+			for i, path := range backups {
+				contents[i] = readGzip(t, path)
+			}
+			return contents
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("轮转文件为 %v，期望 %d 个已压缩的文件", backups, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// readGzip 返回 gzip 文件解压后的内容
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("%s 不是有效的 gzip 文件: %v", path, err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingFileRotate(t *testing.T) {
+	line := strings.Repeat("x", 59) + "\n"
+
+	tests := []struct {
+		name        string
+		maxSize     int64
+		interval    time.Duration
+		pause       time.Duration // 两次写入之间的等待时间
+		wantBackups []string      // 按新到旧排序的轮转文件内容
+		wantCurrent string
+	}{
+		{
+			name:        "未超过大小",
+			maxSize:     200,
+			wantCurrent: line + line,
+		},
+		{
+			name:        "超过大小时轮转",
+			maxSize:     100,
+			wantBackups: []string{line},
+			wantCurrent: line,
+		},
+		{
+			name:        "超过写入时长时轮转",
+			interval:    50 * time.Millisecond,
+			pause:       60 * time.Millisecond,
+			wantBackups: []string{line},
+			wantCurrent: line,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			r := openTestRotatingFile(t, dir, tt.maxSize, tt.interval, 0, 0)
+			writeRotated(t, r, line)
+			time.Sleep(tt.pause)
+			writeRotated(t, r, line)
+
+			if got := compressedBackups(t, r, len(tt.wantBackups)); len(got) > 0 && !reflect.DeepEqual(got, tt.wantBackups) {
+				t.Errorf("轮转文件内容为 %q，期望 %q", got, tt.wantBackups)
+			}
+			current, err := os.ReadFile(filepath.Join(dir, "app.log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(current) != tt.wantCurrent {
+				t.Errorf("当前日志文件内容为 %q，期望 %q", current, tt.wantCurrent)
+			}
+		})
+	}
+}
+
+func TestRotatingFilePrunesByCount(t *testing.T) {
+	r := openTestRotatingFile(t, t.TempDir(), 10, 0, 0, 2)
+	writeRotated(t, r, "line-1\n", "line-2\n", "line-3\n", "line-4\n", "line-5\n")
+
+	got := compressedBackups(t, r, 2)
+	if want := []string{"line-4\n", "line-3\n"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("保留的轮转文件内容为 %q，期望 %q", got, want)
+	}
+}
+
+func TestRotatingFilePrunesByAge(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "app-20200101-000000.000.log.gz")
+	recent := filepath.Join(dir, "app-"+time.Now().Add(-time.Hour).Format(backupTimeFormat)+".log.gz")
+	unrelated := filepath.Join(dir, "app-notes.log")
+	for _, path := range []string{old, recent, unrelated} {
+		writeFile(t, path, "")
+	}
+	expired := time.Now().Add(-48 * time.Hour)
+	for _, path := range []string{old, unrelated} {
+		if err := os.Chtimes(path, expired, expired); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 打开日志文件时在后台清理超过保留天数的文件
+	r := openTestRotatingFile(t, dir, 0, 0, 24*time.Hour, 0)
+	deadline := time.Now().Add(5 * time.Second)
+	for fileExists(old) {
+		if time.Now().After(deadline) {
+			t.Fatalf("超过保留天数的 %s 未被删除", old)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.cleanupLock.Lock()
+	r.cleanupLock.Unlock()
+
+	if !fileExists(recent) {
+		t.Errorf("未超过保留天数的 %s 被删除", recent)
+	}
+	if !fileExists(unrelated) {
+		t.Errorf("不是轮转文件的 %s 被删除", unrelated)
+	}
+}
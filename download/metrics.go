@@ -0,0 +1,49 @@
+package download
+
+import (
+	"PaiDownloader/metrics"
+	"net/http"
+	"strconv"
+)
+
+// 下载相关的 Prometheus 指标
+var (
+	tasksTotal = metrics.NewCounterVec("paidownloader_tasks_total",
+		"按资源类型与结果统计的已结束文件数", "type", "status")
+	downloadedBytes = metrics.NewCounterVec("paidownloader_downloaded_bytes_total",
+		"按资源类型统计的已接收字节数", "type")
+	retriesTotal = metrics.NewCounterVec("paidownloader_retries_total",
+		"按错误分类统计的重试次数", "error_class")
+	httpResponses = metrics.NewCounterVec("paidownloader_http_responses_total",
+		"按主机与状态码统计的下载请求响应数，请求未得到响应时 code 为 error", "host", "code")
+	downloadDuration = metrics.NewHistogramVec("paidownloader_download_duration_seconds",
+		"单个文件从开始到结束(含重试)的耗时", metrics.DefaultBuckets, "type", "status")
+	queueDepth = metrics.NewGaugeFunc("paidownloader_queue_depth",
+		"调度器中等待下载的文件数", nil, func() []metrics.Sample {
+			return []metrics.Sample{{Value: float64(Scheduler.Pending())}}
+		})
+)
+
+// observeTask 记录文件的结束结果与耗时
+func observeTask(entry DownloadHistoryEntry) {
+	tasksTotal.Inc(entry.Type, entry.Status)
+	if !entry.StartTime.IsZero() && !entry.EndTime.IsZero() {
+		downloadDuration.Observe(entry.EndTime.Sub(entry.StartTime).Seconds(), entry.Type, entry.Status)
+	}
+}
+
+// metricsTransport 记录每个请求按主机与状态码的响应数
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip 实现 http.RoundTripper 接口
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	httpResponses.Inc(req.URL.Hostname(), code)
+	return resp, err
+}
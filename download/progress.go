@@ -0,0 +1,146 @@
+package download
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	progressSampleInterval = 500 * time.Millisecond // 速度采样与进度事件的最小间隔
+	speedSmoothing         = 0.3                    // 移动平均速度中最新采样的权重
+)
+
+// TaskProgressEvent 文件下载过程中的字节进度事件数据
+type TaskProgressEvent struct {
+	URL        string  `json:"url"`
+	BytesDone  int64   `json:"bytes_done"`
+	BytesTotal int64   `json:"bytes_total"`
+	Speed      float64 `json:"speed"`
+	AvgSpeed   float64 `json:"avg_speed"`
+	ETA        float64 `json:"eta,omitempty"`
+}
+
+// transferMeter 统计单个文件已接收的字节数，定期计算瞬时速度、移动平均速度与剩余时间
+// 并写入文件状态、发布进度事件；分段下载的多个连接共享同一个计量器
+type transferMeter struct {
+	task         *DownloadTask
+	downloader   *ResourceDownloader
+	taskStatuses *[]TaskStatus
+
+	lock        sync.Mutex
+	done        int64
+	total       int64 // 0 表示总大小未知
+	sampleTime  time.Time
+	sampleBytes int64
+	speed       float64
+	avgSpeed    float64
+}
+
+// newTransferMeter 创建文件的字节计量器
+func newTransferMeter(task *DownloadTask, downloader *ResourceDownloader, taskStatuses *[]TaskStatus) *transferMeter {
+	return &transferMeter{task: task, downloader: downloader, taskStatuses: taskStatuses}
+}
+
+// Start 开始一次传输并将文件记为下载中，done 为已存在的字节数(续传时为临时文件大小)，total 为文件总大小
+func (m *transferMeter) Start(done, total int64) {
+	m.lock.Lock()
+	m.done = done
+	m.total = total
+	m.sampleTime = time.Now()
+	m.sampleBytes = done
+	m.speed = 0
+	m.lock.Unlock()
+	m.flush()
+}
+
+// Add 累加接收的字节数，距上次采样超过采样间隔时更新速度
+func (m *transferMeter) Add(n int64) {
+	downloadedBytes.Add(float64(n), m.task.Type)
+	m.lock.Lock()
+	m.done += n
+	now := time.Now()
+	elapsed := now.Sub(m.sampleTime)
+	if elapsed < progressSampleInterval {
+		m.lock.Unlock()
+		return
+	}
+	m.speed = float64(m.done-m.sampleBytes) / elapsed.Seconds()
+	if m.avgSpeed == 0 {
+		m.avgSpeed = m.speed
+	} else {
+		m.avgSpeed = speedSmoothing*m.speed + (1-speedSmoothing)*m.avgSpeed
+	}
+	m.sampleTime = now
+	m.sampleBytes = m.done
+	m.lock.Unlock()
+	m.flush()
+}
+
+// Reader 包装响应体，统计读取的字节数
+func (m *transferMeter) Reader(r io.Reader) io.Reader {
+	return &countingReader{r: r, meter: m}
+}
+
+// flush 将当前进度写入文件状态并发布进度事件
+func (m *transferMeter) flush() {
+	m.lock.Lock()
+	event := TaskProgressEvent{
+		URL:        m.task.URL,
+		BytesDone:  m.done,
+		BytesTotal: m.total,
+		Speed:      m.speed,
+		AvgSpeed:   m.avgSpeed,
+	}
+	m.lock.Unlock()
+	if event.BytesTotal > 0 && event.AvgSpeed > 0 && event.BytesDone < event.BytesTotal {
+		event.ETA = float64(event.BytesTotal-event.BytesDone) / event.AvgSpeed
+	}
+
+	TaskStatusLock.Lock()
+	for index := range *m.taskStatuses {
+		status := &(*m.taskStatuses)[index]
+		if status.URL != m.task.URL {
+			continue
+		}
+		// 文件已结束(如任务被取消)时不再覆盖最终状态
+		if status.Status == "pending" || status.Status == "downloading" {
+			status.Status = "downloading"
+			status.BytesDone = event.BytesDone
+			status.BytesTotal = event.BytesTotal
+			status.Speed = event.Speed
+			status.AvgSpeed = event.AvgSpeed
+			status.ETA = event.ETA
+		}
+		break
+	}
+	TaskStatusLock.Unlock()
+
+	m.downloader.publishProgress(m.task.URL, event)
+}
+
+// countingReader 统计读取字节数的读取器
+type countingReader struct {
+	r     io.Reader
+	meter *transferMeter
+}
+
+// Read 实现 io.Reader 接口
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	if n > 0 {
+		cr.meter.Add(int64(n))
+	}
+	return n, err
+}
+
+// finishTransfer 文件结束后更新字节进度：保存在本地的文件记为全部完成，其余文件清零速度与剩余时间
+// 调用方需持有 TaskStatusLock
+func finishTransfer(status *TaskStatus, size int64, hasFile bool) {
+	if hasFile {
+		status.BytesDone = size
+		status.BytesTotal = size
+	}
+	status.Speed = 0
+	status.ETA = 0
+}
@@ -0,0 +1,133 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Referer 策略，决定请求网页与资源时发送的 Referer
+const (
+	RefererPage   = "page"   // 发送网页的完整 URL
+	RefererOrigin = "origin" // 只发送网页的协议与主机，如 https://example.com/
+	RefererNone   = "none"   // 不发送 Referer
+)
+
+// ValidateRefererPolicy 检查 Referer 策略，为空时使用 page
+func ValidateRefererPolicy(policy string) error {
+	switch policy {
+	case "", RefererPage, RefererOrigin, RefererNone:
+		return nil
+	}
+	return fmt.Errorf("未知的 Referer 策略: %s，可选 page、origin、none", policy)
+}
+
+// ValidateHeaders 检查额外请求头的名称与取值，名称不能为空且不能包含空白或冒号，取值不能包含换行
+func ValidateHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("无效的请求头名称: %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("请求头 %s 的取值不能包含换行", name)
+		}
+	}
+	return nil
+}
+
+// referer 按 Referer 策略返回请求发送的 Referer，为空时不发送
+func (d *ResourceDownloader) referer() string {
+	if d.BaseURL == nil {
+		return ""
+	}
+	switch d.RefererPolicy {
+	case RefererNone:
+		return ""
+	case RefererOrigin:
+		return d.BaseURL.Scheme + "://" + d.BaseURL.Host + "/"
+	default:
+		return d.BaseURL.String()
+	}
+}
+
+// setRequestHeaders 设置请求的 User-Agent、Referer 与任务指定的额外请求头，额外请求头覆盖同名的默认请求头
+// 范围请求与条件请求的请求头由调用方在之后设置，不会被覆盖
+func (d *ResourceDownloader) setRequestHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", d.UserAgent)
+	if referer := d.referer(); referer != "" {
+		req.Header.Set("Referer", referer)
+	}
+	for name, value := range d.Headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// doRequest 发送请求，Timeout 限制从发送请求到收到响应头的时间，以及响应体每次读取等待数据的时间
+// 不限制整个响应的总时长，限速或暂停中的大文件不会因总时长超过 Timeout 而被中断
+// 超时以 context.DeadlineExceeded 返回，按超时错误分类并重试
+func (d *ResourceDownloader) doRequest(req *http.Request) (*http.Response, error) {
+	if d.Timeout <= 0 {
+		return d.GetHTTPClient().Do(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	guard := &timeoutGuard{timeout: d.Timeout, cancel: cancel}
+	guard.timer = time.AfterFunc(d.Timeout, guard.expire)
+
+	resp, err := d.GetHTTPClient().Do(req.WithContext(ctx))
+	guard.timer.Stop()
+	if err != nil {
+		cancel()
+		return nil, guard.wrap(err)
+	}
+	resp.Body = &idleTimeoutBody{body: resp.Body, guard: guard}
+	return resp, nil
+}
+
+// timeoutGuard 超时后取消请求，并将随之产生的取消错误转换为超时错误
+type timeoutGuard struct {
+	timeout time.Duration
+	cancel  context.CancelFunc
+	timer   *time.Timer
+	expired int32
+}
+
+// expire 超时后取消请求
+func (g *timeoutGuard) expire() {
+	atomic.StoreInt32(&g.expired, 1)
+	g.cancel()
+}
+
+// wrap 请求因超时被取消时返回超时错误，否则原样返回
+func (g *timeoutGuard) wrap(err error) error {
+	if err == nil || err == io.EOF || atomic.LoadInt32(&g.expired) == 0 {
+		return err
+	}
+	return fmt.Errorf("%s 内未收到服务器数据: %w", g.timeout, context.DeadlineExceeded)
+}
+
+// idleTimeoutBody 响应体的读取空闲超时，只在等待数据时计时，读取之间的限速等待与暂停不计入
+type idleTimeoutBody struct {
+	body  io.ReadCloser
+	guard *timeoutGuard
+}
+
+// Read 实现 io.Reader 接口
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	b.guard.timer.Reset(b.guard.timeout)
+	n, err := b.body.Read(p)
+	b.guard.timer.Stop()
+	return n, b.guard.wrap(err)
+}
+
+// Close 关闭响应体并释放请求的上下文
+func (b *idleTimeoutBody) Close() error {
+	b.guard.timer.Stop()
+	err := b.body.Close()
+	b.guard.cancel()
+	return err
+}
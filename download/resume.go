@@ -0,0 +1,116 @@
+package download
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// partMeta 记录 .part 文件对应的资源信息，用于断点续传时确认远端资源未发生变化
+type partMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag"`
+	LastModified string    `json:"last_modified"`
+	Size         int64     `json:"size,omitempty"`     // 分段下载时的文件总大小
+	Segments     []segment `json:"segments,omitempty"` // 分段下载时各分段的进度
+}
+
+// partPath 返回下载中的临时文件路径
+func partPath(savePath string) string {
+	return savePath + ".part"
+}
+
+// partMetaPath 返回临时文件旁路元数据的路径
+func partMetaPath(savePath string) string {
+	return savePath + ".part.json"
+}
+
+// loadPartMeta 读取临时文件的元数据
+func loadPartMeta(savePath string) (partMeta, bool) {
+	var meta partMeta
+	data, err := os.ReadFile(partMetaPath(savePath))
+	if err != nil {
+		return meta, false
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, false
+	}
+	return meta, true
+}
+
+// savePartMeta 写入临时文件的元数据
+func savePartMeta(savePath string, meta partMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(partMetaPath(savePath), data, 0644)
+}
+
+// removePartial 删除临时文件及其元数据
+func removePartial(savePath string) {
+	os.Remove(partPath(savePath))
+	os.Remove(partMetaPath(savePath))
+}
+
+// ifRangeValidator 返回可用于 If-Range 的校验值，弱 ETag 不能用于范围请求
+func (m partMeta) ifRangeValidator() string {
+	if m.ETag != "" && !strings.HasPrefix(m.ETag, "W/") {
+		return m.ETag
+	}
+	return m.LastModified
+}
+
+// resumeOffset 检查已有的临时文件，返回可续传的起始偏移量及对应的元数据
+// 临时文件与当前 URL 不匹配、缺少校验值或来自分段下载时清理残留并从头下载
+func resumeOffset(savePath, rawURL string) (int64, partMeta) {
+	info, err := os.Stat(partPath(savePath))
+	if err != nil {
+		os.Remove(partMetaPath(savePath))
+		return 0, partMeta{}
+	}
+
+	meta, ok := loadPartMeta(savePath)
+	if !ok || meta.URL != rawURL || meta.ifRangeValidator() == "" || info.Size() == 0 || len(meta.Segments) > 0 {
+		removePartial(savePath)
+		return 0, partMeta{}
+	}
+	return info.Size(), meta
+}
+
+// contentRangeStart 解析 Content-Range 响应头中的起始偏移量
+func contentRangeStart(header string) (int64, bool) {
+	var start, end int64
+	if _, err := fmt.Sscanf(header, "bytes %d-%d/", &start, &end); err != nil {
+		return 0, false
+	}
+	return start, true
+}
+
+// openPartFile 根据响应状态打开临时文件：206 时追加写入并将已有内容计入校验，其他情况清空重写
+func openPartFile(savePath string, offset int64, resp *http.Response, hasher io.Writer) (*os.File, error) {
+	if resp.StatusCode == http.StatusPartialContent && offset > 0 {
+		file, err := os.OpenFile(partPath(savePath), os.O_RDWR, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("打开文件失败: %v", err)
+		}
+		if _, err := io.CopyN(hasher, file, offset); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("读取已下载内容失败: %v", err)
+		}
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("定位文件失败: %v", err)
+		}
+		return file, nil
+	}
+
+	file, err := os.Create(partPath(savePath))
+	if err != nil {
+		return nil, fmt.Errorf("创建文件失败: %v", err)
+	}
+	return file, nil
+}
@@ -0,0 +1,252 @@
+package download
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const resumeContent = "0123456789abcdef" // 测试资源的完整内容
+
+func TestResumeOffset(t *testing.T) {
+	const rawURL = "https://example.com/file.bin"
+
+	tests := []struct {
+		name       string
+		part       string // 临时文件内容，为空表示不存在
+		meta       *partMeta
+		wantOffset int64
+		wantClean  bool // 期望清理临时文件与元数据
+	}{
+		{name: "没有临时文件", wantOffset: 0},
+		{name: "强 ETag", part: "0123", meta: &partMeta{URL: rawURL, ETag: `"v1"`}, wantOffset: 4},
+		{name: "只有 Last-Modified", part: "0123", meta: &partMeta{URL: rawURL, LastModified: "Wed, 01 Jan 2025 00:00:00 GMT"}, wantOffset: 4},
+		{name: "缺少元数据", part: "0123", wantClean: true},
+		{name: "URL 不同", part: "0123", meta: &partMeta{URL: rawURL + "?v=2", ETag: `"v1"`}, wantClean: true},
+		{name: "只有弱 ETag", part: "0123", meta: &partMeta{URL: rawURL, ETag: `W/"v1"`}, wantClean: true},
+		{name: "来自分段下载", part: "0123", meta: &partMeta{URL: rawURL, ETag: `"v1"`, Size: 16, Segments: []segment{{Start: 0, End: 15}}}, wantClean: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			savePath := filepath.Join(t.TempDir(), "file.bin")
+			if tt.part != "" {
+				writeFile(t, partPath(savePath), tt.part)
+			}
+			if tt.meta != nil {
+				if err := savePartMeta(savePath, *tt.meta); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			offset, meta := resumeOffset(savePath, rawURL)
+			if offset != tt.wantOffset {
+				t.Errorf("resumeOffset() = %d，期望 %d", offset, tt.wantOffset)
+			}
+			if offset > 0 && meta.ifRangeValidator() == "" {
+				t.Error("可续传时缺少 If-Range 校验值")
+			}
+			if tt.wantClean {
+				if fileExists(partPath(savePath)) || fileExists(partMetaPath(savePath)) {
+					t.Error("无法续传的临时文件未被清理")
+				}
+			}
+		})
+	}
+}
+
+// resumeServer 记录测试服务器收到的 Range 与 If-Range 请求头
+type resumeServer struct {
+	lock     sync.Mutex
+	ranges   []string
+	ifRanges []string
+}
+
+// record 记录一次请求的续传请求头
+func (s *resumeServer) record(r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	s.ifRanges = append(s.ifRanges, r.Header.Get("If-Range"))
+}
+
+func TestDownloadResourceResume(t *testing.T) {
+	// serveRange 按 If-Range 与 ETag 响应范围请求
+	serveRange := func(etag, content string) func(w http.ResponseWriter, r *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", etag)
+			var start int
+			if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err == nil && r.Header.Get("If-Range") == etag {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+				w.WriteHeader(http.StatusPartialContent)
+				fmt.Fprint(w, content[start:])
+				return
+			}
+			fmt.Fprint(w, content)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		part         string // 已下载的临时文件内容
+		partETag     string // 临时文件记录的 ETag
+		handler      func(w http.ResponseWriter, r *http.Request)
+		want         string // 下载完成后的文件内容
+		wantETag     string
+		wantRequests []string // 每次请求的 Range 请求头
+		wantErr      bool
+	}{
+		{
+			name:         "206 从断点继续",
+			part:         resumeContent[:6],
+			partETag:     `"v1"`,
+			handler:      serveRange(`"v1"`, resumeContent),
+			want:         resumeContent,
+			wantETag:     `"v1"`,
+			wantRequests: []string{"bytes=6-"},
+		},
+		{
+			name:     "服务器忽略范围请求返回 200",
+			part:     resumeContent[:6],
+			partETag: `"v1"`,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", `"v1"`)
+				fmt.Fprint(w, resumeContent)
+			},
+			want:         resumeContent,
+			wantETag:     `"v1"`,
+			wantRequests: []string{"bytes=6-"},
+		},
+		{
+			name:         "ETag 已变化时从头下载",
+			part:         resumeContent[:6],
+			partETag:     `"v1"`,
+			handler:      serveRange(`"v2"`, strings.ToUpper(resumeContent)),
+			want:         strings.ToUpper(resumeContent),
+			wantETag:     `"v2"`,
+			wantRequests: []string{"bytes=6-"},
+		},
+		{
+			name:     "416 时清理临时文件并重新下载",
+			part:     resumeContent + "extra",
+			partETag: `"v1"`,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", `"v1"`)
+				if r.Header.Get("Range") != "" {
+					w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(resumeContent)))
+					w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+					return
+				}
+				fmt.Fprint(w, resumeContent)
+			},
+			want:         resumeContent,
+			wantETag:     `"v1"`,
+			wantRequests: []string{"bytes=21-", ""},
+		},
+		{
+			name:     "续传偏移不匹配",
+			part:     resumeContent[:6],
+			partETag: `"v1"`,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", `"v1"`)
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(resumeContent)-1, len(resumeContent)))
+				w.WriteHeader(http.StatusPartialContent)
+				fmt.Fprint(w, resumeContent)
+			},
+			wantRequests: []string{"bytes=6-"},
+			wantErr:      true,
+		},
+		{
+			name: "没有临时文件时不发送范围请求",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", `"v1"`)
+				fmt.Fprint(w, resumeContent)
+			},
+			want:         resumeContent,
+			wantETag:     `"v1"`,
+			wantRequests: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &resumeServer{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				recorder.record(r)
+				tt.handler(w, r)
+			}))
+			defer server.Close()
+
+			d := newTestDownloader(t, server)
+			d.OutputDir = t.TempDir()
+			d.Segments = 1
+			task := &DownloadTask{URL: server.URL + "/file.bin", Type: "archive", Filename: "file.bin"}
+			savePath := filepath.Join(d.OutputDir, task.Type, task.Filename)
+			if tt.part != "" {
+				if err := os.MkdirAll(filepath.Dir(savePath), 0755); err != nil {
+					t.Fatal(err)
+				}
+				writeFile(t, partPath(savePath), tt.part)
+				if err := savePartMeta(savePath, partMeta{URL: task.URL, ETag: tt.partETag}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := DownloadResource(task, d, &Progress{}, &[]TaskStatus{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DownloadResource() error = %v，期望出错 %v", err, tt.wantErr)
+			}
+
+			recorder.lock.Lock()
+			ranges := recorder.ranges
+			recorder.lock.Unlock()
+			if strings.Join(ranges, ",") != strings.Join(tt.wantRequests, ",") {
+				t.Errorf("Range 请求头依次为 %q，期望 %q", ranges, tt.wantRequests)
+			}
+			for i, value := range recorder.ifRanges {
+				if ranges[i] != "" && value != tt.partETag {
+					t.Errorf("If-Range = %q，期望 %q", value, tt.partETag)
+				}
+			}
+
+			if tt.wantErr {
+				if fileExists(partPath(savePath)) || fileExists(partMetaPath(savePath)) {
+					t.Error("续传失败后未清理临时文件")
+				}
+				return
+			}
+			data, err := os.ReadFile(savePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("文件内容为 %q，期望 %q", data, tt.want)
+			}
+			if task.Size != int64(len(tt.want)) || task.ETag != tt.wantETag {
+				t.Errorf("任务大小 %d、ETag %q，期望 %d、%q", task.Size, task.ETag, len(tt.want), tt.wantETag)
+			}
+			if fileExists(partPath(savePath)) || fileExists(partMetaPath(savePath)) {
+				t.Error("下载完成后仍保留临时文件")
+			}
+		})
+	}
+}
+
+// writeFile 写入测试文件
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fileExists 判断文件是否存在
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,203 @@
+package download
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// 下载失败的错误分类
+const (
+	ErrorClassHTTPClient  = "http_4xx"     // 4xx 客户端错误
+	ErrorClassHTTPServer  = "http_5xx"     // 5xx 服务端错误
+	ErrorClassRateLimited = "rate_limited" // 429 请求过多
+	ErrorClassDNS         = "dns"          // 域名解析失败
+	ErrorClassTLS         = "tls"          // TLS 握手或证书错误
+	ErrorClassTimeout     = "timeout"      // 连接或读取超时
+	ErrorClassNetwork     = "network"      // 连接被拒绝、重置等网络错误
+	ErrorClassOther       = "other"        // 其他错误
+)
+
+const maxRetryAfter = 5 * time.Minute // 服务器要求的等待时间超过该值时不再重试
+
+// DefaultRetryPolicy 默认的重试策略
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  time.Second,
+	MaxDelay:   30 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// RetryPolicy 定义下载失败后的重试策略：指数退避、随机抖动与延迟上限
+type RetryPolicy struct {
+	MaxRetries int           // 最大重试次数
+	BaseDelay  time.Duration // 首次重试前的等待时间
+	MaxDelay   time.Duration // 单次等待时间上限
+	Multiplier float64       // 每次重试等待时间的增长倍数
+	Jitter     float64       // 随机抖动比例(0~1)，避免大量任务同时重试
+}
+
+// HTTPStatusError 表示服务器返回了非预期的状态码
+type HTTPStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration // 服务器通过 Retry-After 要求的等待时间
+}
+
+// Error 实现 error 接口
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("HTTP状态码错误: %d", e.StatusCode)
+}
+
+// newHTTPStatusError 根据响应创建状态码错误，并解析 Retry-After 响应头
+func newHTTPStatusError(resp *http.Response) *HTTPStatusError {
+	return &HTTPStatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter 解析 Retry-After 响应头，支持秒数与 HTTP 日期两种格式
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// ClassifyError 返回错误所属的分类
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode == http.StatusTooManyRequests:
+			return ErrorClassRateLimited
+		case statusErr.StatusCode >= 500:
+			return ErrorClassHTTPServer
+		default:
+			return ErrorClassHTTPClient
+		}
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrorClassDNS
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrorClassTimeout
+	}
+
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	if errors.As(err, &certErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &unknownAuthority) || errors.As(err, &hostnameErr) || errors.As(err, &invalidCert) {
+		return ErrorClassTLS
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrorClassNetwork
+	}
+
+	return ErrorClassOther
+}
+
+// ShouldRetry 判断第 attempt 次(从 0 开始)尝试失败后是否应继续重试
+// 4xx 中只有 408/425/429 可重试；域名不存在、证书错误与任务取消不再重试
+func (p RetryPolicy) ShouldRetry(err error, attempt int) bool {
+	if err == nil || attempt >= p.MaxRetries || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.RetryAfter > maxRetryAfter {
+			return false
+		}
+		switch statusErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+			return true
+		}
+		return statusErr.StatusCode >= 500
+	}
+
+	switch ClassifyError(err) {
+	case ErrorClassDNS:
+		var dnsErr *net.DNSError
+		errors.As(err, &dnsErr)
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	case ErrorClassTLS:
+		return false
+	}
+	return true
+}
+
+// Backoff 返回第 attempt 次(从 0 开始)失败后重试前的等待时间
+// 服务器在 429/503 响应中给出 Retry-After 时以其为准
+func (p RetryPolicy) Backoff(attempt int, err error) time.Duration {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 &&
+		(statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode == http.StatusServiceUnavailable) {
+		return statusErr.RetryAfter
+	}
+
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(p.BaseDelay) * math.Pow(multiplier, float64(attempt))
+
+	// 超时错误多由网络拥塞引起，额外放大等待时间
+	if ClassifyError(err) == ErrorClassTimeout {
+		delay *= 1.5
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay)
+}
+
+// retryPolicy 返回下载器使用的重试策略，未单独配置时以 RetryTimes 作为最大重试次数
+func (d *ResourceDownloader) retryPolicy() RetryPolicy {
+	if d.RetryPolicy != nil {
+		return *d.RetryPolicy
+	}
+	policy := DefaultRetryPolicy
+	policy.MaxRetries = d.RetryTimes
+	return policy
+}
@@ -0,0 +1,236 @@
+package download
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "无错误", err: nil, want: ""},
+		{name: "404", err: &HTTPStatusError{StatusCode: http.StatusNotFound}, want: ErrorClassHTTPClient},
+		{name: "429", err: &HTTPStatusError{StatusCode: http.StatusTooManyRequests}, want: ErrorClassRateLimited},
+		{name: "503", err: &HTTPStatusError{StatusCode: http.StatusServiceUnavailable}, want: ErrorClassHTTPServer},
+		{name: "包装的状态码错误", err: fmt.Errorf("下载失败: %w", &HTTPStatusError{StatusCode: 502}), want: ErrorClassHTTPServer},
+		{name: "域名解析失败", err: &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}, want: ErrorClassDNS},
+		{name: "读取空闲超时", err: fmt.Errorf("30s 内未收到服务器数据: %w", context.DeadlineExceeded), want: ErrorClassTimeout},
+		{name: "连接超时", err: &net.OpError{Op: "dial", Err: timeoutError{}}, want: ErrorClassTimeout},
+		{name: "证书不受信任", err: x509.UnknownAuthorityError{}, want: ErrorClassTLS},
+		{name: "连接被拒绝", err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, want: ErrorClassNetwork},
+		{name: "连接被重置", err: fmt.Errorf("read: %w", syscall.ECONNRESET), want: ErrorClassNetwork},
+		{name: "响应体不完整", err: io.ErrUnexpectedEOF, want: ErrorClassNetwork},
+		{name: "其他错误", err: errors.New("磁盘已满"), want: ErrorClassOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError(%v) = %q，期望 %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// timeoutError 实现 net.Error 的超时错误
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestShouldRetry(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 3}
+
+	tests := []struct {
+		name    string
+		err     error
+		attempt int
+		want    bool
+	}{
+		{name: "无错误", err: nil, attempt: 0, want: false},
+		{name: "重试次数用尽", err: &HTTPStatusError{StatusCode: 500}, attempt: 3, want: false},
+		{name: "5xx", err: &HTTPStatusError{StatusCode: 500}, attempt: 0, want: true},
+		{name: "404", err: &HTTPStatusError{StatusCode: 404}, attempt: 0, want: false},
+		{name: "403", err: &HTTPStatusError{StatusCode: 403}, attempt: 0, want: false},
+		{name: "408", err: &HTTPStatusError{StatusCode: 408}, attempt: 0, want: true},
+		{name: "425", err: &HTTPStatusError{StatusCode: 425}, attempt: 0, want: true},
+		{name: "429", err: &HTTPStatusError{StatusCode: 429, RetryAfter: time.Minute}, attempt: 0, want: true},
+		{name: "Retry-After 过长", err: &HTTPStatusError{StatusCode: 503, RetryAfter: time.Hour}, attempt: 0, want: false},
+		{name: "任务取消", err: fmt.Errorf("下载中断: %w", context.Canceled), attempt: 0, want: false},
+		{name: "域名不存在", err: &net.DNSError{Err: "no such host", IsNotFound: true}, attempt: 0, want: false},
+		{name: "域名解析超时", err: &net.DNSError{Err: "timeout", IsTimeout: true}, attempt: 0, want: true},
+		{name: "证书错误", err: x509.UnknownAuthorityError{}, attempt: 0, want: false},
+		{name: "读取超时", err: context.DeadlineExceeded, attempt: 2, want: true},
+		{name: "连接被重置", err: syscall.ECONNRESET, attempt: 1, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.ShouldRetry(tt.err, tt.attempt); got != tt.want {
+				t.Errorf("ShouldRetry(%v, %d) = %v，期望 %v", tt.err, tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second, Multiplier: 2}
+	serverErr := &HTTPStatusError{StatusCode: 500}
+
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		err     error
+		want    time.Duration
+	}{
+		{name: "首次重试", policy: policy, attempt: 0, err: serverErr, want: time.Second},
+		{name: "指数增长", policy: policy, attempt: 2, err: serverErr, want: 4 * time.Second},
+		{name: "不超过上限", policy: policy, attempt: 10, err: serverErr, want: 10 * time.Second},
+		{name: "超时错误放大等待时间", policy: policy, attempt: 1, err: context.DeadlineExceeded, want: 3 * time.Second},
+		{name: "倍数小于 1 时不增长", policy: RetryPolicy{BaseDelay: time.Second, Multiplier: 0.5}, attempt: 3, err: serverErr, want: time.Second},
+		{
+			name:    "429 以 Retry-After 为准",
+			policy:  policy,
+			attempt: 0,
+			err:     &HTTPStatusError{StatusCode: 429, RetryAfter: 42 * time.Second},
+			want:    42 * time.Second,
+		},
+		{
+			name:    "503 以 Retry-After 为准",
+			policy:  policy,
+			attempt: 3,
+			err:     &HTTPStatusError{StatusCode: 503, RetryAfter: 2 * time.Second},
+			want:    2 * time.Second,
+		},
+		{
+			name:    "500 忽略 Retry-After",
+			policy:  policy,
+			attempt: 0,
+			err:     &HTTPStatusError{StatusCode: 500, RetryAfter: 42 * time.Second},
+			want:    time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Backoff(tt.attempt, tt.err); got != tt.want {
+				t.Errorf("Backoff(%d, %v) = %s，期望 %s", tt.attempt, tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute, Multiplier: 2, Jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		got := policy.Backoff(1, errors.New("失败"))
+		if got < 1600*time.Millisecond || got > 2400*time.Millisecond {
+			t.Fatalf("Backoff = %s，超出 2s±20%% 的范围", got)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{name: "未设置", value: "", min: 0, max: 0},
+		{name: "秒数", value: "120", min: 2 * time.Minute, max: 2 * time.Minute},
+		{name: "负数", value: "-1", min: 0, max: 0},
+		{name: "HTTP 日期", value: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), min: 58 * time.Second, max: time.Minute},
+		{name: "已过去的日期", value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), min: 0, max: 0},
+		{name: "无效格式", value: "soon", min: 0, max: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRetryAfter(tt.value)
+			if got < tt.min || got > tt.max {
+				t.Errorf("parseRetryAfter(%q) = %s，期望在 %s 与 %s 之间", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestFetchHTMLRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int // 依次返回的状态码
+		wantErr    bool
+		wantStatus int // 期望返回的 HTTPStatusError 状态码
+		wantCalls  int
+	}{
+		{name: "成功", statuses: []int{200}, wantCalls: 1},
+		{name: "5xx 后重试成功", statuses: []int{503, 502, 200}, wantCalls: 3},
+		{name: "404 不重试", statuses: []int{404}, wantErr: true, wantStatus: 404, wantCalls: 1},
+		{name: "重试次数用尽", statuses: []int{500, 500, 500}, wantErr: true, wantStatus: 500, wantCalls: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := newStatusServer(t, func(w http.ResponseWriter) {
+				status := tt.statuses[calls]
+				calls++
+				w.WriteHeader(status)
+				fmt.Fprint(w, "<html></html>")
+			})
+
+			d := newTestDownloader(t, server)
+			d.RetryPolicy = &RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, Multiplier: 1}
+			_, err := d.FetchHTML()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FetchHTML() error = %v，期望出错 %v", err, tt.wantErr)
+			}
+			var statusErr *HTTPStatusError
+			if tt.wantStatus != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus) {
+				t.Errorf("FetchHTML() error = %v，期望状态码 %d", err, tt.wantStatus)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("请求了 %d 次，期望 %d 次", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// newStatusServer 启动按 handle 响应的测试服务器，测试结束时关闭
+func newStatusServer(t *testing.T, handle func(w http.ResponseWriter)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle(w)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestDownloader 创建以测试服务器为网页地址的下载器，不输出日志
+func newTestDownloader(t *testing.T, server *httptest.Server) *ResourceDownloader {
+	t.Helper()
+	baseURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ResourceDownloader{
+		BaseURL: baseURL,
+		Timeout: 5 * time.Second,
+		Logger:  NewLogger(io.Discard, LevelError),
+	}
+}
@@ -0,0 +1,310 @@
+package download
+
+import (
+	"math/rand"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheduler 全局任务调度器，按主机限制并发与请求间隔，并在主机之间轮询分发任务
+var Scheduler = NewHostScheduler(DefaultHostPolicy)
+
+// DefaultHostPolicy 默认的主机调度策略
+var DefaultHostPolicy = HostPolicy{
+	MaxConnections: 3,
+	Delay:          100 * time.Millisecond,
+	Jitter:         50 * time.Millisecond,
+}
+
+// HostPolicy 单个主机的调度策略
+type HostPolicy struct {
+	MaxConnections int           // 同一主机的最大并发连接数，0 表示不限制
+	Delay          time.Duration // 同一主机两次请求之间的最小间隔
+	Jitter         time.Duration // 请求间隔额外附加的随机抖动上限
+}
+
+// HostScheduler 按主机分组的任务队列，工作协程通过 Next 获取下一个可执行的任务
+type HostScheduler struct {
+	lock      sync.Mutex
+	cond      *sync.Cond
+	defaults  HostPolicy
+	overrides map[string]HostPolicy
+
+	queues      map[string][]DownloadTask // 每个主机的待处理任务
+	hosts       []string                  // 有待处理任务的主机，按轮询顺序排列
+	next        int                       // 下一次轮询的起始位置
+	active      map[string]int            // 每个主机正在进行的任务数
+	nextAllowed map[string]time.Time      // 每个主机下一次允许发起请求的时间
+	paused      map[string]bool           // 已暂停的任务 ID，其文件暂不分发
+	closed      bool
+}
+
+// NewHostScheduler 创建一个主机调度器
+func NewHostScheduler(defaults HostPolicy) *HostScheduler {
+	s := &HostScheduler{
+		defaults:    defaults,
+		overrides:   make(map[string]HostPolicy),
+		queues:      make(map[string][]DownloadTask),
+		active:      make(map[string]int),
+		nextAllowed: make(map[string]time.Time),
+		paused:      make(map[string]bool),
+	}
+	s.cond = sync.NewCond(&s.lock)
+	return s
+}
+
+// SetPolicy 设置默认策略与按主机覆盖的策略
+func (s *HostScheduler) SetPolicy(defaults HostPolicy, overrides map[string]HostPolicy) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.defaults = defaults
+	s.overrides = make(map[string]HostPolicy, len(overrides))
+	for host, policy := range overrides {
+		s.overrides[strings.ToLower(host)] = policy
+	}
+	s.cond.Broadcast()
+}
+
+// policyFor 返回主机对应的调度策略，调用方需持有锁
+func (s *HostScheduler) policyFor(host string) HostPolicy {
+	if policy, ok := s.overrides[host]; ok {
+		return policy
+	}
+	return s.defaults
+}
+
+// Submit 将任务加入对应主机的队列，排在优先级不低于它的任务之后
+func (s *HostScheduler) Submit(task DownloadTask) {
+	host := taskHost(task.URL)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.queues[host]) == 0 {
+		s.hosts = append(s.hosts, host)
+	}
+	s.insertLocked(host, task)
+	s.cond.Signal()
+}
+
+// insertLocked 按优先级将任务插入主机队列，调用方需持有锁
+func (s *HostScheduler) insertLocked(host string, task DownloadTask) {
+	queue := s.queues[host]
+	pos := len(queue)
+	for pos > 0 && queue[pos-1].Priority < task.Priority {
+		pos--
+	}
+	queue = append(queue, DownloadTask{})
+	copy(queue[pos+1:], queue[pos:])
+	queue[pos] = task
+	s.queues[host] = queue
+}
+
+// Reprioritize 调整尚未开始的文件的优先级并重新排队，文件不在队列中时返回 false
+func (s *HostScheduler) Reprioritize(jobID, taskURL string, priority int) bool {
+	host := taskHost(taskURL)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	queue := s.queues[host]
+	for i, task := range queue {
+		if task.HistoryID != jobID || task.URL != taskURL {
+			continue
+		}
+		task.Priority = priority
+		s.queues[host] = append(queue[:i], queue[i+1:]...)
+		s.insertLocked(host, task)
+		s.cond.Broadcast()
+		return true
+	}
+	return false
+}
+
+// Next 阻塞直到有主机满足并发与间隔限制，按轮询顺序取出其首个未暂停的任务；调度器关闭后返回 false
+func (s *HostScheduler) Next() (DownloadTask, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for {
+		if s.closed {
+			return DownloadTask{}, false
+		}
+
+		now := time.Now()
+		var wait time.Duration
+		for i := 0; i < len(s.hosts); i++ {
+			idx := (s.next + i) % len(s.hosts)
+			host := s.hosts[idx]
+			policy := s.policyFor(host)
+
+			if policy.MaxConnections > 0 && s.active[host] >= policy.MaxConnections {
+				continue
+			}
+			if allowed := s.nextAllowed[host]; now.Before(allowed) {
+				if d := allowed.Sub(now); wait == 0 || d < wait {
+					wait = d
+				}
+				continue
+			}
+
+			pos := s.runnable(host)
+			if pos < 0 {
+				continue
+			}
+			queue := s.queues[host]
+			task := queue[pos]
+			s.queues[host] = append(queue[:pos], queue[pos+1:]...)
+			s.active[host]++
+			s.nextAllowed[host] = now.Add(policy.Delay + randomJitter(policy.Jitter))
+
+			if len(s.queues[host]) == 0 {
+				delete(s.queues, host)
+				s.hosts = append(s.hosts[:idx], s.hosts[idx+1:]...)
+				s.next = idx
+			} else {
+				s.next = idx + 1
+			}
+			if len(s.hosts) > 0 {
+				s.next %= len(s.hosts)
+			} else {
+				s.next = 0
+			}
+			return task, true
+		}
+
+		// 没有可执行的任务时等待新任务、任务结束或最近一个主机间隔到期
+		if wait > 0 {
+			timer := time.AfterFunc(wait, s.cond.Broadcast)
+			s.cond.Wait()
+			timer.Stop()
+		} else {
+			s.cond.Wait()
+		}
+	}
+}
+
+// runnable 返回主机队列中首个不属于已暂停任务的位置，没有时返回 -1，调用方需持有锁
+func (s *HostScheduler) runnable(host string) int {
+	for i, task := range s.queues[host] {
+		if !s.paused[task.HistoryID] {
+			return i
+		}
+	}
+	return -1
+}
+
+// SetJobPaused 暂停或恢复分发指定任务(Job)的文件
+func (s *HostScheduler) SetJobPaused(jobID string, paused bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if paused {
+		s.paused[jobID] = true
+	} else {
+		delete(s.paused, jobID)
+	}
+	s.cond.Broadcast()
+}
+
+// RemoveJob 移除指定任务(Job)尚未开始的文件，返回被移除的文件
+func (s *HostScheduler) RemoveJob(jobID string) []DownloadTask {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var removed []DownloadTask
+	hosts := s.hosts[:0]
+	for _, host := range s.hosts {
+		kept := s.queues[host][:0]
+		for _, task := range s.queues[host] {
+			if task.HistoryID == jobID {
+				removed = append(removed, task)
+			} else {
+				kept = append(kept, task)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.queues, host)
+			continue
+		}
+		s.queues[host] = kept
+		hosts = append(hosts, host)
+	}
+	s.hosts = hosts
+	if s.next >= len(s.hosts) {
+		s.next = 0
+	}
+	delete(s.paused, jobID)
+	return removed
+}
+
+// Done 任务结束后释放主机的并发名额
+func (s *HostScheduler) Done(task DownloadTask) {
+	host := taskHost(task.URL)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.active[host] > 0 {
+		s.active[host]--
+	}
+	if s.active[host] == 0 {
+		delete(s.active, host)
+	}
+	s.cond.Broadcast()
+}
+
+// Clear 丢弃所有尚未开始的任务，返回丢弃的任务
+func (s *HostScheduler) Clear() []DownloadTask {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var dropped []DownloadTask
+	for _, host := range s.hosts {
+		dropped = append(dropped, s.queues[host]...)
+	}
+	s.queues = make(map[string][]DownloadTask)
+	s.hosts = nil
+	s.next = 0
+	return dropped
+}
+
+// Pending 返回尚未开始的任务数
+func (s *HostScheduler) Pending() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	count := 0
+	for _, queue := range s.queues {
+		count += len(queue)
+	}
+	return count
+}
+
+// Close 关闭调度器，唤醒所有等待中的工作协程
+func (s *HostScheduler) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	s.cond.Broadcast()
+}
+
+// taskHost 返回任务 URL 的主机名，作为调度分组的依据
+func taskHost(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// randomJitter 返回 [0, max) 范围内的随机时长
+func randomJitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
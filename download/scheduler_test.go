@@ -0,0 +1,258 @@
+package download
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// schedulerTask 创建一个指定主机与任务的测试文件
+func schedulerTask(host, name, jobID string, priority int) DownloadTask {
+	return DownloadTask{URL: "https://" + host + "/" + name, HistoryID: jobID, Priority: priority}
+}
+
+// newTestScheduler 创建一个测试结束时关闭的调度器
+func newTestScheduler(t *testing.T, policy HostPolicy) *HostScheduler {
+	t.Helper()
+	s := NewHostScheduler(policy)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// nextAsync 在后台调用 Next，返回接收结果的通道
+func nextAsync(s *HostScheduler) <-chan DownloadTask {
+	result := make(chan DownloadTask, 1)
+	go func() {
+		if task, ok := s.Next(); ok {
+			result <- task
+		}
+	}()
+	return result
+}
+
+// mustNext 取出下一个任务，一秒内没有可执行的任务时结束测试
+func mustNext(t *testing.T, s *HostScheduler) DownloadTask {
+	t.Helper()
+	select {
+	case task := <-nextAsync(s):
+		return task
+	case <-time.After(time.Second):
+		t.Fatal("Next 未在一秒内返回任务")
+		return DownloadTask{}
+	}
+}
+
+// assertBlocked 检查 result 在短时间内没有收到任务
+func assertBlocked(t *testing.T, result <-chan DownloadTask) {
+	t.Helper()
+	select {
+	case task := <-result:
+		t.Fatalf("Next 不应返回任务，实际返回 %s", task.URL)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHostSchedulerOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks []DownloadTask
+		want  []string
+	}{
+		{
+			name: "主机之间轮询",
+			tasks: []DownloadTask{
+				schedulerTask("a.com", "1", "job", 0),
+				schedulerTask("a.com", "2", "job", 0),
+				schedulerTask("a.com", "3", "job", 0),
+				schedulerTask("b.com", "1", "job", 0),
+				schedulerTask("b.com", "2", "job", 0),
+				schedulerTask("c.com", "1", "job", 0),
+			},
+			want: []string{
+				"https://a.com/1", "https://b.com/1", "https://c.com/1",
+				"https://a.com/2", "https://b.com/2", "https://a.com/3",
+			},
+		},
+		{
+			name: "主机名不区分大小写",
+			tasks: []DownloadTask{
+				schedulerTask("A.com", "1", "job", 0),
+				schedulerTask("a.COM", "2", "job", 0),
+				schedulerTask("b.com", "1", "job", 0),
+			},
+			want: []string{"https://A.com/1", "https://b.com/1", "https://a.COM/2"},
+		},
+		{
+			name: "同一主机按优先级排序",
+			tasks: []DownloadTask{
+				schedulerTask("a.com", "low", "job", 0),
+				schedulerTask("a.com", "high", "job", 2),
+				schedulerTask("a.com", "mid", "job", 1),
+				schedulerTask("a.com", "high2", "job", 2),
+			},
+			want: []string{"https://a.com/high", "https://a.com/high2", "https://a.com/mid", "https://a.com/low"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestScheduler(t, HostPolicy{})
+			for _, task := range tt.tasks {
+				s.Submit(task)
+			}
+			var got []string
+			for range tt.want {
+				got = append(got, mustNext(t, s).URL)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("分发顺序为 %v，期望 %v", got, tt.want)
+			}
+			if s.Pending() != 0 {
+				t.Errorf("Pending() = %d，期望 0", s.Pending())
+			}
+		})
+	}
+}
+
+func TestHostSchedulerConcurrencyCap(t *testing.T) {
+	s := newTestScheduler(t, HostPolicy{MaxConnections: 2})
+	s.SetPolicy(HostPolicy{MaxConnections: 2}, map[string]HostPolicy{"B.com": {MaxConnections: 1}})
+	for _, task := range []DownloadTask{
+		schedulerTask("a.com", "1", "job", 0),
+		schedulerTask("a.com", "2", "job", 0),
+		schedulerTask("a.com", "3", "job", 0),
+		schedulerTask("b.com", "1", "job", 0),
+		schedulerTask("b.com", "2", "job", 0),
+	} {
+		s.Submit(task)
+	}
+
+	var got []string
+	for i := 0; i < 3; i++ {
+		got = append(got, mustNext(t, s).URL)
+	}
+	want := []string{"https://a.com/1", "https://b.com/1", "https://a.com/2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("分发顺序为 %v，期望 %v", got, want)
+	}
+
+	// a.com 与 b.com 都已达到并发上限
+	result := nextAsync(s)
+	assertBlocked(t, result)
+
+	// b.com 的任务结束后只释放 b.com 的名额
+	s.Done(schedulerTask("b.com", "1", "job", 0))
+	select {
+	case task := <-result:
+		if task.URL != "https://b.com/2" {
+			t.Errorf("释放 b.com 名额后分发了 %s，期望 https://b.com/2", task.URL)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("释放名额后 Next 未返回任务")
+	}
+
+	result = nextAsync(s)
+	assertBlocked(t, result)
+	s.Done(schedulerTask("a.com", "1", "job", 0))
+	select {
+	case task := <-result:
+		if task.URL != "https://a.com/3" {
+			t.Errorf("释放 a.com 名额后分发了 %s，期望 https://a.com/3", task.URL)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("释放名额后 Next 未返回任务")
+	}
+}
+
+func TestHostSchedulerDelay(t *testing.T) {
+	const delay = 100 * time.Millisecond
+
+	s := newTestScheduler(t, HostPolicy{Delay: delay})
+	s.Submit(schedulerTask("a.com", "1", "job", 0))
+	s.Submit(schedulerTask("a.com", "2", "job", 0))
+	s.Submit(schedulerTask("b.com", "1", "job", 0))
+
+	start := time.Now()
+	mustNext(t, s)
+	// 其他主机不受 a.com 请求间隔的影响
+	if task := mustNext(t, s); task.URL != "https://b.com/1" {
+		t.Fatalf("第二个任务为 %s，期望 https://b.com/1", task.URL)
+	}
+	if elapsed := time.Since(start); elapsed >= delay/2 {
+		t.Errorf("不同主机的任务等待了 %v", elapsed)
+	}
+	mustNext(t, s)
+	if elapsed := time.Since(start); elapsed < delay*8/10 {
+		t.Errorf("同一主机两次请求间隔 %v，期望至少约 %v", elapsed, delay)
+	}
+}
+
+func TestRandomJitter(t *testing.T) {
+	tests := []struct {
+		name string
+		max  time.Duration
+	}{
+		{name: "不抖动", max: 0},
+		{name: "负数", max: -time.Second},
+		{name: "一毫秒", max: time.Millisecond},
+		{name: "一秒", max: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				jitter := randomJitter(tt.max)
+				if jitter < 0 || (tt.max > 0 && jitter >= tt.max) || (tt.max <= 0 && jitter != 0) {
+					t.Fatalf("randomJitter(%v) = %v，超出 [0, max) 范围", tt.max, jitter)
+				}
+			}
+		})
+	}
+}
+
+func TestHostSchedulerPausedAndRemovedJobs(t *testing.T) {
+	s := newTestScheduler(t, HostPolicy{})
+	s.Submit(schedulerTask("a.com", "1", "paused", 0))
+	s.Submit(schedulerTask("a.com", "2", "running", 0))
+	s.Submit(schedulerTask("b.com", "1", "removed", 0))
+	s.SetJobPaused("paused", true)
+
+	if removed := s.RemoveJob("removed"); len(removed) != 1 || removed[0].URL != "https://b.com/1" {
+		t.Errorf("RemoveJob() = %v，期望只移除 https://b.com/1", removed)
+	}
+	if task := mustNext(t, s); task.URL != "https://a.com/2" {
+		t.Fatalf("跳过暂停任务后分发了 %s，期望 https://a.com/2", task.URL)
+	}
+
+	result := nextAsync(s)
+	assertBlocked(t, result)
+	s.SetJobPaused("paused", false)
+	select {
+	case task := <-result:
+		if task.URL != "https://a.com/1" {
+			t.Errorf("恢复后分发了 %s，期望 https://a.com/1", task.URL)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("恢复任务后 Next 未返回任务")
+	}
+}
+
+func TestHostSchedulerClose(t *testing.T) {
+	s := NewHostScheduler(HostPolicy{})
+	done := make(chan bool, 1)
+	go func() {
+		_, ok := s.Next()
+		done <- ok
+	}()
+	time.Sleep(20 * time.Millisecond)
+	s.Close()
+
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("调度器关闭后 Next 仍返回了任务")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("调度器关闭后 Next 仍在等待")
+	}
+}
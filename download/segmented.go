@@ -0,0 +1,452 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 分段下载的默认参数
+const (
+	DefaultSegments         = 4                // 默认分段连接数
+	DefaultSegmentThreshold = 16 * 1024 * 1024 // 启用分段下载的最小文件大小
+	minSplitSize            = 1024 * 1024      // 剩余量低于该值的分段不再拆分
+	segmentBufferSize       = 32 * 1024        // 分段读取缓冲区大小
+)
+
+// errRangeUnsupported 表示服务器未按预期响应范围请求，需要回退到单连接下载
+var errRangeUnsupported = errors.New("服务器不支持范围请求")
+
+// segment 描述一个下载分段，End 为闭区间终点，Done 为已写入的字节数
+type segment struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Done  int64 `json:"done"`
+
+	began    time.Time // 当前连接开始接收数据的时间
+	received int64     // 当前连接已接收的字节数
+}
+
+// remaining 返回分段剩余未下载的字节数
+func (s *segment) remaining() int64 {
+	return s.End - (s.Start + s.Done) + 1
+}
+
+// rate 返回分段当前连接的平均速度(字节/秒)，尚未接收数据时返回 0
+func (s *segment) rate(now time.Time) float64 {
+	elapsed := now.Sub(s.began).Seconds()
+	if s.received <= 0 || elapsed <= 0 {
+		return 0
+	}
+	return float64(s.received) / elapsed
+}
+
+// segmentedDownload 记录一次分段下载的共享状态
+type segmentedDownload struct {
+	downloader *ResourceDownloader
+	task       *DownloadTask
+	savePath   string
+	meter      *transferMeter
+	file       *os.File
+	meta       partMeta
+	first      *http.Response // 首个完整响应，作为第一个分段的连接，使用后置空
+
+	lock     sync.Mutex
+	segments []*segment
+	err      error
+	stopped  bool
+}
+
+// resumeSegmentedDownload 继续上次未完成的分段下载
+// 返回 handled=false 表示不存在分段下载的临时文件，调用方应按单连接下载
+func (d *ResourceDownloader) resumeSegmentedDownload(task *DownloadTask, savePath string, meter *transferMeter) (handled bool, err error) {
+	if d.Segments <= 1 || isTextType(task.Type) {
+		return false, nil
+	}
+	meta, ok := loadPartMeta(savePath)
+	if !ok || meta.URL != task.URL || len(meta.Segments) == 0 {
+		return false, nil
+	}
+	if _, err := os.Stat(partPath(savePath)); err != nil {
+		removePartial(savePath)
+		return false, nil
+	}
+
+	err = d.runSegmentedDownload(task, savePath, meter, meta, nil)
+	if errors.Is(err, errRangeUnsupported) {
+		removePartial(savePath)
+		return false, nil
+	}
+	return true, err
+}
+
+// canSegment 根据首个完整响应判断是否改用分段下载：文件不小于分段阈值、声明支持字节范围请求且未压缩传输
+func (d *ResourceDownloader) canSegment(task *DownloadTask, resp *http.Response) bool {
+	if d.Segments <= 1 || isTextType(task.Type) || resp.StatusCode != http.StatusOK {
+		return false
+	}
+	return resp.ContentLength >= d.segmentThreshold() &&
+		strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes") &&
+		resp.Header.Get("Content-Encoding") == ""
+}
+
+// startSegmentedDownload 以首个完整响应作为第一个分段的连接，其余分段另发范围请求
+// 不额外发送探测请求；服务器未按预期响应范围请求时返回 errRangeUnsupported 并清理临时文件
+func (d *ResourceDownloader) startSegmentedDownload(task *DownloadTask, savePath string, meter *transferMeter, resp *http.Response) error {
+	size := resp.ContentLength
+	meta := partMeta{
+		URL:          task.URL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Size:         size,
+		Segments:     splitSegments(size, d.Segments),
+	}
+
+	// 预分配目标文件
+	file, err := os.Create(partPath(savePath))
+	if err != nil {
+		return fmt.Errorf("创建文件失败: %v", err)
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		removePartial(savePath)
+		return fmt.Errorf("预分配文件失败: %v", err)
+	}
+	file.Close()
+	if err := savePartMeta(savePath, meta); err != nil {
+		return fmt.Errorf("写入续传信息失败: %v", err)
+	}
+
+	err = d.runSegmentedDownload(task, savePath, meter, meta, resp)
+	if errors.Is(err, errRangeUnsupported) {
+		removePartial(savePath)
+	}
+	return err
+}
+
+// runSegmentedDownload 按续传信息中的分段并行下载，完成后计算校验值并重命名为目标文件
+// first 不为空时作为第一个分段的响应，不再为其发送请求
+func (d *ResourceDownloader) runSegmentedDownload(task *DownloadTask, savePath string, meter *transferMeter, meta partMeta, first *http.Response) error {
+	file, err := os.OpenFile(partPath(savePath), os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("打开文件失败: %v", err)
+	}
+
+	sd := &segmentedDownload{
+		downloader: d,
+		task:       task,
+		savePath:   savePath,
+		meter:      meter,
+		file:       file,
+		meta:       meta,
+		first:      first,
+	}
+	var done int64
+	for i := range meta.Segments {
+		seg := meta.Segments[i]
+		sd.segments = append(sd.segments, &seg)
+		done += seg.Done
+	}
+	meter.Start(done, meta.Size)
+
+	err = sd.run()
+	if cerr := file.Close(); cerr != nil && err == nil {
+		err = fmt.Errorf("关闭文件失败: %v", cerr)
+	}
+	if errors.Is(err, errRangeUnsupported) {
+		return errRangeUnsupported
+	}
+	if err != nil {
+		// 保存各分段进度，供重试时继续
+		sd.saveProgress()
+		return err
+	}
+
+	sums, err := HashFile(partPath(savePath), d.Checksums)
+	if err != nil {
+		return fmt.Errorf("计算校验值失败: %v", err)
+	}
+	if err := os.Rename(partPath(savePath), savePath); err != nil {
+		return fmt.Errorf("重命名文件失败: %v", err)
+	}
+	os.Remove(partMetaPath(savePath))
+
+	task.ETag = meta.ETag
+	if lastModified, err := http.ParseTime(meta.LastModified); err == nil {
+		task.LastModified = lastModified
+	}
+	task.Size = meta.Size
+	task.Checksums = sums
+	return nil
+}
+
+// segmentThreshold 返回启用分段下载的最小文件大小
+func (d *ResourceDownloader) segmentThreshold() int64 {
+	if d.SegmentThreshold > 0 {
+		return d.SegmentThreshold
+	}
+	return DefaultSegmentThreshold
+}
+
+// splitSegments 将文件均分为 n 个分段
+func splitSegments(size int64, n int) []segment {
+	if int64(n) > size {
+		n = int(size)
+	}
+	segments := make([]segment, 0, n)
+	chunk := size / int64(n)
+	for i := 0; i < n; i++ {
+		start := int64(i) * chunk
+		end := start + chunk - 1
+		if i == n-1 {
+			end = size - 1
+		}
+		segments = append(segments, segment{Start: start, End: end})
+	}
+	return segments
+}
+
+// run 为每个未完成的分段启动一个连接，空闲的连接会拆分预计最晚完成的分段继续下载
+func (sd *segmentedDownload) run() error {
+	var wg sync.WaitGroup
+	for _, seg := range sd.segments {
+		if seg.remaining() <= 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(seg *segment) {
+			defer wg.Done()
+			for seg != nil {
+				if err := sd.downloadSegmentWithRetry(seg); err != nil {
+					sd.fail(err)
+					return
+				}
+				seg = sd.steal()
+			}
+		}(seg)
+	}
+	wg.Wait()
+
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+	return sd.err
+}
+
+// fail 记录首个错误并通知其他连接停止
+func (sd *segmentedDownload) fail(err error) {
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+	if sd.err == nil || errors.Is(err, errRangeUnsupported) {
+		sd.err = err
+	}
+	sd.stopped = true
+}
+
+// steal 找出预计最晚完成的分段(剩余量除以其连接的平均速度)，将其后半部分拆分给空闲连接，实现慢速分段的动态再拆分
+func (sd *segmentedDownload) steal() *segment {
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+
+	if sd.stopped {
+		return nil
+	}
+	target := slowestSegment(sd.segments, time.Now())
+	if target == nil {
+		return nil
+	}
+
+	mid := target.Start + target.Done + target.remaining()/2
+	split := &segment{Start: mid, End: target.End}
+	target.End = mid - 1
+	sd.segments = append(sd.segments, split)
+	return split
+}
+
+// slowestSegment 返回可拆分的分段中预计剩余时间最长的一个，没有可拆分的分段时返回 nil
+// 尚无速度数据的分段按其他分段的平均速度估算；所有分段都没有速度数据时按剩余量比较
+func slowestSegment(segments []*segment, now time.Time) *segment {
+	var total float64
+	var measured int
+	for _, seg := range segments {
+		if r := seg.rate(now); r > 0 {
+			total += r
+			measured++
+		}
+	}
+	fallback := 1.0
+	if measured > 0 {
+		fallback = total / float64(measured)
+	}
+
+	var target *segment
+	var targetLeft float64
+	for _, seg := range segments {
+		if seg.remaining() < 2*minSplitSize {
+			continue
+		}
+		r := seg.rate(now)
+		if r <= 0 {
+			r = fallback
+		}
+		left := float64(seg.remaining()) / r
+		if target == nil || left > targetLeft {
+			target, targetLeft = seg, left
+		}
+	}
+	return target
+}
+
+// downloadSegmentWithRetry 下载单个分段，失败时按重试策略从该分段已完成的位置重试
+func (sd *segmentedDownload) downloadSegmentWithRetry(seg *segment) error {
+	policy := sd.downloader.retryPolicy()
+	for i := 0; ; i++ {
+		err := sd.downloadSegment(seg)
+		if err == nil || errors.Is(err, errRangeUnsupported) || errors.Is(err, errPaused) {
+			return err
+		}
+		if !policy.ShouldRetry(err, i) {
+			return fmt.Errorf("分段 %d-%d 下载失败: %w", seg.Start, seg.End, err)
+		}
+
+		sd.lock.Lock()
+		stopped := sd.stopped
+		sd.lock.Unlock()
+		if stopped {
+			return nil
+		}
+		if err := sd.downloader.sleep(policy.Backoff(i, err)); err != nil {
+			return err
+		}
+	}
+}
+
+// downloadSegment 请求分段剩余的字节范围并写入文件对应位置
+func (sd *segmentedDownload) downloadSegment(seg *segment) error {
+	sd.lock.Lock()
+	pos := seg.Start + seg.Done
+	end := seg.End
+	sd.lock.Unlock()
+	if pos > end {
+		return nil
+	}
+
+	resp, err := sd.openSegment(pos, end)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	sd.lock.Lock()
+	seg.began = time.Now()
+	seg.received = 0
+	sd.lock.Unlock()
+
+	body := sd.downloader.controlled(Bandwidth.Throttle(sd.downloader.context(), resp.Body, sd.task.URL, sd.task.HistoryID))
+	buf := make([]byte, segmentBufferSize)
+	for {
+		n, readErr := body.Read(buf)
+		if n > 0 {
+			// 分段可能已被拆分，只写入仍属于本分段的部分
+			sd.lock.Lock()
+			if sd.stopped {
+				sd.lock.Unlock()
+				return nil
+			}
+			pos = seg.Start + seg.Done
+			limit := seg.End - pos + 1
+			sd.lock.Unlock()
+
+			chunk := buf[:n]
+			if int64(len(chunk)) > limit {
+				chunk = chunk[:limit]
+			}
+			if _, err := sd.file.WriteAt(chunk, pos); err != nil {
+				return fmt.Errorf("写入文件失败: %v", err)
+			}
+
+			sd.lock.Lock()
+			seg.Done += int64(len(chunk))
+			seg.received += int64(len(chunk))
+			finished := seg.remaining() <= 0
+			sd.lock.Unlock()
+			sd.meter.Add(int64(len(chunk)))
+			if finished {
+				return nil
+			}
+		}
+		if readErr == io.EOF {
+			sd.lock.Lock()
+			finished := seg.remaining() <= 0
+			sd.lock.Unlock()
+			if !finished {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// openSegment 返回从 pos 开始的响应：首个完整响应从文件开头开始，直接用于第一个分段，其余情况发送范围请求
+func (sd *segmentedDownload) openSegment(pos, end int64) (*http.Response, error) {
+	sd.lock.Lock()
+	first := sd.first
+	if first != nil && pos == 0 {
+		sd.first = nil
+	}
+	sd.lock.Unlock()
+	if first != nil && pos == 0 {
+		return first, nil
+	}
+
+	req, err := http.NewRequestWithContext(sd.downloader.context(), "GET", sd.task.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	sd.downloader.setRequestHeaders(req)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", pos, end))
+	if validator := sd.meta.ifRangeValidator(); validator != "" {
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := sd.downloader.doRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != pos {
+			resp.Body.Close()
+			return nil, errRangeUnsupported
+		}
+		return resp, nil
+	case http.StatusOK:
+		// 范围请求被忽略或资源已变化
+		resp.Body.Close()
+		return nil, errRangeUnsupported
+	default:
+		resp.Body.Close()
+		return nil, newHTTPStatusError(resp)
+	}
+}
+
+// saveProgress 将各分段进度写入旁路元数据
+func (sd *segmentedDownload) saveProgress() {
+	sd.lock.Lock()
+	meta := sd.meta
+	meta.Segments = make([]segment, 0, len(sd.segments))
+	for _, seg := range sd.segments {
+		meta.Segments = append(meta.Segments, *seg)
+	}
+	sd.lock.Unlock()
+
+	savePartMeta(sd.savePath, meta)
+}
@@ -0,0 +1,249 @@
+package download
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSplitSegments(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int64
+		n         int
+		wantCount int
+		wantLast  int64 // 最后一个分段的长度，余数并入最后一个分段
+	}{
+		{name: "整除", size: 100, n: 4, wantCount: 4, wantLast: 25},
+		{name: "余数并入最后一个分段", size: 103, n: 4, wantCount: 4, wantLast: 28},
+		{name: "单个分段", size: 100, n: 1, wantCount: 1, wantLast: 100},
+		{name: "分段数多于字节数", size: 3, n: 8, wantCount: 3, wantLast: 1},
+		{name: "大文件", size: 40 << 20, n: 4, wantCount: 4, wantLast: 10 << 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments := splitSegments(tt.size, tt.n)
+			if len(segments) != tt.wantCount {
+				t.Fatalf("分段数为 %d，期望 %d", len(segments), tt.wantCount)
+			}
+
+			// 分段首尾相接且覆盖整个文件
+			next := int64(0)
+			for i, seg := range segments {
+				if seg.Start != next {
+					t.Errorf("第 %d 个分段从 %d 开始，期望 %d", i, seg.Start, next)
+				}
+				if seg.End < seg.Start {
+					t.Errorf("第 %d 个分段为空: %+v", i, seg)
+				}
+				if seg.Done != 0 {
+					t.Errorf("第 %d 个分段已下载 %d 字节，期望 0", i, seg.Done)
+				}
+				next = seg.End + 1
+			}
+			if next != tt.size {
+				t.Errorf("分段覆盖到 %d，期望 %d", next, tt.size)
+			}
+			last := segments[len(segments)-1]
+			if got := last.End - last.Start + 1; got != tt.wantLast {
+				t.Errorf("最后一个分段长度为 %d，期望 %d", got, tt.wantLast)
+			}
+		})
+	}
+}
+
+// testSegment 创建剩余 remaining 字节、当前连接在 elapsed 内接收了 received 字节的分段
+func testSegment(now time.Time, remaining, received int64, elapsed time.Duration) *segment {
+	return &segment{
+		Start:    0,
+		End:      received + remaining - 1,
+		Done:     received,
+		began:    now.Add(-elapsed),
+		received: received,
+	}
+}
+
+func TestSlowestSegment(t *testing.T) {
+	now := time.Now()
+	const mb = 1024 * 1024
+
+	tests := []struct {
+		name     string
+		segments []*segment
+		want     int // 期望选中的分段下标，-1 表示没有可拆分的分段
+	}{
+		{
+			name:     "没有分段",
+			segments: nil,
+			want:     -1,
+		},
+		{
+			name:     "剩余量不足以拆分",
+			segments: []*segment{testSegment(now, 2*minSplitSize-1, mb, time.Second)},
+			want:     -1,
+		},
+		{
+			name: "剩余量相同时选择速度最慢的分段",
+			segments: []*segment{
+				testSegment(now, 8*mb, 4*mb, time.Second),
+				testSegment(now, 8*mb, mb, time.Second),
+				testSegment(now, 8*mb, 2*mb, time.Second),
+			},
+			want: 1,
+		},
+		{
+			name: "按预计剩余时间而非剩余量选择",
+			segments: []*segment{
+				testSegment(now, 20*mb, 10*mb, time.Second), // 剩余 2 秒
+				testSegment(now, 6*mb, mb, time.Second),     // 剩余 6 秒
+			},
+			want: 1,
+		},
+		{
+			name: "尚无速度数据的分段按平均速度估算",
+			segments: []*segment{
+				testSegment(now, 4*mb, 2*mb, time.Second),
+				testSegment(now, 16*mb, 0, 0), // 按平均 2MB/s 估算剩余 8 秒
+				testSegment(now, 6*mb, 2*mb, time.Second),
+			},
+			want: 1,
+		},
+		{
+			name: "都没有速度数据时按剩余量选择",
+			segments: []*segment{
+				testSegment(now, 4*mb, 0, 0),
+				testSegment(now, 12*mb, 0, 0),
+				testSegment(now, 8*mb, 0, 0),
+			},
+			want: 1,
+		},
+		{
+			name: "跳过剩余量不足的慢速分段",
+			segments: []*segment{
+				testSegment(now, minSplitSize, 1, time.Minute),
+				testSegment(now, 4*mb, 4*mb, time.Second),
+			},
+			want: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := slowestSegment(tt.segments, now)
+			if tt.want < 0 {
+				if got != nil {
+					t.Errorf("slowestSegment 返回 %+v，期望 nil", got)
+				}
+				return
+			}
+			if got != tt.segments[tt.want] {
+				t.Errorf("slowestSegment 返回 %+v，期望第 %d 个分段", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSteal(t *testing.T) {
+	now := time.Now()
+	const mb = 1024 * 1024
+	fast := &segment{Start: 0, End: 8*mb - 1, Done: 4 * mb, began: now.Add(-time.Second), received: 4 * mb}
+	slow := &segment{Start: 8 * mb, End: 16*mb - 1, Done: mb, began: now.Add(-time.Second), received: mb}
+	sd := &segmentedDownload{segments: []*segment{fast, slow}}
+
+	split := sd.steal()
+	if split == nil {
+		t.Fatal("steal 返回 nil")
+	}
+	// 慢速分段剩余 7MB，从剩余部分的中点拆分
+	wantMid := slow.Start + mb + (7*mb)/2
+	if split.Start != wantMid || split.End != 16*mb-1 || split.Done != 0 {
+		t.Errorf("拆分出的分段为 %+v，期望 [%d, %d]", split, wantMid, 16*mb-1)
+	}
+	if slow.End != wantMid-1 {
+		t.Errorf("原分段结束于 %d，期望 %d", slow.End, wantMid-1)
+	}
+	if fast.End != 8*mb-1 {
+		t.Errorf("快速分段被修改: %+v", fast)
+	}
+	if len(sd.segments) != 3 || sd.segments[2] != split {
+		t.Errorf("拆分出的分段未加入分段列表")
+	}
+
+	sd.stopped = true
+	if sd.steal() != nil {
+		t.Error("下载停止后仍拆分分段")
+	}
+}
+
+func TestCanSegment(t *testing.T) {
+	d := &ResourceDownloader{Segments: 4, SegmentThreshold: 1000}
+	rangeHeader := http.Header{"Accept-Ranges": {"bytes"}}
+
+	tests := []struct {
+		name     string
+		d        *ResourceDownloader
+		taskType string
+		resp     *http.Response
+		want     bool
+	}{
+		{
+			name:     "支持范围请求的大文件",
+			d:        d,
+			taskType: "archive",
+			resp:     &http.Response{StatusCode: 200, ContentLength: 1000, Header: rangeHeader},
+			want:     true,
+		},
+		{
+			name:     "小于阈值",
+			d:        d,
+			taskType: "archive",
+			resp:     &http.Response{StatusCode: 200, ContentLength: 999, Header: rangeHeader},
+		},
+		{
+			name:     "未知长度",
+			d:        d,
+			taskType: "archive",
+			resp:     &http.Response{StatusCode: 200, ContentLength: -1, Header: rangeHeader},
+		},
+		{
+			name:     "不支持范围请求",
+			d:        d,
+			taskType: "archive",
+			resp:     &http.Response{StatusCode: 200, ContentLength: 5000, Header: http.Header{"Accept-Ranges": {"none"}}},
+		},
+		{
+			name:     "压缩传输",
+			d:        d,
+			taskType: "archive",
+			resp:     &http.Response{StatusCode: 200, ContentLength: 5000, Header: http.Header{"Accept-Ranges": {"bytes"}, "Content-Encoding": {"gzip"}}},
+		},
+		{
+			name:     "续传响应",
+			d:        d,
+			taskType: "archive",
+			resp:     &http.Response{StatusCode: 206, ContentLength: 5000, Header: rangeHeader},
+		},
+		{
+			name:     "文本类型",
+			d:        d,
+			taskType: "script",
+			resp:     &http.Response{StatusCode: 200, ContentLength: 5000, Header: rangeHeader},
+		},
+		{
+			name:     "禁用分段",
+			d:        &ResourceDownloader{Segments: 1, SegmentThreshold: 1000},
+			taskType: "archive",
+			resp:     &http.Response{StatusCode: 200, ContentLength: 5000, Header: rangeHeader},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := &DownloadTask{URL: "https://example.com/file", Type: tt.taskType}
+			if got := tt.d.canSegment(task, tt.resp); got != tt.want {
+				t.Errorf("canSegment() = %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -120,20 +119,8 @@ func ShortenURL(url string, maxLen int) string {
 	return url[:maxLen-3] + "..."
 }
 
-// 记录错误日志
-func LogError(logFile *os.File, message string) {
-	entry := map[string]string{
-		"time":    time.Now().Format(time.RFC3339),
-		"level":   "ERROR",
-		"message": message,
-	}
-
-	data, _ := json.Marshal(entry)
-	logFile.Write(append(data, '\n'))
-}
-
-// 结构化日志记录
-func LogStructured(logFile *os.File, level string, fields map[string]interface{}) {
+// 结构化日志记录，每条日志为一行 JSON
+func LogStructured(w io.Writer, level string, fields map[string]interface{}) {
 	entry := map[string]interface{}{
 		"time":  time.Now().Format(time.RFC3339),
 		"level": level,
@@ -143,7 +130,7 @@ func LogStructured(logFile *os.File, level string, fields map[string]interface{}
 	}
 
 	data, _ := json.Marshal(entry)
-	logFile.Write(append(data, '\n'))
+	w.Write(append(data, '\n'))
 }
 
 // 检查是否是文本类型
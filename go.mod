@@ -6,6 +6,8 @@ toolchain go1.23.4
 
 require (
 	github.com/gin-gonic/gin v1.10.0
+	github.com/gobwas/ws v1.4.0
+	github.com/ulule/limiter/v3 v3.11.2
 	golang.org/x/net v0.40.0
 	golang.org/x/text v0.25.0
 )
@@ -18,10 +20,8 @@ require (
 	github.com/go-json-experiment/json v0.0.0-20250211171154-1ae217ad3535 // indirect
 	github.com/gobwas/httphead v0.1.0 // indirect
 	github.com/gobwas/pool v0.2.1 // indirect
-	github.com/gobwas/ws v1.4.0 // indirect
 	github.com/gorilla/css v1.0.1 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	github.com/ulule/limiter/v3 v3.11.2 // indirect
 )
 
 require (
@@ -1,31 +1,51 @@
-package主干
+package main
 
 import (
 	"PaiDownloader/api"
 	"PaiDownloader/config"
-	"PaiDownloader/download"
 	"PaiDownloader/middleware"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+const httpShutdownTimeout = 5 * time.Second // 等待进行中的 HTTP 请求结束的时间
+
 func main() {
-	// 加载配置文件
-	config, err := config.LoadConfig("")
+	configPath := flag.String("config", "config.json", "配置文件路径")
+	flag.Parse()
+
+	// 加载配置文件，PAIDL_* 环境变量覆盖文件中的配置
+	config, err := config.LoadConfig(*configPath)
 	if err != nil {
 		panic(fmt.Sprintf("加载配置文件失败: %v", err))
 	}
-	downloader := download.NewResourceDownloader()
-	downloader.OutputDir = config.DownloadDir
-	downloader.MaxConcurrent = config.MaxConcurrent
+	// 日志、下载器、限速、主机调度策略与全局 Webhook
+	if err := api.Configure(config, *configPath); err != nil {
+		panic(fmt.Sprintf("应用配置失败: %v", err))
+	}
 
 	r := gin.Default()
 
-	// 路由中间件(CORS、XSS、请求频率限制)
+	// 监控指标与健康检查在中间件之前注册，不受频率限制，也不计入 API 请求数
+	r.GET("/metrics", api.HandleMetrics)
+	r.GET("/healthz", api.HandleHealthz)
+	r.GET("/readyz", api.HandleReadyz)
+
+	// 路由中间件(请求统计、CORS、XSS、请求频率限制)
+	r.Use(middleware.MetricsMiddleware())
 	r.Use(middleware.CORSMiddleware())
 	r.Use(middleware.XSSMiddleware())
-	r.Use(middleware.RateLimitMiddleware())
+	r.Use(middleware.RateLimitMiddleware(config.RateLimit))
 
 	// 静态文件
 	r.Static("/static", "./static")
@@ -34,11 +54,77 @@ func main() {
 	r.GET("/", api.HandleIndexPage)
 	r.POST("/download", api.HandleDownloadRequest)
 	r.GET("/progress-sse", api.HandleProgressSSE)
+	r.GET("/jobs", api.HandleListJobs)
+	r.GET("/jobs/:id", api.HandleGetJob)
+	r.GET("/jobs/:id/events", api.HandleJobEvents)
+	r.GET("/ws", api.HandleWebSocket)
+	r.POST("/jobs/:id/pause", api.HandlePauseJob)
+	r.POST("/jobs/:id/resume", api.HandleResumeJob)
+	r.POST("/jobs/:id/cancel", api.HandleCancelJob)
 	r.POST("/preview", api.HandlePreviewRequest)
 	r.GET("/cancel", api.HandleCancelRequest)
 	r.POST("/history", api.HandleGetHistory)
 	r.GET("/history", api.HandleHistoryPage)
+	r.GET("/history/:id/archive", api.HandleArchiveRequest)
+	r.POST("/history/:id/verify", api.HandleVerifyRequest)
+	r.GET("/history/:id/changes", api.HandleChangesRequest)
+	r.GET("/history/export", api.HandleExportHistory)
+	r.GET("/history/:id/export", api.HandleExportJob)
+	r.GET("/history/:id", api.HandleGetHistoryDetail)
+	r.DELETE("/history/:id", api.HandleDeleteHistory)
+	r.POST("/history/delete", api.HandleBatchDeleteHistory)
+	r.POST("/history/:id/rerun", api.HandleRerunHistory)
+	r.GET("/webhooks", api.HandleListWebhooks)
+	r.POST("/webhooks/test", api.HandleTestWebhook)
+	r.GET("/webhooks/deliveries", api.HandleListDeliveries)
+	r.GET("/webhooks/deliveries/:id", api.HandleGetDelivery)
+	r.GET("/bandwidth", api.HandleGetBandwidth)
+	r.POST("/bandwidth", api.HandleSetBandwidth)
+	r.GET("/log/level", api.HandleGetLogLevel)
+	r.POST("/log/level", api.HandleSetLogLevel)
+	r.POST("/admin/reload", api.HandleReloadConfig)
+	r.GET("/schedules", api.HandleListSchedules)
+	r.POST("/schedules", api.HandleCreateSchedule)
+	r.GET("/schedules/:id", api.HandleGetSchedule)
+	r.PUT("/schedules/:id", api.HandleUpdateSchedule)
+	r.DELETE("/schedules/:id", api.HandleDeleteSchedule)
+	r.POST("/schedules/:id/run", api.HandleRunSchedule)
+
+	// 健康检查在服务启动后即可访问，任务恢复完成前就绪检查返回 503
+	// 监听失败时交给主协程按正常流程关闭，保存已恢复任务的状态
+	srv := &http.Server{Addr: net.JoinHostPort(config.BindAddress, config.ServerPort), Handler: r}
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
+
+	// 恢复重启前未完成的任务，再启动定时任务调度与配置文件监视
+	api.RestoreJobs(config.ResumePaused)
+	api.StartScheduler()
+	api.StartConfigWatcher()
+	api.MarkReady()
 
-	// 服务启动
-	r.Run(":8080")
+	// 收到退出信号或 HTTP 服务出错后停止接受新任务，等待下载中的文件结束，关闭事件流与 HTTP 服务后保存状态
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	var failure error
+	select {
+	case <-quit:
+	case failure = <-serveErr:
+	}
+	signal.Stop(quit)
+
+	api.Shutdown(time.Duration(config.ShutdownGraceSeconds) * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	srv.Shutdown(ctx)
+	cancel()
+	api.PersistState()
+
+	if failure != nil {
+		fmt.Fprintf(os.Stderr, "服务启动失败: %v\n", failure)
+		os.Exit(1)
+	}
 }
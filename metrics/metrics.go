@@ -0,0 +1,299 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType Prometheus 文本格式的 Content-Type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets 耗时类直方图的默认分桶上界(秒)
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// collector 可输出为 Prometheus 文本格式的指标
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry 保存所有已注册的指标，按注册顺序输出
+type Registry struct {
+	lock       sync.Mutex
+	collectors []collector
+}
+
+// Default 默认的指标注册表
+var Default = &Registry{}
+
+// register 注册指标
+func (r *Registry) register(c collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText 以 Prometheus 文本格式输出所有指标
+func (r *Registry) WriteText(w io.Writer) error {
+	r.lock.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.lock.Unlock()
+
+	buf := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buf)
+	}
+	return buf.Flush()
+}
+
+// WriteText 以 Prometheus 文本格式输出默认注册表中的所有指标
+func WriteText(w io.Writer) error {
+	return Default.WriteText(w)
+}
+
+// desc 指标的名称、说明与标签名
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+// header 输出指标的 HELP 与 TYPE 行
+func (d desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, d.kind)
+}
+
+// series 单个标签组合的值
+type series struct {
+	labelValues []string
+	value       float64
+}
+
+// seriesKey 标签值组合的唯一键
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+// CounterVec 按标签分组的计数器
+type CounterVec struct {
+	desc
+	lock   sync.Mutex
+	series map[string]*series
+}
+
+// NewCounterVec 创建并注册计数器
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{name: name, help: help, kind: "counter", labels: labels},
+		series: make(map[string]*series),
+	}
+	Default.register(c)
+	return c
+}
+
+// Inc 将标签值对应的计数加 1
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add 将标签值对应的计数增加 v，v 不能为负
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 || len(labelValues) != len(c.labels) {
+		return
+	}
+	key := seriesKey(labelValues)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+// write 实现 collector 接口
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.lock.Lock()
+	list := make([]series, 0, len(c.series))
+	for _, s := range c.series {
+		list = append(list, *s)
+	}
+	c.lock.Unlock()
+
+	c.header(w)
+	sortSeries(list)
+	for _, s := range list {
+		writeSample(w, c.name, c.labels, s.labelValues, "", "", s.value)
+	}
+}
+
+// Sample 采集时计算的一个指标值
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// GaugeFunc 在每次采集时调用函数计算当前值的仪表盘指标
+type GaugeFunc struct {
+	desc
+	collect func() []Sample
+}
+
+// NewGaugeFunc 创建并注册仪表盘指标，collect 返回每个标签组合的当前值
+func NewGaugeFunc(name, help string, labels []string, collect func() []Sample) *GaugeFunc {
+	g := &GaugeFunc{
+		desc:    desc{name: name, help: help, kind: "gauge", labels: labels},
+		collect: collect,
+	}
+	Default.register(g)
+	return g
+}
+
+// write 实现 collector 接口
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	samples := g.collect()
+	list := make([]series, 0, len(samples))
+	for _, sample := range samples {
+		if len(sample.LabelValues) == len(g.labels) {
+			list = append(list, series{labelValues: sample.LabelValues, value: sample.Value})
+		}
+	}
+
+	g.header(w)
+	sortSeries(list)
+	for _, s := range list {
+		writeSample(w, g.name, g.labels, s.labelValues, "", "", s.value)
+	}
+}
+
+// histogramSeries 单个标签组合的直方图数据
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // 每个分桶(非累计)的观测数
+	sum         float64
+	count       uint64
+}
+
+// HistogramVec 按标签分组的直方图
+type HistogramVec struct {
+	desc
+	buckets []float64
+	lock    sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+// NewHistogramVec 创建并注册直方图，buckets 为递增的分桶上界
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: append([]float64(nil), buckets...),
+		series:  make(map[string]*histogramSeries),
+	}
+	sort.Float64s(h.buckets)
+	Default.register(h)
+	return h
+}
+
+// Observe 记录一次观测值
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	if len(labelValues) != len(h.labels) {
+		return
+	}
+	key := seriesKey(labelValues)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+// write 实现 collector 接口
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.lock.Lock()
+	list := make([]histogramSeries, 0, len(h.series))
+	for _, s := range h.series {
+		copied := *s
+		copied.counts = append([]uint64(nil), s.counts...)
+		list = append(list, copied)
+	}
+	h.lock.Unlock()
+
+	h.header(w)
+	sort.Slice(list, func(i, j int) bool { return seriesKey(list[i].labelValues) < seriesKey(list[j].labelValues) })
+	for _, s := range list {
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			writeSample(w, h.name+"_bucket", h.labels, s.labelValues, "le", formatFloat(bound), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, s.labelValues, "le", "+Inf", float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.labelValues, "", "", s.sum)
+		writeSample(w, h.name+"_count", h.labels, s.labelValues, "", "", float64(s.count))
+	}
+}
+
+// sortSeries 按标签值排序，保证输出稳定
+func sortSeries(list []series) {
+	sort.Slice(list, func(i, j int) bool { return seriesKey(list[i].labelValues) < seriesKey(list[j].labelValues) })
+}
+
+// writeSample 输出一行样本，extraName 非空时追加一个额外标签(直方图的 le)
+func writeSample(w *bufio.Writer, name string, labels, labelValues []string, extraName, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabel(labelValues[i]))
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+// escapeLabel 转义标签值中的反斜杠、双引号与换行
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatFloat 按 Prometheus 文本格式输出浮点数
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"PaiDownloader/metrics"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API 请求相关的 Prometheus 指标
+var (
+	apiRequests = metrics.NewCounterVec("paidownloader_api_requests_total",
+		"按方法、路由与状态码统计的 API 请求数", "method", "route", "code")
+	rateLimitRejections = metrics.NewCounterVec("paidownloader_rate_limit_rejections_total",
+		"按路由统计的因请求频率过高被拒绝的请求数", "route")
+)
+
+// MetricsMiddleware 统计 API 请求数，需在限流中间件之前注册以统计被拒绝的请求
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		apiRequests.Inc(c.Request.Method, routeLabel(c), strconv.Itoa(c.Writer.Status()))
+	}
+}
+
+// routeLabel 返回请求匹配的路由模板，未匹配任何路由时返回 unmatched，避免以原始路径作为标签
+func routeLabel(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	return "unmatched"
+}
@@ -3,18 +3,53 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ulule/limiter/v3"
 	"github.com/ulule/limiter/v3/drivers/store/memory"
 )
 
-func RateLimitMiddleware() gin.HandlerFunc {
-	rate, _ := limiter.NewRateFromFormatted("100-H") // 每小时 100 次请求
-	store := memory.NewStore()
-	limiterInstance := limiter.New(store, rate)
+var currentLimiter atomic.Pointer[limiter.Limiter] // 当前生效的请求频率限制，为空时不限制
+
+// SetRateLimit 在运行时调整请求频率限制，rate 格式为 <次数>-<S|M|H|D>，为空时取消限制，调整后计数重新开始
+func SetRateLimit(formatted string) error {
+	if formatted == "" {
+		currentLimiter.Store(nil)
+		return nil
+	}
+	rate, err := limiter.NewRateFromFormatted(formatted)
+	if err != nil {
+		return fmt.Errorf("请求频率限制格式无效: %v", err)
+	}
+	currentLimiter.Store(limiter.New(memory.NewStore(), rate))
+	return nil
+}
+
+// ValidateRateLimit 检查请求频率限制的格式，不修改当前生效的限制
+func ValidateRateLimit(formatted string) error {
+	if formatted == "" {
+		return nil
+	}
+	if _, err := limiter.NewRateFromFormatted(formatted); err != nil {
+		return fmt.Errorf("请求频率限制格式无效: %v", err)
+	}
+	return nil
+}
+
+// RateLimitMiddleware 按客户端 IP 限制 API 请求频率，rate 格式为 <次数>-<S|M|H|D>，为空时不限制
+func RateLimitMiddleware(formatted string) gin.HandlerFunc {
+	if err := SetRateLimit(formatted); err != nil {
+		panic(err.Error())
+	}
 
 	return func(c *gin.Context) {
+		limiterInstance := currentLimiter.Load()
+		if limiterInstance == nil {
+			c.Next()
+			return
+		}
+
 		context, err := limiterInstance.Get(c, c.ClientIP())
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "请求频率限制出错"})
@@ -26,6 +61,7 @@ func RateLimitMiddleware() gin.HandlerFunc {
 		c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", context.Reset))
 
 		if context.Reached {
+			rateLimitRejections.Inc(routeLabel(c))
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "请求频率过高，请稍后再试"})
 			return
 		}
@@ -0,0 +1,258 @@
+package schedule
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{name: "全部为 *", expr: "* * * * *"},
+		{name: "列表、范围与步长", expr: "0,30 9-17 */2 1-6/2 1-5"},
+		{name: "问号", expr: "0 0 ? * 1"},
+		{name: "星期 7 表示周日", expr: "0 0 * * 7"},
+		{name: "别名", expr: "@daily"},
+		{name: "首尾空白", expr: "  @hourly  "},
+		{name: "字段数不足", expr: "0 0 * *", wantErr: true},
+		{name: "字段数过多", expr: "0 0 * * * *", wantErr: true},
+		{name: "未知别名", expr: "@reboot", wantErr: true},
+		{name: "分钟超出范围", expr: "60 * * * *", wantErr: true},
+		{name: "日期为 0", expr: "0 0 0 * *", wantErr: true},
+		{name: "月份超出范围", expr: "0 0 1 13 *", wantErr: true},
+		{name: "星期超出范围", expr: "0 0 * * 8", wantErr: true},
+		{name: "范围颠倒", expr: "0 17-9 * * *", wantErr: true},
+		{name: "步长为 0", expr: "*/0 * * * *", wantErr: true},
+		{name: "步长不是数字", expr: "*/x * * * *", wantErr: true},
+		{name: "取值不是数字", expr: "a * * * *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCron(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCron(%q) error = %v，期望出错 %v", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2025-01-01 是周三
+	at := func(value string) time.Time {
+		t.Helper()
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want string // 为空表示五年内没有匹配
+	}{
+		{name: "下一分钟", expr: "* * * * *", from: "2025-01-01 10:00", want: "2025-01-01 10:01"},
+		{name: "严格晚于起始时间", expr: "30 10 * * *", from: "2025-01-01 10:30", want: "2025-01-02 10:30"},
+		{name: "分钟步长", expr: "*/15 * * * *", from: "2025-01-01 10:16", want: "2025-01-01 10:30"},
+		{name: "范围加步长", expr: "10-40/10 * * * *", from: "2025-01-01 10:41", want: "2025-01-01 11:10"},
+		{name: "小时范围跨天", expr: "0 9-17 * * *", from: "2025-01-01 17:30", want: "2025-01-02 09:00"},
+		{name: "逗号列表", expr: "0 6,18 * * *", from: "2025-01-01 07:00", want: "2025-01-01 18:00"},
+		{name: "工作日", expr: "0 9 * * 1-5", from: "2025-01-03 10:00", want: "2025-01-06 09:00"},
+		{name: "星期 7 表示周日", expr: "0 0 * * 7", from: "2025-01-01 00:00", want: "2025-01-05 00:00"},
+		{name: "月份跨年", expr: "0 0 1 1 *", from: "2025-01-01 00:00", want: "2026-01-01 00:00"},
+		{name: "月份步长", expr: "0 0 1 */3 *", from: "2025-02-15 00:00", want: "2025-04-01 00:00"},
+		{name: "只限制日期", expr: "0 0 15 * *", from: "2025-01-16 00:00", want: "2025-02-15 00:00"},
+		{name: "日期与星期满足其一即可(星期先到)", expr: "0 0 15 * 5", from: "2025-01-01 00:00", want: "2025-01-03 00:00"},
+		{name: "日期与星期满足其一即可(日期先到)", expr: "0 0 2 * 5", from: "2025-01-01 00:00", want: "2025-01-02 00:00"},
+		{name: "问号不限制日期", expr: "0 0 ? * 5", from: "2025-01-01 00:00", want: "2025-01-03 00:00"},
+		{name: "跳过没有 31 日的月份", expr: "0 0 31 * *", from: "2025-04-01 00:00", want: "2025-05-31 00:00"},
+		{name: "2 月 29 日", expr: "0 0 29 2 *", from: "2025-03-01 00:00", want: "2028-02-29 00:00"},
+		{name: "别名", expr: "@weekly", from: "2025-01-01 12:00", want: "2025-01-05 00:00"},
+		{name: "不存在的日期", expr: "0 0 30 2 *", from: "2025-01-01 00:00", want: ""},
+		{name: "4 月 31 日", expr: "0 0 31 4 *", from: "2025-01-01 00:00", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) error = %v", tt.expr, err)
+			}
+			got := expr.Next(at(tt.from))
+			if tt.want == "" {
+				if !got.IsZero() {
+					t.Errorf("Next(%s) = %s，期望零值", tt.from, got)
+				}
+				return
+			}
+			if want := at(tt.want); !got.Equal(want) {
+				t.Errorf("Next(%s) = %s，期望 %s", tt.from, got, want)
+			}
+		})
+	}
+}
+
+func TestCronNextIgnoresSeconds(t *testing.T) {
+	expr, err := ParseCron("* * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2025, 1, 1, 10, 0, 59, 999, time.UTC)
+	if got, want := expr.Next(from), time.Date(2025, 1, 1, 10, 1, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next(%s) = %s，期望 %s", from, got, want)
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	request := json.RawMessage(`{"url":"https://example.com"}`)
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		wantErr  bool
+	}{
+		{name: "cron", schedule: Schedule{Cron: "@daily", Request: request}},
+		{name: "固定间隔", schedule: Schedule{Interval: "30m", Request: request, MissedRun: MissedCatchUp}},
+		{name: "同时指定", schedule: Schedule{Cron: "@daily", Interval: "1h", Request: request}, wantErr: true},
+		{name: "都未指定", schedule: Schedule{Request: request}, wantErr: true},
+		{name: "cron 无效", schedule: Schedule{Cron: "0 0 0 * *", Request: request}, wantErr: true},
+		{name: "间隔过短", schedule: Schedule{Interval: "30s", Request: request}, wantErr: true},
+		{name: "间隔无效", schedule: Schedule{Interval: "daily", Request: request}, wantErr: true},
+		{name: "未知的错过执行策略", schedule: Schedule{Cron: "@daily", Request: request, MissedRun: "later"}, wantErr: true},
+		{name: "缺少请求体", schedule: Schedule{Cron: "@daily"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schedule.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v，期望出错 %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// newTestManager 创建持久化到临时目录的定时任务管理器
+func newTestManager(t *testing.T, run RunFunc) *Manager {
+	t.Helper()
+	return NewManager(filepath.Join(t.TempDir(), "schedules.json"), run)
+}
+
+func TestManagerTrigger(t *testing.T) {
+	m := newTestManager(t, func(s Schedule) (string, error) { return "history-1", nil })
+	s, err := m.Create(Schedule{Name: "每日", Cron: "@daily", Request: json.RawMessage(`{}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := m.Trigger(s.ID)
+	if err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+	if run.HistoryID != "history-1" {
+		t.Errorf("执行记录的历史记录 ID 为 %q，期望 history-1", run.HistoryID)
+	}
+	if current, _ := m.Get(s.ID); len(current.Runs) != 1 || !current.NextRun.Equal(s.NextRun) {
+		t.Errorf("立即执行后定时任务为 %+v，期望一条执行记录且下一次触发时间不变", current)
+	}
+
+	if _, err := m.Trigger("missing"); !os.IsNotExist(err) {
+		t.Errorf("Trigger 不存在的定时任务 error = %v，期望 os.ErrNotExist", err)
+	}
+}
+
+func TestManagerTriggerWhileDeleted(t *testing.T) {
+	var m *Manager
+	m = newTestManager(t, func(s Schedule) (string, error) {
+		// 执行期间删除定时任务
+		if _, err := m.Delete(s.ID); err != nil {
+			t.Error(err)
+		}
+		return "history-1", nil
+	})
+	s, err := m.Create(Schedule{Name: "每日", Cron: "@daily", Request: json.RawMessage(`{}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Trigger(s.ID); !os.IsNotExist(err) {
+		t.Errorf("Trigger() error = %v，期望 os.ErrNotExist", err)
+	}
+	if _, ok := m.Get(s.ID); ok {
+		t.Error("已删除的定时任务被重新加入")
+	}
+}
+
+func TestManagerRestart(t *testing.T) {
+	fired := make(chan string, 1)
+	m := newTestManager(t, func(s Schedule) (string, error) {
+		fired <- s.ID
+		return "", nil
+	})
+
+	// 停止后再次启动，后台协程仍能执行到期的定时任务
+	m.Start()
+	m.Stop()
+	m.Start()
+	defer m.Stop()
+
+	s, err := m.Create(Schedule{Name: "每日", Cron: "@daily", Request: json.RawMessage(`{}`), Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.lock.Lock()
+	m.schedules[s.ID].NextRun = time.Now()
+	m.lock.Unlock()
+	m.notify()
+
+	select {
+	case id := <-fired:
+		if id != s.ID {
+			t.Errorf("执行了定时任务 %s，期望 %s", id, s.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("重新启动后到期的定时任务未执行")
+	}
+}
+
+func TestManagerLoadMissedRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	past := time.Now().Add(-48 * time.Hour)
+	list := []Schedule{
+		{ID: "skip", Interval: "1h", MissedRun: MissedSkip, Enabled: true, NextRun: past, Request: json.RawMessage(`{}`)},
+		{ID: "catch-up", Interval: "1h", MissedRun: MissedCatchUp, Enabled: true, NextRun: past, Request: json.RawMessage(`{}`)},
+		{ID: "disabled", Interval: "1h", MissedRun: MissedCatchUp, NextRun: past, Request: json.RawMessage(`{}`)},
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	m := NewManager(path, nil)
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if s, _ := m.Get("skip"); !s.NextRun.After(before.Add(59 * time.Minute)) {
+		t.Errorf("跳过策略的下一次触发时间为 %s，期望约一小时后", s.NextRun)
+	}
+	if s, _ := m.Get("catch-up"); s.NextRun.Before(before) || s.NextRun.After(time.Now()) {
+		t.Errorf("补执行策略的下一次触发时间为 %s，期望为加载时", s.NextRun)
+	}
+	if s, _ := m.Get("disabled"); !s.NextRun.Equal(past) {
+		t.Errorf("已停用的定时任务下一次触发时间被修改为 %s", s.NextRun)
+	}
+}
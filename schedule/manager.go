@@ -0,0 +1,372 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 错过执行时间后的处理策略
+const (
+	MissedSkip    = "skip"     // 跳过错过的执行，等待下一次触发
+	MissedCatchUp = "catch_up" // 启动后立即补执行一次
+)
+
+const maxRunRecords = 50 // 每个定时任务保留的执行记录数
+
+// RunFunc 执行定时任务保存的下载请求，返回对应的历史记录 ID
+type RunFunc func(s Schedule) (historyID string, err error)
+
+// Run 记录定时任务的一次执行
+type Run struct {
+	Time      time.Time `json:"time"`
+	HistoryID string    `json:"history_id,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Schedule 定义一个定时或周期性的下载任务
+type Schedule struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Cron      string          `json:"cron,omitempty"`     // cron 表达式，与 Interval 二选一
+	Interval  string          `json:"interval,omitempty"` // 固定间隔，如 "30m"、"24h"
+	Request   json.RawMessage `json:"request"`            // 完整的 /download 请求体
+	MissedRun string          `json:"missed_run"`         // 错过执行时间后的处理策略
+	Enabled   bool            `json:"enabled"`
+	CreatedAt time.Time       `json:"created_at"`
+	LastRun   time.Time       `json:"last_run"`
+	NextRun   time.Time       `json:"next_run"`
+	Runs      []Run           `json:"runs"`
+}
+
+// Validate 检查定时任务的触发规则与策略是否有效
+func (s *Schedule) Validate() error {
+	if (s.Cron == "") == (s.Interval == "") {
+		return fmt.Errorf("cron 与 interval 必须且只能指定一个")
+	}
+	if s.Cron != "" {
+		if _, err := ParseCron(s.Cron); err != nil {
+			return err
+		}
+	}
+	if s.Interval != "" {
+		d, err := time.ParseDuration(s.Interval)
+		if err != nil {
+			return fmt.Errorf("interval 无效: %v", err)
+		}
+		if d < time.Minute {
+			return fmt.Errorf("interval 不能小于 1 分钟")
+		}
+	}
+	switch s.MissedRun {
+	case "":
+		s.MissedRun = MissedSkip
+	case MissedSkip, MissedCatchUp:
+	default:
+		return fmt.Errorf("不支持的 missed_run 策略: %s", s.MissedRun)
+	}
+	if len(s.Request) == 0 {
+		return fmt.Errorf("request 不能为空")
+	}
+	return nil
+}
+
+// next 返回晚于 t 的下一次触发时间
+func (s *Schedule) next(t time.Time) time.Time {
+	if s.Cron != "" {
+		expr, err := ParseCron(s.Cron)
+		if err != nil {
+			return time.Time{}
+		}
+		return expr.Next(t)
+	}
+	d, err := time.ParseDuration(s.Interval)
+	if err != nil || d <= 0 {
+		return time.Time{}
+	}
+	return t.Add(d)
+}
+
+// Manager 管理定时任务的增删改查、持久化与到期执行
+type Manager struct {
+	lock      sync.Mutex
+	path      string
+	schedules map[string]*Schedule
+	run       RunFunc
+	wake      chan struct{}
+	stop      chan struct{}
+	started   bool
+}
+
+// NewManager 创建定时任务管理器，path 为持久化文件路径
+func NewManager(path string, run RunFunc) *Manager {
+	return &Manager{
+		path:      path,
+		schedules: make(map[string]*Schedule),
+		run:       run,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Load 从磁盘加载定时任务，并按错过执行策略处理服务停止期间错过的执行
+func (m *Manager) Load() error {
+	data, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var list []*Schedule
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("解析定时任务文件失败: %v", err)
+	}
+
+	now := time.Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, s := range list {
+		if s.Enabled && !s.NextRun.IsZero() && s.NextRun.Before(now) {
+			if s.MissedRun == MissedCatchUp {
+				// 服务停止期间可能错过多次，只补执行一次
+				s.NextRun = now
+			} else {
+				s.NextRun = s.next(now)
+			}
+		}
+		m.schedules[s.ID] = s
+	}
+	return nil
+}
+
+// Start 启动后台协程，在定时任务到期时执行；Stop 之后可以再次启动
+func (m *Manager) Start() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.started {
+		return
+	}
+	m.started = true
+	// 上一次 Stop 已关闭 stop，重新创建以免新协程立即退出
+	m.stop = make(chan struct{})
+	go m.loop(m.stop)
+}
+
+// Stop 停止后台协程，正在执行的定时任务不受影响
+func (m *Manager) Stop() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.started {
+		close(m.stop)
+		m.started = false
+	}
+}
+
+// loop 等待最近一个到期的定时任务，到期后执行并计算下一次触发时间
+func (m *Manager) loop(stop <-chan struct{}) {
+	for {
+		wait := m.fireDue(time.Now())
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-m.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// fireDue 执行所有已到期的定时任务，返回距离下一个到期任务的等待时间
+func (m *Manager) fireDue(now time.Time) time.Duration {
+	m.lock.Lock()
+	var due []Schedule
+	wait := time.Hour
+	for _, s := range m.schedules {
+		if !s.Enabled || s.NextRun.IsZero() {
+			continue
+		}
+		if !s.NextRun.After(now) {
+			s.LastRun = now
+			s.NextRun = s.next(now)
+			due = append(due, *s)
+		}
+		if !s.NextRun.IsZero() {
+			if d := s.NextRun.Sub(now); d < wait {
+				wait = d
+			}
+		}
+	}
+	if len(due) > 0 {
+		m.saveLocked()
+	}
+	m.lock.Unlock()
+
+	for _, s := range due {
+		go m.execute(s)
+	}
+	return wait
+}
+
+// execute 执行一次定时任务并记录结果
+func (m *Manager) execute(s Schedule) {
+	run := Run{Time: time.Now()}
+	historyID, err := m.run(s)
+	run.HistoryID = historyID
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if current, ok := m.schedules[s.ID]; ok {
+		current.Runs = append(current.Runs, run)
+		if len(current.Runs) > maxRunRecords {
+			current.Runs = current.Runs[len(current.Runs)-maxRunRecords:]
+		}
+		m.saveLocked()
+	}
+}
+
+// notify 唤醒后台协程重新计算等待时间
+func (m *Manager) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// List 返回所有定时任务，按创建时间排序
+func (m *Manager) List() []Schedule {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	list := make([]Schedule, 0, len(m.schedules))
+	for _, s := range m.schedules {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Get 返回指定 ID 的定时任务
+func (m *Manager) Get(id string) (Schedule, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if s, ok := m.schedules[id]; ok {
+		return *s, true
+	}
+	return Schedule{}, false
+}
+
+// Create 新建定时任务
+func (m *Manager) Create(s Schedule) (Schedule, error) {
+	if err := s.Validate(); err != nil {
+		return Schedule{}, err
+	}
+
+	now := time.Now()
+	s.ID = uuid.New().String()
+	s.CreatedAt = now
+	s.LastRun = time.Time{}
+	s.Runs = []Run{}
+	s.NextRun = s.next(now)
+
+	m.lock.Lock()
+	m.schedules[s.ID] = &s
+	err := m.saveLocked()
+	m.lock.Unlock()
+
+	m.notify()
+	return s, err
+}
+
+// Update 修改定时任务的名称、触发规则、请求体与策略，保留执行记录
+func (m *Manager) Update(id string, update Schedule) (Schedule, error) {
+	if err := update.Validate(); err != nil {
+		return Schedule{}, err
+	}
+
+	m.lock.Lock()
+	s, ok := m.schedules[id]
+	if !ok {
+		m.lock.Unlock()
+		return Schedule{}, os.ErrNotExist
+	}
+	s.Name = update.Name
+	s.Cron = update.Cron
+	s.Interval = update.Interval
+	s.Request = update.Request
+	s.MissedRun = update.MissedRun
+	s.Enabled = update.Enabled
+	s.NextRun = s.next(time.Now())
+	result := *s
+	err := m.saveLocked()
+	m.lock.Unlock()
+
+	m.notify()
+	return result, err
+}
+
+// Delete 删除定时任务
+func (m *Manager) Delete(id string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.schedules[id]; !ok {
+		return false, nil
+	}
+	delete(m.schedules, id)
+	return true, m.saveLocked()
+}
+
+// Trigger 立即执行一次定时任务，不影响下一次触发时间
+func (m *Manager) Trigger(id string) (Run, error) {
+	s, ok := m.Get(id)
+	if !ok {
+		return Run{}, os.ErrNotExist
+	}
+
+	m.execute(s)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	// 执行期间定时任务可能已被删除
+	current, ok := m.schedules[id]
+	if !ok {
+		return Run{}, os.ErrNotExist
+	}
+	runs := current.Runs
+	if len(runs) == 0 {
+		return Run{}, nil
+	}
+	return runs[len(runs)-1], nil
+}
+
+// saveLocked 将定时任务写入磁盘，调用方需持有锁
+func (m *Manager) saveLocked() error {
+	list := make([]*Schedule, 0, len(m.schedules))
+	for _, s := range m.schedules {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
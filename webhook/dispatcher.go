@@ -0,0 +1,412 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 事件类型
+const (
+	EventJobStarted    = "job_started"    // 任务开始
+	EventJobFinished   = "job_finished"   // 任务结束(包括取消)
+	EventJobFailed     = "job_failed"     // 任务结束且所有文件均失败
+	EventFileCompleted = "file_completed" // 单个文件下载完成或因未变化而跳过
+	EventFileFailed    = "file_failed"    // 单个文件下载失败
+	EventPing          = "ping"           // 测试投递
+)
+
+// 投递状态
+const (
+	DeliveryPending   = "pending"   // 等待投递或重试中
+	DeliveryDelivered = "delivered" // 接收方返回 2xx
+	DeliveryFailed    = "failed"    // 重试用尽或接收方拒绝
+)
+
+// 签名与事件相关的请求头
+const (
+	HeaderEvent     = "X-PaiDownloader-Event"
+	HeaderDelivery  = "X-PaiDownloader-Delivery"
+	HeaderSignature = "X-PaiDownloader-Signature"
+)
+
+const (
+	maxDeliveries   = 500              // 投递日志保留的记录数
+	maxAttempts     = 5                // 每次投递的最大尝试次数
+	initialBackoff  = time.Second      // 首次重试前的等待时间，之后逐次翻倍
+	maxBackoff      = time.Minute      // 重试等待时间的上限
+	deliveryTimeout = 10 * time.Second // 单次请求的超时
+	saveDelay       = 2 * time.Second  // 投递日志修改后延迟写入的时间，期间的修改合并为一次写入
+)
+
+// defaultEvents 未指定事件时订阅的任务级事件
+var defaultEvents = []string{EventJobStarted, EventJobFinished, EventJobFailed}
+
+// knownEvents 可订阅的事件
+var knownEvents = map[string]bool{
+	EventJobStarted:    true,
+	EventJobFinished:   true,
+	EventJobFailed:     true,
+	EventFileCompleted: true,
+	EventFileFailed:    true,
+}
+
+// Endpoint 一个 Webhook 接收地址
+type Endpoint struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"` // 非空时以 HMAC-SHA256 签名请求体
+	Events []string `json:"events,omitempty"` // 订阅的事件，为空时只接收任务级事件
+}
+
+// Validate 检查接收地址与订阅的事件是否有效
+func (e Endpoint) Validate() error {
+	parsed, err := url.Parse(e.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("webhook 地址无效: %s", e.URL)
+	}
+	for _, event := range e.Events {
+		if !knownEvents[event] {
+			return fmt.Errorf("不支持的 webhook 事件: %s", event)
+		}
+	}
+	return nil
+}
+
+// wants 判断接收地址是否订阅了指定事件
+func (e Endpoint) wants(event string) bool {
+	events := e.Events
+	if len(events) == 0 {
+		events = defaultEvents
+	}
+	for _, want := range events {
+		if want == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Event 投递给接收方的事件，即请求体
+type Event struct {
+	ID    string      `json:"id"`
+	Type  string      `json:"type"`
+	Time  time.Time   `json:"time"`
+	JobID string      `json:"job_id,omitempty"`
+	Data  interface{} `json:"data"`
+}
+
+// Attempt 一次投递尝试的结果
+type Attempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// Delivery 一个事件到一个接收地址的投递记录
+type Delivery struct {
+	ID        string    `json:"id"`
+	EventID   string    `json:"event_id"`
+	Event     string    `json:"event"`
+	JobID     string    `json:"job_id,omitempty"`
+	URL       string    `json:"url"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	Attempts  []Attempt `json:"attempts"`
+}
+
+// Dispatcher 向全局及任务级接收地址投递事件，失败时指数退避重试，并持久化投递日志
+type Dispatcher struct {
+	lock       sync.Mutex
+	path       string
+	client     *http.Client
+	endpoints  []Endpoint  // 全局接收地址
+	deliveries []*Delivery // 投递日志，按创建时间排序
+	logError   func(message string, err error)
+	dirty      bool        // 有尚未写入磁盘的投递记录修改
+	saveTimer  *time.Timer // 合并写入投递日志的定时器
+	saveLock   sync.Mutex  // 保证同一时间只有一次写入
+}
+
+// NewDispatcher 创建事件投递器，path 为投递日志的持久化文件路径
+func NewDispatcher(path string) *Dispatcher {
+	return &Dispatcher{
+		path:     path,
+		client:   &http.Client{Timeout: deliveryTimeout},
+		logError: func(message string, err error) {},
+	}
+}
+
+// SetErrorLog 设置投递器内部错误(如保存投递日志失败)的记录方式，未设置时不记录
+func (d *Dispatcher) SetErrorLog(logError func(message string, err error)) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.logError = logError
+}
+
+// Load 从磁盘加载投递日志，服务停止时仍在重试的投递记为失败
+func (d *Dispatcher) Load() error {
+	data, err := os.ReadFile(d.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var deliveries []*Delivery
+	if err := json.Unmarshal(data, &deliveries); err != nil {
+		return fmt.Errorf("解析投递日志失败: %v", err)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, delivery := range deliveries {
+		if delivery.Status == DeliveryPending {
+			delivery.Status = DeliveryFailed
+			delivery.Attempts = append(delivery.Attempts, Attempt{Time: time.Now(), Error: "服务重启，投递中断"})
+		}
+	}
+	d.deliveries = deliveries
+	return nil
+}
+
+// SetEndpoints 设置全局接收地址
+func (d *Dispatcher) SetEndpoints(endpoints []Endpoint) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.endpoints = append([]Endpoint(nil), endpoints...)
+}
+
+// Endpoints 返回全局接收地址
+func (d *Dispatcher) Endpoints() []Endpoint {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append([]Endpoint(nil), d.endpoints...)
+}
+
+// Dispatch 将事件异步投递给订阅了它的全局接收地址与 extra 中的任务级接收地址
+func (d *Dispatcher) Dispatch(eventType, jobID string, data interface{}, extra []Endpoint) {
+	event := Event{
+		ID:    uuid.New().String(),
+		Type:  eventType,
+		Time:  time.Now(),
+		JobID: jobID,
+		Data:  data,
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	for _, endpoint := range append(d.Endpoints(), extra...) {
+		if !endpoint.wants(eventType) {
+			continue
+		}
+		delivery := d.newDelivery(event, endpoint)
+		go d.deliver(delivery, endpoint, body)
+	}
+}
+
+// Test 向接收地址同步发送一次 ping 事件，不重试，返回投递记录
+func (d *Dispatcher) Test(endpoint Endpoint) Delivery {
+	event := Event{
+		ID:   uuid.New().String(),
+		Type: EventPing,
+		Time: time.Now(),
+		Data: map[string]string{"message": "PaiDownloader webhook 测试"},
+	}
+	body, _ := json.Marshal(event)
+
+	delivery := d.newDelivery(event, endpoint)
+	attempt := d.post(endpoint, delivery, body)
+	status := DeliveryFailed
+	if attempt.Error == "" && attempt.StatusCode/100 == 2 {
+		status = DeliveryDelivered
+	}
+	return d.record(delivery, attempt, status)
+}
+
+// Deliveries 返回投递日志，jobID 非空时只返回该任务的记录，按时间倒序，最多 limit 条
+func (d *Dispatcher) Deliveries(jobID string, limit int) []Delivery {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	result := make([]Delivery, 0)
+	for i := len(d.deliveries) - 1; i >= 0 && (limit <= 0 || len(result) < limit); i-- {
+		if jobID == "" || d.deliveries[i].JobID == jobID {
+			result = append(result, copyDelivery(d.deliveries[i]))
+		}
+	}
+	return result
+}
+
+// Get 返回指定 ID 的投递记录
+func (d *Dispatcher) Get(id string) (Delivery, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, delivery := range d.deliveries {
+		if delivery.ID == id {
+			return copyDelivery(delivery), true
+		}
+	}
+	return Delivery{}, false
+}
+
+// Sign 计算请求体的 HMAC-SHA256 签名，格式为 sha256=<十六进制摘要>
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newDelivery 创建投递记录并加入日志
+func (d *Dispatcher) newDelivery(event Event, endpoint Endpoint) *Delivery {
+	delivery := &Delivery{
+		ID:        uuid.New().String(),
+		EventID:   event.ID,
+		Event:     event.Type,
+		JobID:     event.JobID,
+		URL:       endpoint.URL,
+		Status:    DeliveryPending,
+		CreatedAt: time.Now(),
+		Attempts:  []Attempt{},
+	}
+
+	d.lock.Lock()
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > maxDeliveries {
+		d.deliveries = d.deliveries[len(d.deliveries)-maxDeliveries:]
+	}
+	d.lock.Unlock()
+	return delivery
+}
+
+// deliver 投递事件，网络错误、5xx、408 与 429 时按指数退避重试
+func (d *Dispatcher) deliver(delivery *Delivery, endpoint Endpoint, body []byte) {
+	backoff := initialBackoff
+	for i := 1; ; i++ {
+		attempt := d.post(endpoint, delivery, body)
+		if attempt.Error == "" && attempt.StatusCode/100 == 2 {
+			d.record(delivery, attempt, DeliveryDelivered)
+			return
+		}
+		if i >= maxAttempts || !retryable(attempt) {
+			d.record(delivery, attempt, DeliveryFailed)
+			return
+		}
+		d.record(delivery, attempt, DeliveryPending)
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// retryable 判断投递失败后是否应重试
+func retryable(attempt Attempt) bool {
+	if attempt.StatusCode == 0 {
+		return true
+	}
+	return attempt.StatusCode >= 500 || attempt.StatusCode == http.StatusRequestTimeout || attempt.StatusCode == http.StatusTooManyRequests
+}
+
+// post 发送一次请求，返回尝试结果
+func (d *Dispatcher) post(endpoint Endpoint, delivery *Delivery, body []byte) (attempt Attempt) {
+	attempt.Time = time.Now()
+	defer func() { attempt.DurationMs = time.Since(attempt.Time).Milliseconds() }()
+
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "PaiDownloader-Webhook")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	if endpoint.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(endpoint.Secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	resp.Body.Close()
+	attempt.StatusCode = resp.StatusCode
+	return attempt
+}
+
+// record 记录一次尝试的结果，投递日志延迟合并写入磁盘，返回更新后的投递记录
+func (d *Dispatcher) record(delivery *Delivery, attempt Attempt, status string) Delivery {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.Status = status
+	d.dirty = true
+	if d.saveTimer == nil {
+		d.saveTimer = time.AfterFunc(saveDelay, d.Flush)
+	}
+	return copyDelivery(delivery)
+}
+
+// Flush 立即将尚未写入的投递日志保存到磁盘，服务关闭前调用
+func (d *Dispatcher) Flush() {
+	d.saveLock.Lock()
+	defer d.saveLock.Unlock()
+
+	d.lock.Lock()
+	if d.saveTimer != nil {
+		d.saveTimer.Stop()
+		d.saveTimer = nil
+	}
+	if !d.dirty {
+		d.lock.Unlock()
+		return
+	}
+	data, err := json.MarshalIndent(d.deliveries, "", "  ")
+	d.dirty = false
+	logError := d.logError
+	d.lock.Unlock()
+
+	// 写入文件时不持有锁，不阻塞投递
+	if err == nil {
+		err = d.save(data)
+	}
+	if err != nil {
+		d.lock.Lock()
+		d.dirty = true // 下一次写入时重试
+		d.lock.Unlock()
+		logError("保存投递日志失败", err)
+	}
+}
+
+// copyDelivery 返回投递记录的副本
+func copyDelivery(delivery *Delivery) Delivery {
+	result := *delivery
+	result.Attempts = append([]Attempt{}, delivery.Attempts...)
+	return result
+}
+
+// save 将序列化后的投递日志写入临时文件后替换，调用方需持有 saveLock
+func (d *Dispatcher) save(data []byte) error {
+	tmp := d.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.path)
+}
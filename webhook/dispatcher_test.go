@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		body   string
+		want   string
+	}{
+		{
+			name:   "标准测试向量",
+			secret: "key",
+			body:   "The quick brown fox jumps over the lazy dog",
+			want:   "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		},
+		{
+			name:   "空密钥与空请求体",
+			secret: "",
+			body:   "",
+			want:   "sha256=b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, []byte(tt.body)); got != tt.want {
+				t.Errorf("Sign(%q, %q) = %s，期望 %s", tt.secret, tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignDependsOnSecretAndBody(t *testing.T) {
+	base := Sign("secret", []byte(`{"id":"1"}`))
+	if Sign("other", []byte(`{"id":"1"}`)) == base {
+		t.Error("不同密钥的签名相同")
+	}
+	if Sign("secret", []byte(`{"id":"2"}`)) == base {
+		t.Error("不同请求体的签名相同")
+	}
+}
+
+func TestDeliverySignature(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     string
+		wantSigned bool
+	}{
+		{name: "配置密钥时签名请求体", secret: "topsecret", wantSigned: true},
+		{name: "未配置密钥时不签名", secret: "", wantSigned: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			var signature string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ = io.ReadAll(r.Body)
+				signature = r.Header.Get(HeaderSignature)
+				if r.Header.Get(HeaderEvent) != EventPing {
+					t.Errorf("%s = %q，期望 %s", HeaderEvent, r.Header.Get(HeaderEvent), EventPing)
+				}
+			}))
+			defer server.Close()
+
+			d := NewDispatcher(filepath.Join(t.TempDir(), "deliveries.json"))
+			delivery := d.Test(Endpoint{URL: server.URL, Secret: tt.secret})
+			if delivery.Status != DeliveryDelivered {
+				t.Fatalf("投递状态为 %s，期望 %s", delivery.Status, DeliveryDelivered)
+			}
+
+			if !tt.wantSigned {
+				if signature != "" {
+					t.Errorf("未配置密钥时收到签名 %s", signature)
+				}
+				return
+			}
+			// 接收方按同样的方式计算签名并以常量时间比较
+			if !hmac.Equal([]byte(signature), []byte(Sign(tt.secret, body))) {
+				t.Errorf("签名 %s 与请求体不匹配", signature)
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{status: 0, want: true}, // 网络错误
+		{status: http.StatusInternalServerError, want: true},
+		{status: http.StatusBadGateway, want: true},
+		{status: http.StatusRequestTimeout, want: true},
+		{status: http.StatusTooManyRequests, want: true},
+		{status: http.StatusBadRequest, want: false},
+		{status: http.StatusUnauthorized, want: false},
+		{status: http.StatusNotFound, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := retryable(Attempt{StatusCode: tt.status}); got != tt.want {
+			t.Errorf("retryable(%d) = %v，期望 %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestEndpointValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		wantErr  bool
+	}{
+		{name: "https 地址", endpoint: Endpoint{URL: "https://example.com/hook"}},
+		{name: "订阅文件事件", endpoint: Endpoint{URL: "http://example.com/hook", Events: []string{EventFileCompleted, EventFileFailed}}},
+		{name: "不支持的协议", endpoint: Endpoint{URL: "ftp://example.com/hook"}, wantErr: true},
+		{name: "缺少主机", endpoint: Endpoint{URL: "http:///hook"}, wantErr: true},
+		{name: "未知事件", endpoint: Endpoint{URL: "https://example.com/hook", Events: []string{"job_paused"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.endpoint.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v，期望出错 %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeliveryLogFlush(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "deliveries.json")
+	d := NewDispatcher(path)
+	for i := 0; i < 3; i++ {
+		d.Test(Endpoint{URL: server.URL})
+	}
+
+	// 投递记录合并写入，延迟时间内不写入磁盘
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Flush 前已写入投递日志: %v", err)
+	}
+	d.Flush()
+
+	loaded := NewDispatcher(path)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	deliveries := loaded.Deliveries("", 0)
+	if len(deliveries) != 3 {
+		t.Fatalf("投递日志中有 %d 条记录，期望 3 条", len(deliveries))
+	}
+	for _, delivery := range deliveries {
+		if delivery.Status != DeliveryDelivered || len(delivery.Attempts) != 1 {
+			t.Errorf("投递记录 %+v，期望投递成功且尝试一次", delivery)
+		}
+	}
+}